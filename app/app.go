@@ -4,11 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/aesoper101/x/interrupt"
+	"go.uber.org/multierr"
 	"io"
 	"os"
 	"sort"
 	"strconv"
+	"time"
 )
 
 // EnvContainer provides environment variables.
@@ -126,13 +127,36 @@ func NewArgContainerForOS() ArgContainer {
 	return newArgContainer(os.Args)
 }
 
-// Container contains environment variables, args, and stdio.
+// ShutdownContainer registers and runs shutdown hooks.
+type ShutdownContainer interface {
+	// OnShutdown registers a hook to be run by Run after the application function returns.
+	//
+	// Hooks are run in the reverse order of registration, even if the application
+	// function failed, with a context that is not cancelled by interrupt signals but
+	// that expires after the grace period set with RunWithGracePeriod.
+	OnShutdown(hook func(context.Context) error)
+	// RunShutdownHooks runs the registered hooks in the reverse order of registration,
+	// and removes them.
+	//
+	// Every hook is run even if an earlier hook fails. This is called by Run.
+	RunShutdownHooks(ctx context.Context) error
+}
+
+// NewShutdownContainer returns a new ShutdownContainer.
+//
+// Container implementations can embed it to implement ShutdownContainer.
+func NewShutdownContainer() ShutdownContainer {
+	return newShutdownContainer()
+}
+
+// Container contains environment variables, args, stdio, and shutdown hooks.
 type Container interface {
 	EnvContainer
 	StdinContainer
 	StdoutContainer
 	StderrContainer
 	ArgContainer
+	ShutdownContainer
 }
 
 // NewContainer returns a new Container.
@@ -149,6 +173,7 @@ func NewContainer(
 		NewStdoutContainer(stdout),
 		NewStderrContainer(stderr),
 		NewArgContainer(args...),
+		newShutdownContainer(),
 	)
 }
 
@@ -164,10 +189,13 @@ func NewContainerForOS() (Container, error) {
 		NewStdoutContainerForOS(),
 		NewStderrContainerForOS(),
 		NewArgContainerForOS(),
+		newShutdownContainer(),
 	), nil
 }
 
 // NewContainerForArgs returns a new Container with the replacement args.
+//
+// Shutdown hooks registered on the new Container are registered on the input Container.
 func NewContainerForArgs(container Container, newArgs ...string) Container {
 	return newContainer(
 		container,
@@ -175,6 +203,7 @@ func NewContainerForArgs(container Container, newArgs ...string) Container {
 		container,
 		container,
 		NewArgContainer(newArgs...),
+		container,
 	)
 }
 
@@ -287,29 +316,77 @@ func IsDevPath(path string) bool {
 }
 
 // Main runs the application using the OS Container and calling os.Exit on the return value of Run.
-func Main(ctx context.Context, f func(context.Context, Container) error) {
+func Main(ctx context.Context, f func(context.Context, Container) error, options ...RunOption) {
 	container, err := NewContainerForOS()
 	if err != nil {
 		printError(container, err)
 		os.Exit(GetExitCode(err))
 	}
-	os.Exit(GetExitCode(Run(ctx, container, f)))
+	os.Exit(GetExitCode(Run(ctx, container, f, options...)))
 }
 
 // Run runs the application using the container.
 //
-// The run will be stopped on interrupt signal.
+// Unless RunWithoutSignalHandling is used, the context is cancelled on the first
+// interrupt signal, and a second interrupt signal exits the process immediately with
+// ExitCodeInterrupt for SIGINT or ExitCodeTerminate for SIGTERM.
+//
+// Shutdown hooks registered on the container are run after f returns, with
+// RunShutdownHooks.
 // The exit code can be determined using GetExitCode.
-func Run(ctx context.Context, container Container, f func(context.Context, Container) error) error {
-	ctx, cancel := interrupt.WithCancel(ctx)
-	defer cancel()
-	if err := f(ctx, container); err != nil {
+func Run(ctx context.Context, container Container, f func(context.Context, Container) error, options ...RunOption) error {
+	runOptions := newRunOptions()
+	for _, option := range options {
+		option(runOptions)
+	}
+	// Shutdown hooks get a context that outlives the cancellation of ctx by signals.
+	shutdownCtx := context.WithoutCancel(ctx)
+	if runOptions.signalHandling {
+		var stop func()
+		ctx, stop = runOptions.handleSignals(ctx)
+		defer stop()
+	}
+	err := f(ctx, container)
+	if runOptions.gracePeriod > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, runOptions.gracePeriod)
+		defer cancel()
+	}
+	err = multierr.Append(err, container.RunShutdownHooks(shutdownCtx))
+	if err != nil {
 		printError(container, err)
 		return err
 	}
 	return nil
 }
 
+// RunOption is an option for Main and Run.
+type RunOption func(*runOptions)
+
+// RunWithGracePeriod returns a new RunOption that limits how long the application has
+// to shut down after the first interrupt signal.
+//
+// If the application function and shutdown hooks have not returned within the grace
+// period, the process exits as if a second interrupt signal was sent. The grace period
+// also bounds the context passed to shutdown hooks.
+//
+// The default is no grace period, that is to wait until a second interrupt signal.
+func RunWithGracePeriod(gracePeriod time.Duration) RunOption {
+	return func(runOptions *runOptions) {
+		runOptions.gracePeriod = gracePeriod
+	}
+}
+
+// RunWithoutSignalHandling returns a new RunOption that does not handle interrupt signals.
+//
+// The context is not cancelled on interrupt signals, and the default behavior of the
+// signals applies.
+func RunWithoutSignalHandling() RunOption {
+	return func(runOptions *runOptions) {
+		runOptions.signalHandling = false
+	}
+}
+
 // NewError returns a new Error that contains an exit code.
 //
 // The exit code cannot be 0.
@@ -331,10 +408,23 @@ func WrapError(exitCode int, err error) error {
 	return newAppError(exitCode, err)
 }
 
+// WrapDebugError returns a new error that prints with its full cause chain.
+//
+// This is used to implement a --debug mode. The exit code of err is preserved.
+// Returns nil if err is nil.
+func WrapDebugError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return newDebugError(err)
+}
+
 // GetExitCode gets the exit code.
 //
 // If err == nil, this returns 0.
 // If err was created by this package, this returns the exit code from the error.
+// If err is an errorsext error, this returns the matching sysexits-style exit
+// code, for example ExitCodeNoInput for errorsext.NotFound.
 // Otherwise, this returns 1.
 func GetExitCode(err error) int {
 	if err == nil {
@@ -344,5 +434,8 @@ func GetExitCode(err error) int {
 	if errors.As(err, &appErr) {
 		return appErr.exitCode
 	}
+	if exitCode, ok := getErrorsextExitCode(err); ok {
+		return exitCode
+	}
 	return 1
 }
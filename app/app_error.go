@@ -3,6 +3,9 @@ package app
 import (
 	"errors"
 	"fmt"
+	"github.com/aesoper101/x/errorsext"
+	"sort"
+	"strings"
 )
 
 type appError struct {
@@ -45,8 +48,106 @@ func (e *appError) Unwrap() error {
 	return e.err
 }
 
+type debugError struct {
+	err error
+}
+
+func newDebugError(err error) *debugError {
+	return &debugError{
+		err: err,
+	}
+}
+
+func (e *debugError) Error() string {
+	if e == nil {
+		return ""
+	}
+	return e.err.Error()
+}
+
+func (e *debugError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.err
+}
+
+// printError prints the error to stderr.
+//
+// errorsext errors are printed with their message, reason, and details. If the
+// error was wrapped with WrapDebugError, the full cause chain is printed as well.
 func printError(container StderrContainer, err error) {
-	if errString := err.Error(); errString != "" {
+	var errorsextErr errorsext.Error
+	if errors.As(err, &errorsextErr) {
+		printErrorsextError(container, err, errorsextErr)
+	} else if errString := err.Error(); errString != "" {
 		_, _ = fmt.Fprintln(container.Stderr(), errString)
 	}
+	if debugErr := (&debugError{}); errors.As(err, &debugErr) {
+		printCauseChain(container, debugErr.err)
+	}
+}
+
+func printErrorsextError(container StderrContainer, err error, errorsextErr errorsext.Error) {
+	message := errorsextErr.Message()
+	if message == "" {
+		message = err.Error()
+	} else if errString, errorsextErrString := err.Error(), errorsextErr.Error(); errString != errorsextErrString {
+		// Keep the context that the errorsext error was wrapped with, such as
+		// with fmt.Errorf("loading %s: %w", ...).
+		if prefix, ok := strings.CutSuffix(errString, errorsextErrString); ok {
+			message = prefix + message
+		} else {
+			message = errString
+		}
+	}
+	if message != "" {
+		_, _ = fmt.Fprintln(container.Stderr(), message)
+	}
+	if reason := errorsextErr.Reason(); reason != "" {
+		_, _ = fmt.Fprintf(container.Stderr(), "  reason: %s\n", reason)
+	}
+	details := errorsextErr.Details()
+	if len(details) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	_, _ = fmt.Fprintln(container.Stderr(), "  details:")
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(container.Stderr(), "    %s: %v\n", key, details[key])
+	}
+}
+
+func printCauseChain(container StderrContainer, err error) {
+	_, _ = fmt.Fprintln(container.Stderr(), "cause chain:")
+	printCauseChainRec(container, err, 1, "")
+}
+
+func printCauseChainRec(container StderrContainer, err error, depth int, parentErrString string) {
+	for err != nil {
+		errString := err.Error()
+		// Many wrappers such as the errorsext types return the Error of what they
+		// wrap, do not print the same line multiple times.
+		if errString != parentErrString {
+			_, _ = fmt.Fprintf(
+				container.Stderr(),
+				"%s%T: %s\n",
+				strings.Repeat("  ", depth),
+				err,
+				errString,
+			)
+			parentErrString = errString
+		}
+		if multiErr, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, childErr := range multiErr.Unwrap() {
+				printCauseChainRec(container, childErr, depth+1, "")
+			}
+			return
+		}
+		err = errors.Unwrap(err)
+	}
 }
@@ -1,7 +1,16 @@
 package app
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/aesoper101/x/errorsext"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -146,3 +155,219 @@ func TestEnvBool(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, true, val)
 }
+
+func TestGetExitCode(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 0, GetExitCode(nil))
+	assert.Equal(t, 1, GetExitCode(errors.New("foo")))
+	assert.Equal(t, 5, GetExitCode(NewError(5, "foo")))
+	assert.Equal(t, 5, GetExitCode(WrapError(5, errorsext.ThrowNotFound(nil, "", "foo"))))
+	assert.Equal(t, ExitCodeUsage, GetExitCode(errorsext.ThrowInvalidArgument(nil, "", "foo")))
+	assert.Equal(t, ExitCodeNoInput, GetExitCode(fmt.Errorf("bar: %w", errorsext.ThrowNotFound(nil, "", "foo"))))
+	assert.Equal(t, ExitCodeNoPerm, GetExitCode(errorsext.ThrowPermissionDenied(nil, "", "foo")))
+	assert.Equal(t, ExitCodeUnavailable, GetExitCode(errorsext.ThrowUnavailable(nil, "", "foo")))
+	assert.Equal(t, ExitCodeTempFail, GetExitCode(errorsext.ThrowDeadlineExceeded(nil, "", "foo")))
+	assert.Equal(t, ExitCodeSoftware, GetExitCode(errorsext.ThrowInternal(nil, "", "foo")))
+	assert.Equal(t, 1, GetExitCode(errorsext.ThrowUnknown(nil, "", "foo")))
+	assert.Equal(t, ExitCodeNoInput, GetExitCode(WrapDebugError(errorsext.ThrowNotFound(nil, "", "foo"))))
+}
+
+func TestPrintError(t *testing.T) {
+	t.Parallel()
+	buffer := bytes.NewBuffer(nil)
+	printError(NewStderrContainer(buffer), errors.New("foo"))
+	assert.Equal(t, "foo\n", buffer.String())
+
+	notFoundErr := errorsext.ThrowNotFound(errors.New("no such file"), "ModuleNotFound", "module foo not found")
+	notFoundErr.(errorsext.Error).WithDetails(map[string]interface{}{"name": "foo", "digest": "abc"})
+	buffer.Reset()
+	printError(NewStderrContainer(buffer), notFoundErr)
+	assert.Equal(
+		t,
+		`module foo not found
+  reason: ModuleNotFound
+  details:
+    digest: abc
+    name: foo
+`,
+		buffer.String(),
+	)
+
+	buffer.Reset()
+	printError(NewStderrContainer(buffer), fmt.Errorf("loading foo: %w", notFoundErr))
+	assert.Equal(
+		t,
+		`loading foo: module foo not found
+  reason: ModuleNotFound
+  details:
+    digest: abc
+    name: foo
+`,
+		buffer.String(),
+	)
+
+	buffer.Reset()
+	printError(NewStderrContainer(buffer), WrapDebugError(fmt.Errorf("bar: %w", errors.New("baz"))))
+	assert.Equal(
+		t,
+		`bar: baz
+cause chain:
+  *fmt.wrapError: bar: baz
+  *errors.errorString: baz
+`,
+		buffer.String(),
+	)
+}
+
+func TestRunShutdownHooks(t *testing.T) {
+	t.Parallel()
+	stderr := bytes.NewBuffer(nil)
+	container := NewContainer(nil, nil, nil, stderr, "test")
+	var order []string
+	err := Run(
+		context.Background(),
+		container,
+		func(ctx context.Context, container Container) error {
+			container.OnShutdown(
+				func(context.Context) error {
+					order = append(order, "first")
+					return errors.New("foo")
+				},
+			)
+			// Hooks registered on a Container for new args run with the original Container.
+			NewContainerForArgs(container, "test", "sub").OnShutdown(
+				func(ctx context.Context) error {
+					order = append(order, "second")
+					_, hasDeadline := ctx.Deadline()
+					assert.True(t, hasDeadline)
+					return errors.New("bar")
+				},
+			)
+			return nil
+		},
+		RunWithGracePeriod(time.Minute),
+	)
+	assert.EqualError(t, err, "bar; foo")
+	assert.Equal(t, []string{"second", "first"}, order)
+	assert.Equal(t, "bar; foo\n", stderr.String())
+}
+
+func TestRunShutdownHooksCustomContainer(t *testing.T) {
+	t.Parallel()
+	stderr := bytes.NewBuffer(nil)
+	container := &testContainer{
+		EnvStdioContainer: NewContainer(nil, nil, nil, stderr),
+		ArgContainer:      NewArgContainer("test"),
+		ShutdownContainer: NewShutdownContainer(),
+	}
+	var order []string
+	err := Run(
+		context.Background(),
+		container,
+		func(ctx context.Context, appContainer Container) error {
+			// The application function gets the Container that Run was given.
+			assert.Same(t, container, appContainer)
+			appContainer.OnShutdown(
+				func(context.Context) error {
+					order = append(order, "first")
+					return errors.New("foo")
+				},
+			)
+			NewContainerForArgs(appContainer, "test", "sub").OnShutdown(
+				func(context.Context) error {
+					order = append(order, "second")
+					return nil
+				},
+			)
+			return nil
+		},
+	)
+	assert.EqualError(t, err, "foo")
+	assert.Equal(t, []string{"second", "first"}, order)
+	assert.Equal(t, "foo\n", stderr.String())
+	assert.Equal(t, 1, container.runShutdownHooksCalls)
+	// The hooks are removed once run.
+	require.NoError(t, container.RunShutdownHooks(context.Background()))
+	assert.Equal(t, []string{"second", "first"}, order)
+}
+
+// testContainer is a Container that is not created by this package.
+type testContainer struct {
+	EnvStdioContainer
+	ArgContainer
+	ShutdownContainer
+	runShutdownHooksCalls int
+}
+
+func (c *testContainer) RunShutdownHooks(ctx context.Context) error {
+	c.runShutdownHooksCalls++
+	return c.ShutdownContainer.RunShutdownHooks(ctx)
+}
+
+func TestRunSignals(t *testing.T) {
+	t.Parallel()
+	testRunSignals(t, []os.Signal{syscall.SIGINT}, 0, 0)
+	testRunSignals(t, []os.Signal{syscall.SIGINT, syscall.SIGINT}, 0, ExitCodeInterrupt)
+	testRunSignals(t, []os.Signal{syscall.SIGTERM, syscall.SIGTERM}, 0, ExitCodeTerminate)
+	testRunSignals(t, []os.Signal{syscall.SIGTERM}, time.Millisecond, ExitCodeTerminate)
+}
+
+func testRunSignals(t *testing.T, signals []os.Signal, gracePeriod time.Duration, expectedExitCode int) {
+	signalC := make(chan os.Signal, len(signals))
+	exitC := make(chan int, 1)
+	var shutdownErr error
+	err := Run(
+		context.Background(),
+		NewContainer(nil, nil, nil, bytes.NewBuffer(nil), "test"),
+		func(ctx context.Context, container Container) error {
+			container.OnShutdown(
+				func(ctx context.Context) error {
+					// Shutdown hooks are not cancelled by signals.
+					shutdownErr = ctx.Err()
+					return nil
+				},
+			)
+			for _, signal := range signals {
+				signalC <- signal
+			}
+			<-ctx.Done()
+			if expectedExitCode != 0 {
+				select {
+				case exitCode := <-exitC:
+					assert.Equal(t, expectedExitCode, exitCode)
+				case <-time.After(10 * time.Second):
+					assert.Fail(t, "timed out waiting for exit")
+				}
+			}
+			return nil
+		},
+		RunWithGracePeriod(gracePeriod),
+		func(runOptions *runOptions) {
+			runOptions.newSignalChannel = func() (<-chan os.Signal, func()) {
+				return signalC, func() {}
+			}
+			runOptions.exit = func(exitCode int) {
+				exitC <- exitCode
+			}
+		},
+	)
+	require.NoError(t, err)
+	assert.NoError(t, shutdownErr)
+	if expectedExitCode == 0 {
+		assert.Empty(t, exitC)
+	}
+}
+
+func TestRunWithoutSignalHandling(t *testing.T) {
+	t.Parallel()
+	err := Run(
+		context.Background(),
+		NewContainer(nil, nil, nil, nil, "test"),
+		func(ctx context.Context, container Container) error {
+			assert.Nil(t, ctx.Done())
+			return nil
+		},
+		RunWithoutSignalHandling(),
+	)
+	require.NoError(t, err)
+}
@@ -0,0 +1,174 @@
+package appcmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aesoper101/x/app"
+	"github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml/v2"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/v2"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// aliasConfigKey is the key of the alias section within an alias config file.
+const aliasConfigKey = "alias"
+
+// ReadAliasConfigFile reads the user-defined aliases from the "alias" section of
+// the config file at the given path.
+//
+// The file format is determined by the extension, and can be one of .toml, .yaml,
+// .yml, or .json. For example, the TOML line alias.st = "status --short" defines
+// the alias st.
+//
+// Returns nil if the file does not exist or has no alias section.
+func ReadAliasConfigFile(filePath string) (map[string]string, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var parser koanf.Parser
+	switch ext := filepath.Ext(filePath); ext {
+	case ".toml":
+		parser = toml.Parser()
+	case ".json":
+		parser = json.Parser()
+	case ".yaml", ".yml":
+		parser = yaml.Parser()
+	default:
+		return nil, fmt.Errorf("unknown alias config file extension: %s", ext)
+	}
+	fileData, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parser.Unmarshal(fileData)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	value, ok := data[aliasConfigKey]
+	if !ok {
+		return nil, nil
+	}
+	section, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: %q must be a map of alias name to command", filePath, aliasConfigKey)
+	}
+	aliases := make(map[string]string, len(section))
+	for name, expansion := range section {
+		expansionString, ok := expansion.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: alias %q must be a string", filePath, name)
+		}
+		aliases[name] = expansionString
+	}
+	return aliases, nil
+}
+
+func getAliases(envContainer app.EnvContainer, runOptions *runOptions) (map[string]string, error) {
+	aliases := make(map[string]string)
+	if runOptions.getAliasConfigFilePath != nil {
+		filePath, err := runOptions.getAliasConfigFilePath(envContainer)
+		if err != nil {
+			return nil, err
+		}
+		if filePath != "" {
+			fileAliases, err := ReadAliasConfigFile(filePath)
+			if err != nil {
+				return nil, err
+			}
+			for name, expansion := range fileAliases {
+				aliases[name] = expansion
+			}
+		}
+	}
+	for name, expansion := range runOptions.aliases {
+		aliases[name] = expansion
+	}
+	return aliases, nil
+}
+
+// expandAliases expands the first argument if it is a user-defined alias.
+//
+// Like git, aliases never shadow sub-commands, and an alias is only expanded once.
+func expandAliases(cmd *cobra.Command, args []string, aliases map[string]string) ([]string, error) {
+	if len(args) == 0 || len(aliases) == 0 || !cmd.HasSubCommands() {
+		return args, nil
+	}
+	name := args[0]
+	if strings.HasPrefix(name, "-") {
+		return args, nil
+	}
+	for _, child := range cmd.Commands() {
+		if child.Name() == name || child.HasAlias(name) {
+			return args, nil
+		}
+	}
+	expansion, ok := aliases[name]
+	if !ok {
+		return args, nil
+	}
+	expandedArgs, err := splitAliasExpansion(expansion)
+	if err != nil {
+		return nil, fmt.Errorf("alias %q: %w", name, err)
+	}
+	if len(expandedArgs) == 0 {
+		return nil, fmt.Errorf("alias %q expands to an empty command", name)
+	}
+	return append(expandedArgs, args[1:]...), nil
+}
+
+// splitAliasExpansion splits the alias expansion into arguments.
+//
+// Arguments are separated by whitespace. Single quotes, double quotes, and
+// backslash escapes are handled as in a POSIX shell, without any expansion.
+func splitAliasExpansion(expansion string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range expansion {
+		switch {
+		case escaped:
+			_, _ = current.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				_, _ = current.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			_, _ = current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -80,13 +80,51 @@ func NewInvalidArgumentErrorf(format string, args ...any) error {
 }
 
 // Main runs the application using the OS container and calling os.Exit on the return value of Run.
-func Main(ctx context.Context, command *Command) {
-	app.Main(ctx, newRunFunc(command))
+func Main(ctx context.Context, command *Command, options ...RunOption) {
+	runOptions := newRunOptions(options...)
+	app.Main(ctx, newRunFunc(command, runOptions), runOptions.appRunOptions...)
 }
 
 // Run runs the application using the container.
-func Run(ctx context.Context, container app.Container, command *Command) error {
-	return app.Run(ctx, container, newRunFunc(command))
+func Run(ctx context.Context, container app.Container, command *Command, options ...RunOption) error {
+	runOptions := newRunOptions(options...)
+	return app.Run(ctx, container, newRunFunc(command, runOptions), runOptions.appRunOptions...)
+}
+
+// RunOption is an option for Main and Run.
+type RunOption func(*runOptions)
+
+// RunWithAliases returns a new RunOption that adds user-defined aliases.
+//
+// The key is the alias name, and the value is the command line it expands to,
+// for example "st" to "status --short". As with git, only the first argument
+// is expanded, and aliases never shadow sub-commands.
+//
+// These take precedence over aliases read with RunWithAliasConfigFile.
+func RunWithAliases(aliases map[string]string) RunOption {
+	return func(runOptions *runOptions) {
+		for name, expansion := range aliases {
+			runOptions.aliases[name] = expansion
+		}
+	}
+}
+
+// RunWithAliasConfigFile returns a new RunOption that reads user-defined aliases
+// with ReadAliasConfigFile from the file path returned by getFilePath.
+//
+// If getFilePath returns the empty string, no aliases are read.
+func RunWithAliasConfigFile(getFilePath func(app.EnvContainer) (string, error)) RunOption {
+	return func(runOptions *runOptions) {
+		runOptions.getAliasConfigFilePath = getFilePath
+	}
+}
+
+// RunWithAppRunOptions returns a new RunOption that passes the given options to app.Main
+// or app.Run, for example app.RunWithGracePeriod.
+func RunWithAppRunOptions(options ...app.RunOption) RunOption {
+	return func(runOptions *runOptions) {
+		runOptions.appRunOptions = append(runOptions.appRunOptions, options...)
+	}
 }
 
 // BindMultiple is a convenience function for binding multiple flag functions.
@@ -106,9 +144,25 @@ func MarkFlagRequired(flagSet *pflag.FlagSet, flagName string) error {
 
 // *** PRIVATE ***
 
-func newRunFunc(command *Command) func(context.Context, app.Container) error {
+type runOptions struct {
+	aliases                map[string]string
+	getAliasConfigFilePath func(app.EnvContainer) (string, error)
+	appRunOptions          []app.RunOption
+}
+
+func newRunOptions(options ...RunOption) *runOptions {
+	runOptions := &runOptions{
+		aliases: make(map[string]string),
+	}
+	for _, option := range options {
+		option(runOptions)
+	}
+	return runOptions
+}
+
+func newRunFunc(command *Command, runOptions *runOptions) func(context.Context, app.Container) error {
 	return func(ctx context.Context, container app.Container) error {
-		return run(ctx, container, command)
+		return run(ctx, container, command, runOptions)
 	}
 }
 
@@ -116,6 +170,7 @@ func run(
 	ctx context.Context,
 	container app.Container,
 	command *Command,
+	runOptions *runOptions,
 ) error {
 	var runErr error
 
@@ -183,7 +238,16 @@ func run(
 	}
 
 	cobraCommand.SetOut(container.Stderr())
-	args := app.Args(container)[1:]
+	// We do our own suggestions for both sub-commands and flags.
+	cobraCommand.SetFlagErrorFunc(flagErrorFunc)
+	aliases, err := getAliases(container, runOptions)
+	if err != nil {
+		return err
+	}
+	args, err := expandAliases(cobraCommand, app.Args(container)[1:], aliases)
+	if err != nil {
+		return err
+	}
 	// cobra will implicitly create __complete and __completeNoDesc subcommands
 	// https://github.com/spf13/cobra/blob/4590150168e93f4b017c6e33469e26590ba839df/completions.go#L14-L17
 	// at the very last possible point, to enable them to be overridden. Unfortunately
@@ -234,13 +298,19 @@ func commandToCobra(
 	if command.Args != nil {
 		cobraPositionalArgs = command.Args.cobra()
 	}
+	if cobraPositionalArgs == nil && len(command.SubCommands) > 0 {
+		// Otherwise cobra rejects unknown sub-commands of the root command itself,
+		// and we want to handle them the same at every level.
+		cobraPositionalArgs = cobra.ArbitraryArgs
+	}
 	cobraCommand := &cobra.Command{
-		Use:        command.Use,
-		Aliases:    command.Aliases,
-		Args:       cobraPositionalArgs,
-		Deprecated: command.Deprecated,
-		Hidden:     command.Hidden,
-		Short:      strings.TrimSpace(command.Short),
+		Use:                command.Use,
+		Aliases:            command.Aliases,
+		Args:               cobraPositionalArgs,
+		Deprecated:         command.Deprecated,
+		Hidden:             command.Hidden,
+		Short:              strings.TrimSpace(command.Short),
+		DisableSuggestions: true,
 	}
 	cobraCommand.SetHelpTemplate(
 		`{{.Short}}
@@ -305,7 +375,7 @@ func commandToCobra(
 			if len(args) == 0 {
 				*runErrAddr = errors.New("Sub-command required.")
 			} else {
-				*runErrAddr = fmt.Errorf("Unknown sub-command: %s", strings.Join(args, " "))
+				*runErrAddr = newUnknownSubCommandError(cmd, args)
 			}
 		}
 		for _, subCommand := range command.SubCommands {
@@ -8,6 +8,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -211,3 +213,166 @@ func TestIncorrectFlagEmptyStdout(t *testing.T) {
 	require.Empty(t, stdout.String())
 	require.NotEmpty(t, stderr.String())
 }
+
+func TestUnknownSubCommandSuggestions(t *testing.T) {
+	t.Parallel()
+	newRootCommand := func() *Command {
+		return &Command{
+			Use: "test",
+			SubCommands: []*Command{
+				{
+					Use: "status",
+					Run: func(context.Context, app.Container) error {
+						return nil
+					},
+				},
+				{
+					Use: "group",
+					SubCommands: []*Command{
+						{
+							Use:     "list",
+							Aliases: []string{"ls"},
+							Run: func(context.Context, app.Container) error {
+								return nil
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	err := Run(
+		context.Background(),
+		app.NewContainer(nil, nil, nil, bytes.NewBuffer(nil), "test", "stauts"),
+		newRootCommand(),
+	)
+	require.Error(t, err)
+	assert.Equal(t, "Unknown sub-command: stauts\n\nDid you mean this?\n\tstatus", err.Error())
+
+	err = Run(
+		context.Background(),
+		app.NewContainer(nil, nil, nil, bytes.NewBuffer(nil), "test", "group", "lst"),
+		newRootCommand(),
+	)
+	require.Error(t, err)
+	assert.Equal(t, "Unknown sub-command: lst\n\nDid you mean this?\n\tlist", err.Error())
+
+	err = Run(
+		context.Background(),
+		app.NewContainer(nil, nil, nil, bytes.NewBuffer(nil), "test", "zzzzzz"),
+		newRootCommand(),
+	)
+	require.Error(t, err)
+	assert.Equal(t, "Unknown sub-command: zzzzzz", err.Error())
+}
+
+func TestUnknownFlagSuggestions(t *testing.T) {
+	t.Parallel()
+	rootCommand := &Command{
+		Use: "test",
+		BindPersistentFlags: func(flagSet *pflag.FlagSet) {
+			flagSet.String("output", "", "Output.")
+		},
+		SubCommands: []*Command{
+			{
+				Use: "sub",
+				BindFlags: func(flagSet *pflag.FlagSet) {
+					flagSet.Bool("short", false, "Short.")
+				},
+				Run: func(context.Context, app.Container) error {
+					return nil
+				},
+			},
+		},
+	}
+	err := Run(
+		context.Background(),
+		app.NewContainer(nil, nil, nil, bytes.NewBuffer(nil), "test", "sub", "--shrt", "--outptu", "foo"),
+		rootCommand,
+	)
+	require.Error(t, err)
+	assert.Equal(t, "unknown flag: --shrt\n\nDid you mean this?\n\t--short", err.Error())
+}
+
+func TestAliases(t *testing.T) {
+	t.Parallel()
+	var actualArgs []string
+	var short bool
+	newRootCommand := func() *Command {
+		return &Command{
+			Use: "test",
+			SubCommands: []*Command{
+				{
+					Use: "status",
+					BindFlags: func(flagSet *pflag.FlagSet) {
+						flagSet.BoolVar(&short, "short", false, "Short.")
+					},
+					Run: func(ctx context.Context, container app.Container) error {
+						actualArgs = app.Args(container)
+						return nil
+					},
+				},
+			},
+		}
+	}
+	configFilePath := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(
+		t,
+		os.WriteFile(
+			configFilePath,
+			[]byte("alias.st = \"status --short 'a b'\"\nalias.status = \"shadowed\"\n"),
+			0600,
+		),
+	)
+	require.NoError(
+		t,
+		Run(
+			context.Background(),
+			app.NewContainer(nil, nil, nil, nil, "test", "st", "c"),
+			newRootCommand(),
+			RunWithAliasConfigFile(
+				func(app.EnvContainer) (string, error) {
+					return configFilePath, nil
+				},
+			),
+		),
+	)
+	assert.True(t, short)
+	assert.Equal(t, []string{"a b", "c"}, actualArgs)
+
+	short = false
+	require.NoError(
+		t,
+		Run(
+			context.Background(),
+			app.NewContainer(nil, nil, nil, nil, "test", "status"),
+			newRootCommand(),
+			RunWithAliasConfigFile(
+				func(app.EnvContainer) (string, error) {
+					return configFilePath, nil
+				},
+			),
+		),
+	)
+	assert.False(t, short)
+	assert.Empty(t, actualArgs)
+
+	require.NoError(
+		t,
+		Run(
+			context.Background(),
+			app.NewContainer(nil, nil, nil, nil, "test", "s"),
+			newRootCommand(),
+			RunWithAliases(map[string]string{"s": "status"}),
+		),
+	)
+}
+
+func TestSplitAliasExpansion(t *testing.T) {
+	t.Parallel()
+	args, err := splitAliasExpansion(`status --short "a b" 'c "d"' e\ f`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"status", "--short", "a b", `c "d"`, "e f"}, args)
+	_, err = splitAliasExpansion(`status "a`)
+	require.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package appcmd
+
+import (
+	"fmt"
+	"github.com/aesoper101/x/stringutil"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sort"
+	"strings"
+)
+
+// suggestionsMinimumDistance is the maximum Levenshtein distance for which a
+// candidate is still suggested.
+const suggestionsMinimumDistance = 2
+
+// suggestionsFor returns the candidates that are close to typed, either by
+// Levenshtein distance or by prefix.
+//
+// The result is sorted and deduplicated.
+func suggestionsFor(typed string, candidates []string) []string {
+	if typed == "" {
+		return nil
+	}
+	lowerTyped := strings.ToLower(typed)
+	seen := make(map[string]struct{})
+	var suggestions []string
+	for _, candidate := range candidates {
+		if candidate == "" || candidate == typed {
+			continue
+		}
+		if _, ok := seen[candidate]; ok {
+			continue
+		}
+		lowerCandidate := strings.ToLower(candidate)
+		if stringutil.Levenshtein(lowerTyped, lowerCandidate) <= suggestionsMinimumDistance ||
+			strings.HasPrefix(lowerCandidate, lowerTyped) {
+			seen[candidate] = struct{}{}
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	sort.Strings(suggestions)
+	return suggestions
+}
+
+// suggestionsString formats the suggestions to be appended to an error message.
+//
+// Returns the empty string if there are no suggestions.
+func suggestionsString(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	_, _ = builder.WriteString("\n\nDid you mean this?\n")
+	for _, suggestion := range suggestions {
+		_, _ = builder.WriteString("\t")
+		_, _ = builder.WriteString(suggestion)
+		_, _ = builder.WriteString("\n")
+	}
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+// subCommandSuggestions returns the visible sub-commands of cmd that are close to typed.
+//
+// Aliases are matched as well, but the sub-command name is what is suggested.
+func subCommandSuggestions(cmd *cobra.Command, typed string) []string {
+	var suggestions []string
+	for _, child := range cmd.Commands() {
+		if !child.IsAvailableCommand() {
+			continue
+		}
+		if len(suggestionsFor(typed, append([]string{child.Name()}, child.Aliases...))) > 0 {
+			suggestions = append(suggestions, child.Name())
+		}
+	}
+	sort.Strings(suggestions)
+	return suggestions
+}
+
+// newUnknownSubCommandError returns the error for an unknown sub-command of cmd.
+func newUnknownSubCommandError(cmd *cobra.Command, args []string) error {
+	return fmt.Errorf(
+		"Unknown sub-command: %s%s",
+		strings.Join(args, " "),
+		suggestionsString(subCommandSuggestions(cmd, args[0])),
+	)
+}
+
+// flagErrorFunc adds flag suggestions to unknown flag errors.
+//
+// This is set on the root command, and cobra uses it for all sub-commands.
+func flagErrorFunc(cmd *cobra.Command, err error) error {
+	name, ok := strings.CutPrefix(err.Error(), "unknown flag: --")
+	if !ok || name == "" {
+		return err
+	}
+	var candidates []string
+	visit := func(flag *pflag.Flag) {
+		if !flag.Hidden {
+			candidates = append(candidates, flag.Name)
+		}
+	}
+	cmd.Flags().VisitAll(visit)
+	cmd.InheritedFlags().VisitAll(visit)
+	suggestions := suggestionsFor(name, candidates)
+	if len(suggestions) == 0 {
+		return err
+	}
+	for i, suggestion := range suggestions {
+		suggestions[i] = "--" + suggestion
+	}
+	return fmt.Errorf("%w%s", err, suggestionsString(suggestions))
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"github.com/aesoper101/x/app"
 	"github.com/aesoper101/x/configext"
+	"github.com/aesoper101/x/execext/command"
 	"github.com/aesoper101/x/internal/verbose"
 	"github.com/spf13/pflag"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"os"
 	"path/filepath"
 	"time"
 )
@@ -90,6 +92,51 @@ func NewVerboseContainer(verbosePrinter verbose.Printer) VerboseContainer {
 	return newVerboseContainer(verbosePrinter)
 }
 
+// RunnerContainer provides a command.Runner.
+type RunnerContainer interface {
+	// Runner returns a command.Runner to run external commands with.
+	//
+	// The Runner is sized to thread.Parallelism() at the time the container is
+	// created, which is the value of --parallelism if BuilderWithParallelism is used.
+	Runner() command.Runner
+}
+
+// NewRunnerContainer returns a new RunnerContainer.
+func NewRunnerContainer(runner command.Runner) RunnerContainer {
+	return newRunnerContainer(runner)
+}
+
+// ConfigContainer provides a *configext.Provider.
+type ConfigContainer interface {
+	// Config returns the validated config.
+	//
+	// Returns nil if BuilderWithConfig was not used.
+	Config() *configext.Provider
+}
+
+// NewConfigContainer returns a new ConfigContainer.
+func NewConfigContainer(provider *configext.Provider) ConfigContainer {
+	return newConfigContainer(provider)
+}
+
+// CredentialsContainer provides the authentication token.
+type CredentialsContainer interface {
+	// Token returns the token for the host of the Credentials.
+	//
+	// First checks $APP_NAME_TOKEN.
+	// If this is not set, uses the stored token.
+	// Returns the empty string if not logged in, or if BuilderWithCredentials was not used.
+	Token(ctx context.Context) (string, error)
+}
+
+// NewCredentialsContainer returns a new CredentialsContainer that reads the token
+// of the Credentials with the Container.
+//
+// The Credentials may be nil, in which case there is no token.
+func NewCredentialsContainer(credentials Credentials, container Container) CredentialsContainer {
+	return newCredentialsContainer(credentials, container)
+}
+
 // Container contains not just the base app container, but all extended containers.
 type Container interface {
 	app.Container
@@ -97,6 +144,9 @@ type Container interface {
 	LoggerContainer
 	TracerContainer
 	VerboseContainer
+	RunnerContainer
+	ConfigContainer
+	CredentialsContainer
 }
 
 // NewContainer returns a new Container.
@@ -111,6 +161,8 @@ func NewContainer(
 		appName,
 		logger,
 		verbosePrinter,
+		nil,
+		nil,
 	)
 }
 
@@ -143,13 +195,56 @@ func BuilderWithTimeout(defaultTimeout time.Duration) BuilderOption {
 	}
 }
 
-// BuilderWithTracing enables zap tracing for the builder.
+// BuilderWithParallelism returns a new BuilderOption that adds a parallelism flag and the default parallelism.
+//
+// The flag value is applied with thread.SetParallelism before the run function is
+// called, and the command.Runner on the Container is sized accordingly. Use
+// thread.Parallelism() as the default to default to the number of CPUs.
+func BuilderWithParallelism(defaultParallelism int) BuilderOption {
+	return func(builder *builder) {
+		builder.defaultParallelism = defaultParallelism
+	}
+}
+
+// BuilderWithConfig returns a new BuilderOption that loads and validates config
+// against the given JSON schema, and provides it on the Container.
+//
+// This adds a --config flag. If the flag is not set, the first existing file of
+// $APP_NAME_CONFIG, ./.app-name.yaml, and ConfigDirPath()/config.{yaml,toml,json}
+// is loaded. Flags bound on the root flag set that match a schema path, and
+// environment variables prefixed with APP_NAME_, override the file values.
+// Config files are watched for changes for the duration of the run.
+func BuilderWithConfig(schema []byte, options ...configext.OptionModifier) BuilderOption {
+	return func(builder *builder) {
+		builder.configSchema = schema
+		builder.configOptions = append(builder.configOptions, options...)
+	}
+}
+
+// BuilderWithTracing enables tracing for the builder.
+//
+// This adds the --trace-exporter flag, which selects where spans are exported to:
+// zap debug logs (the default), a file of JSON lines given by --trace-file, an OTLP/HTTP
+// collector given by --trace-endpoint, or pretty-printed to stdout. Sampling is set with
+// --trace-sample-ratio, and additional resource attributes with --trace-resource-attribute.
+// Each flag falls back to an environment variable if not set, which is named in the
+// flag help: $APP_NAME_TRACE_EXPORTER, $APP_NAME_TRACE_FILE, $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+// or $OTEL_EXPORTER_OTLP_ENDPOINT, $APP_NAME_TRACE_SAMPLE_RATIO, and $OTEL_RESOURCE_ATTRIBUTES.
 func BuilderWithTracing() BuilderOption {
 	return func(builder *builder) {
 		builder.tracing = true
 	}
 }
 
+// BuilderWithVersion returns a new BuilderOption that sets the version of the application.
+//
+// The version is used as the service version for tracing.
+func BuilderWithVersion(version string) BuilderOption {
+	return func(builder *builder) {
+		builder.version = version
+	}
+}
+
 // BuilderWithInterceptor adds the given interceptor for all run functions.
 func BuilderWithInterceptor(interceptor Interceptor) BuilderOption {
 	return func(builder *builder) {
@@ -164,16 +259,46 @@ func BuilderWithDefaultLogLevel(defaultLogLevel zapcore.Level) BuilderOption {
 	}
 }
 
+// ReadConfig reads the config for the named application into value.
+//
+// The config file is discovered the same way as with BuilderWithConfig, except
+// that there is no --config flag, and $APP_NAME_CONFIG is only checked if the
+// container is also an app.EnvContainer.
 func ReadConfig(ctx context.Context, container NameContainer, schema []byte, value interface{}) error {
-	configFilePath := filepath.Clean(container.ConfigDirPath())
-	provider, err := configext.New(
-		ctx,
-		schema,
-		configext.WithConfigFiles(configFilePath),
-	)
+	envContainer, _ := container.(app.EnvContainer)
+	var options []configext.OptionModifier
+	if configFilePath := findConfigFilePath(envContainer, container); configFilePath != "" {
+		options = append(options, configext.WithConfigFiles(configFilePath))
+	}
+	provider, err := configext.New(ctx, schema, options...)
 	if err != nil {
 		return err
 	}
 
 	return provider.Unmarshal("", value)
 }
+
+// AliasConfigFilePath returns a function to be used with appcmd.RunWithAliasConfigFile
+// that resolves the config file within the config directory of the named application.
+//
+// The first existing file of config.toml, config.yaml, config.yml, and config.json
+// is used. If none exist, the empty string is returned and no aliases are read.
+func AliasConfigFilePath(appName string) func(app.EnvContainer) (string, error) {
+	return func(envContainer app.EnvContainer) (string, error) {
+		nameContainer, err := newNameContainer(envContainer, appName)
+		if err != nil {
+			return "", err
+		}
+		configDirPath := nameContainer.ConfigDirPath()
+		if configDirPath == "" {
+			return "", nil
+		}
+		for _, fileName := range []string{"config.toml", "config.yaml", "config.yml", "config.json"} {
+			filePath := filepath.Join(configDirPath, fileName)
+			if fileInfo, err := os.Stat(filePath); err == nil && !fileInfo.IsDir() {
+				return filePath, nil
+			}
+		}
+		return "", nil
+	}
+}
@@ -2,10 +2,12 @@ package appext
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/configext"
 	"github.com/aesoper101/x/internal/verbose"
-	"github.com/aesoper101/x/observabilityzap"
+	"github.com/aesoper101/x/runtimeext/thread"
 	"github.com/aesoper101/x/zaputil"
 	"github.com/pkg/profile"
 	"github.com/spf13/pflag"
@@ -13,7 +15,11 @@ import (
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"net"
+	"net/http"
+	"net/http/pprof"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -30,14 +36,29 @@ type builder struct {
 	profileLoops      int
 	profileType       string
 	profileAllowError bool
+	profileHTTP       string
 
 	parallelism int
 
+	defaultParallelism int
+
 	timeout time.Duration
 
 	defaultTimeout time.Duration
 
-	tracing bool
+	tracing      bool
+	tracingFlags tracingFlags
+
+	version string
+	updater Updater
+	// updateCheckWait is how long to wait for the update check after the command is done.
+	updateCheckWait time.Duration
+
+	credentials Credentials
+
+	flagSet       *pflag.FlagSet
+	configSchema  []byte
+	configOptions []configext.OptionModifier
 
 	// 0 is InfoLevel in zap
 	defaultLogLevel zapcore.Level
@@ -48,6 +69,7 @@ func newBuilder(appName string, options ...BuilderOption) *builder {
 	builder := &builder{
 		appName:         appName,
 		defaultLogLevel: zapcore.InfoLevel,
+		updateCheckWait: defaultUpdateCheckWait,
 	}
 	for _, option := range options {
 		option(builder)
@@ -56,8 +78,12 @@ func newBuilder(appName string, options ...BuilderOption) *builder {
 }
 
 func (b *builder) BindRoot(flagSet *pflag.FlagSet) {
+	b.flagSet = flagSet
+	if b.configSchema != nil {
+		bindConfigFlag(flagSet)
+	}
 	flagSet.BoolVarP(&b.verbose, "verbose", "v", false, "Turn on verbose mode")
-	flagSet.BoolVar(&b.debug, "debug", false, "Turn on debug logging")
+	flagSet.BoolVar(&b.debug, "debug", false, "Turn on debug logging, and print the full cause chain of errors")
 	flagSet.StringVar(&b.logFormat, "log-format", "color", "The log format [text,json]")
 	if b.defaultTimeout > 0 {
 		flagSet.DurationVar(
@@ -67,6 +93,17 @@ func (b *builder) BindRoot(flagSet *pflag.FlagSet) {
 			`The duration until timing out, setting it to zero means no timeout`,
 		)
 	}
+	if b.defaultParallelism > 0 {
+		flagSet.IntVar(
+			&b.parallelism,
+			"parallelism",
+			b.defaultParallelism,
+			`The maximum number of jobs and external commands to run concurrently`,
+		)
+	}
+	if b.tracing {
+		b.tracingFlags.Bind(flagSet, getAppNameEnvPrefix(b.appName))
+	}
 
 	flagSet.BoolVar(&b.profile, "profile", false, "Run profiling")
 	_ = flagSet.MarkHidden("profile")
@@ -74,10 +111,17 @@ func (b *builder) BindRoot(flagSet *pflag.FlagSet) {
 	_ = flagSet.MarkHidden("profile-path")
 	flagSet.IntVar(&b.profileLoops, "profile-loops", 1, "The number of loops to run")
 	_ = flagSet.MarkHidden("profile-loops")
-	flagSet.StringVar(&b.profileType, "profile-type", "cpu", "The profile type [cpu,mem,block,mutex]")
+	flagSet.StringVar(
+		&b.profileType,
+		"profile-type",
+		"cpu",
+		"The profile type [cpu,mem,allocs,block,mutex,goroutine,trace,clock]",
+	)
 	_ = flagSet.MarkHidden("profile-type")
 	flagSet.BoolVar(&b.profileAllowError, "profile-allow-error", false, "Allow errors for profiled commands")
 	_ = flagSet.MarkHidden("profile-allow-error")
+	flagSet.StringVar(&b.profileHTTP, "profile-http", "", "Serve live pprof on the address while running, such as :6060")
+	_ = flagSet.MarkHidden("profile-http")
 
 	// We do not officially support this flag, this is for testing, where we need warnings turned off.
 	flagSet.BoolVar(&b.noWarn, "no-warn", false, "Turn off warn logging")
@@ -101,6 +145,11 @@ func (b *builder) run(
 	appContainer app.Container,
 	f func(context.Context, Container) error,
 ) (retErr error) {
+	if b.debug {
+		defer func() {
+			retErr = app.WrapDebugError(retErr)
+		}()
+	}
 	logLevel, err := getLogLevel(b.defaultLogLevel, b.debug, b.noWarn)
 	if err != nil {
 		return err
@@ -113,8 +162,27 @@ func (b *builder) run(
 		retErr = multierr.Append(retErr, logger.Sync())
 	}()
 
+	if b.defaultParallelism > 0 {
+		if b.parallelism < 1 {
+			return fmt.Errorf("--parallelism must be at least 1, got %d", b.parallelism)
+		}
+		thread.SetParallelism(b.parallelism)
+	}
+
+	var provider *configext.Provider
+	if b.configSchema != nil {
+		// Stops the config file watchers when the run is done.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		provider, err = b.newConfigProvider(ctx, appContainer, logger)
+		if err != nil {
+			return fmt.Errorf("could not load config: %w", err)
+		}
+	}
+
 	verbosePrinter := verbose.NewPrinterForFlagValue(appContainer.Stderr(), b.appName, b.verbose)
-	container, err := newContainer(appContainer, b.appName, logger, verbosePrinter)
+	container, err := newContainer(appContainer, b.appName, logger, verbosePrinter, provider, b.credentials)
 	if err != nil {
 		return err
 	}
@@ -126,7 +194,10 @@ func (b *builder) run(
 	}
 
 	if b.tracing {
-		tracerProvider, closer := observabilityzap.Start(logger)
+		tracerProvider, closer, err := b.startTracing(ctx, appContainer, logger)
+		if err != nil {
+			return err
+		}
 		defer func() {
 			retErr = multierr.Append(retErr, closer.Close())
 		}()
@@ -135,6 +206,23 @@ func (b *builder) run(
 		defer span.End()
 	}
 
+	if b.updater != nil {
+		defer b.startUpdateCheck(ctx, container)()
+	}
+
+	if b.profileHTTP != "" {
+		runFunc := f
+		f = func(ctx context.Context, container Container) error {
+			return runProfileHTTP(
+				logger,
+				b.profileHTTP,
+				func() error {
+					return runFunc(ctx, container)
+				},
+			)
+		}
+	}
+
 	if !b.profile {
 		return f(ctx, container)
 	}
@@ -165,31 +253,63 @@ func runProfile(
 			return err
 		}
 	}
-	logger.Debug("profile", zap.String("path", profilePath))
 	if profileType == "" {
 		profileType = "cpu"
 	}
 	if profileLoops == 0 {
 		profileLoops = 10
 	}
-	var profileFunc func(*profile.Profile)
+	var profileFuncs []func(*profile.Profile)
+	var profileFileName string
 	switch profileType {
 	case "cpu":
-		profileFunc = profile.CPUProfile
+		profileFuncs = []func(*profile.Profile){profile.CPUProfile}
+		profileFileName = "cpu.pprof"
 	case "mem":
-		profileFunc = profile.MemProfile
+		profileFuncs = []func(*profile.Profile){profile.MemProfile}
+		profileFileName = "mem.pprof"
+	case "allocs":
+		profileFuncs = []func(*profile.Profile){profile.MemProfile, profile.MemProfileAllocs}
+		profileFileName = "mem.pprof"
 	case "block":
-		profileFunc = profile.BlockProfile
+		profileFuncs = []func(*profile.Profile){profile.BlockProfile}
+		profileFileName = "block.pprof"
 	case "mutex":
-		profileFunc = profile.MutexProfile
+		profileFuncs = []func(*profile.Profile){profile.MutexProfile}
+		profileFileName = "mutex.pprof"
+	case "goroutine":
+		profileFuncs = []func(*profile.Profile){profile.GoroutineProfile}
+		profileFileName = "goroutine.pprof"
+	case "trace":
+		profileFuncs = []func(*profile.Profile){profile.TraceProfile}
+		profileFileName = "trace.out"
+	case "clock":
+		// Wall-clock profiling with fgprof, which includes time spent off-CPU.
+		profileFuncs = []func(*profile.Profile){profile.ClockProfile}
+		profileFileName = "clock.pprof"
 	default:
 		return fmt.Errorf("unknown profile type: %q", profileType)
 	}
 	stop := profile.Start(
-		profile.Quiet,
-		profile.ProfilePath(profilePath),
-		profileFunc,
+		append(
+			[]func(*profile.Profile){
+				profile.Quiet,
+				profile.ProfilePath(profilePath),
+			},
+			profileFuncs...,
+		)...,
 	)
+	start := time.Now()
+	defer func() {
+		stop.Stop()
+		logger.Info(
+			"profile",
+			zap.String("type", profileType),
+			zap.String("path", filepath.Join(profilePath, profileFileName)),
+			zap.Int("loops", profileLoops),
+			zap.Duration("duration", time.Since(start)),
+		)
+	}()
 	for i := 0; i < profileLoops; i++ {
 		if err := f(); err != nil {
 			if !profileAllowError {
@@ -197,10 +317,43 @@ func runProfile(
 			}
 		}
 	}
-	stop.Stop()
 	return nil
 }
 
+// runProfileHTTP serves live pprof on the address while running f.
+func runProfileHTTP(
+	logger *zap.Logger,
+	address string,
+	f func() error,
+) (retErr error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("could not listen on --profile-http address %q: %w", address, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serveErrC := make(chan error, 1)
+	go func() {
+		serveErrC <- server.Serve(listener)
+	}()
+	logger.Info("profile", zap.String("url", "http://"+listener.Addr().String()+"/debug/pprof/"))
+	defer func() {
+		retErr = multierr.Append(retErr, server.Close())
+		if err := <-serveErrC; !errors.Is(err, http.ErrServerClosed) {
+			retErr = multierr.Append(retErr, err)
+		}
+	}()
+	return f()
+}
+
 func getLogLevel(defaultLogLevel zapcore.Level, debugFlag bool, noWarnFlag bool) (string, error) {
 	if debugFlag && noWarnFlag {
 		return "", fmt.Errorf("cannot set both --debug and --no-warn")
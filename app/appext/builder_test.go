@@ -0,0 +1,139 @@
+package appext
+
+import (
+	"context"
+	"github.com/aesoper101/x/app/appcmd"
+	"github.com/aesoper101/x/app/apptest"
+	"github.com/aesoper101/x/runtimeext/thread"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunProfile(t *testing.T) {
+	// pkg/profile only allows one profile at a time, so this does not run in parallel.
+	core, logs := observer.New(zap.InfoLevel)
+	profilePath := t.TempDir()
+	loops := 0
+	err := runProfile(
+		zap.New(core),
+		profilePath,
+		"goroutine",
+		2,
+		false,
+		func() error {
+			loops++
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loops)
+	assert.FileExists(t, filepath.Join(profilePath, "goroutine.pprof"))
+	entries := logs.FilterMessage("profile").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, filepath.Join(profilePath, "goroutine.pprof"), entries[0].ContextMap()["path"])
+
+	err = runProfile(zap.NewNop(), profilePath, "heap", 1, false, func() error { return nil })
+	assert.EqualError(t, err, `unknown profile type: "heap"`)
+}
+
+func TestRunProfileHTTP(t *testing.T) {
+	t.Parallel()
+	core, logs := observer.New(zap.InfoLevel)
+	err := runProfileHTTP(
+		zap.New(core),
+		"127.0.0.1:0",
+		func() error {
+			entries := logs.FilterMessage("profile").All()
+			require.Len(t, entries, 1)
+			url, ok := entries[0].ContextMap()["url"].(string)
+			require.True(t, ok)
+			response, err := http.Get(url + "goroutine?debug=1")
+			if err != nil {
+				return err
+			}
+			defer response.Body.Close()
+			data, err := io.ReadAll(response.Body)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Contains(t, string(data), "goroutine profile")
+			return nil
+		},
+	)
+	require.NoError(t, err)
+}
+
+// The parallelism tests set the global parallelism, so they do not run in parallel.
+func TestBuilderParallelism(t *testing.T) {
+	defer thread.SetParallelism(thread.Parallelism())
+	var parallelism int
+	var runnerContainer RunnerContainer
+	command := newTestParallelismCommand(
+		func(ctx context.Context, container Container) error {
+			parallelism = thread.Parallelism()
+			runnerContainer = container
+			return nil
+		},
+		BuilderWithParallelism(4),
+	)
+	result := apptest.Run(t, command)
+	require.NoError(t, result.Err)
+	assert.Equal(t, 4, parallelism)
+	require.NotNil(t, runnerContainer)
+	assert.NotNil(t, runnerContainer.Runner())
+
+	result = apptest.Run(t, command, apptest.RunWithArgs("--parallelism", "2"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, 2, parallelism)
+
+	parallelism = 0
+	for _, value := range []string{"0", "-1"} {
+		result = apptest.Run(t, command, apptest.RunWithArgs("--parallelism", value))
+		assert.EqualError(t, result.Err, "--parallelism must be at least 1, got "+value)
+	}
+	// The run function is not called if the parallelism is invalid.
+	assert.Equal(t, 0, parallelism)
+}
+
+func TestBuilderWithoutParallelism(t *testing.T) {
+	defer thread.SetParallelism(thread.Parallelism())
+	thread.SetParallelism(3)
+	var parallelism int
+	var runnerContainer RunnerContainer
+	command := newTestParallelismCommand(
+		func(ctx context.Context, container Container) error {
+			parallelism = thread.Parallelism()
+			runnerContainer = container
+			return nil
+		},
+	)
+	result := apptest.Run(t, command)
+	require.NoError(t, result.Err)
+	// The parallelism is left as is without the flag.
+	assert.Equal(t, 3, parallelism)
+	require.NotNil(t, runnerContainer)
+	assert.NotNil(t, runnerContainer.Runner())
+
+	result = apptest.Run(t, command, apptest.RunWithArgs("--parallelism", "2"))
+	assert.Error(t, result.Err)
+	assert.Equal(t, 3, thread.Parallelism())
+}
+
+func newTestParallelismCommand(
+	f func(context.Context, Container) error,
+	options ...BuilderOption,
+) *appcmd.Command {
+	builder := NewBuilder("test", options...)
+	return &appcmd.Command{
+		Use:       "test",
+		BindFlags: builder.BindRoot,
+		Run:       builder.NewRunFunc(f),
+	}
+}
@@ -0,0 +1,96 @@
+package appext
+
+import (
+	"context"
+	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/configext"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+)
+
+// configFileExtensions are the extensions searched for within ConfigDirPath, in order.
+var configFileExtensions = []string{".yaml", ".toml", ".json"}
+
+type configContainer struct {
+	provider *configext.Provider
+}
+
+func newConfigContainer(provider *configext.Provider) *configContainer {
+	return &configContainer{
+		provider: provider,
+	}
+}
+
+func (c *configContainer) Config() *configext.Provider {
+	return c.provider
+}
+
+func (b *builder) newConfigProvider(
+	ctx context.Context,
+	envContainer app.EnvContainer,
+	logger *zap.Logger,
+) (*configext.Provider, error) {
+	nameContainer, err := newNameContainer(envContainer, b.appName)
+	if err != nil {
+		return nil, err
+	}
+	options := []configext.OptionModifier{
+		configext.WithLogger(logger),
+		configext.WithLoggerWatcher(logger),
+		configext.WithEnvPrefix(getAppNameEnvPrefix(b.appName)),
+	}
+	if b.flagSet != nil {
+		// The provider reads the --config flag itself, and maps the remaining
+		// flags that match the schema onto the config.
+		options = append(options, configext.WithFlags(b.flagSet))
+	}
+	if !b.configFlagSet() {
+		if configFilePath := findConfigFilePath(envContainer, nameContainer); configFilePath != "" {
+			logger.Debug("config", zap.String("path", configFilePath))
+			options = append(options, configext.WithConfigFiles(configFilePath))
+		}
+	}
+	options = append(options, b.configOptions...)
+	return configext.New(ctx, b.configSchema, options...)
+}
+
+func (b *builder) configFlagSet() bool {
+	if b.flagSet == nil {
+		return false
+	}
+	configFlag := b.flagSet.Lookup(configext.FlagConfig)
+	return configFlag != nil && configFlag.Changed
+}
+
+func bindConfigFlag(flagSet *pflag.FlagSet) {
+	if flagSet.Lookup(configext.FlagConfig) == nil {
+		configext.RegisterConfigFlag(flagSet, nil)
+	}
+}
+
+// findConfigFilePath returns the first config file path that exists, in the order
+// $APP_NAME_CONFIG, ./.app-name.yaml, and ConfigDirPath()/config.{yaml,toml,json}.
+//
+// Returns the empty string if none exist.
+func findConfigFilePath(envContainer app.EnvContainer, nameContainer NameContainer) string {
+	if envContainer != nil {
+		if configFilePath := envContainer.Env(getAppNameEnvPrefix(nameContainer.AppName()) + "CONFIG"); configFilePath != "" {
+			// This is explicitly set, and configext will error if it does not exist.
+			return configFilePath
+		}
+	}
+	candidates := []string{"." + nameContainer.AppName() + ".yaml"}
+	if configDirPath := nameContainer.ConfigDirPath(); configDirPath != "" {
+		for _, ext := range configFileExtensions {
+			candidates = append(candidates, filepath.Join(configDirPath, "config"+ext))
+		}
+	}
+	for _, candidate := range candidates {
+		if fileInfo, err := os.Stat(candidate); err == nil && !fileInfo.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package appext
+
+import (
+	"context"
+	"github.com/aesoper101/x/app/appcmd"
+	"github.com/aesoper101/x/app/apptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfigSchema = `{
+	"$id": "https://example.com/test.schema.json",
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"properties": {
+		"source": {"type": "string"}
+	}
+}`
+
+// The config tests change the working directory, so they do not run in parallel.
+func TestBuilderConfigDiscovery(t *testing.T) {
+	workDirPath := t.TempDir()
+	testChdir(t, workDirPath)
+	configDirPath := t.TempDir()
+	env := map[string]string{"TEST_CONFIG_DIR": configDirPath}
+	var source string
+	command := newTestConfigCommand(&source)
+
+	result := apptest.Run(t, command, apptest.RunWithEnv(env))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "none", source)
+
+	// The config dir is searched in the order yaml, toml, json.
+	testWriteFile(t, filepath.Join(configDirPath, "config.json"), `{"source": "config dir json"}`)
+	result = apptest.Run(t, command, apptest.RunWithEnv(env))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "config dir json", source)
+	testWriteFile(t, filepath.Join(configDirPath, "config.toml"), `source = "config dir toml"`)
+	result = apptest.Run(t, command, apptest.RunWithEnv(env))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "config dir toml", source)
+	testWriteFile(t, filepath.Join(configDirPath, "config.yaml"), `source: config dir yaml`)
+	result = apptest.Run(t, command, apptest.RunWithEnv(env))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "config dir yaml", source)
+
+	testWriteFile(t, filepath.Join(workDirPath, ".test.yaml"), `source: work dir`)
+	result = apptest.Run(t, command, apptest.RunWithEnv(env))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "work dir", source)
+
+	envConfigFilePath := filepath.Join(t.TempDir(), "env.yaml")
+	testWriteFile(t, envConfigFilePath, `source: env`)
+	env["TEST_CONFIG"] = envConfigFilePath
+	result = apptest.Run(t, command, apptest.RunWithEnv(env))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "env", source)
+
+	flagConfigFilePath := filepath.Join(t.TempDir(), "flag.yaml")
+	testWriteFile(t, flagConfigFilePath, `source: flag`)
+	result = apptest.Run(t, command, apptest.RunWithEnv(env), apptest.RunWithArgs("--config", flagConfigFilePath))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "flag", source)
+}
+
+func TestBuilderConfigMissingFile(t *testing.T) {
+	testChdir(t, t.TempDir())
+	var source string
+	command := newTestConfigCommand(&source)
+	missingFilePath := filepath.Join(t.TempDir(), "missing.yaml")
+
+	// An explicitly set config file must exist, even if another file would be found.
+	testWriteFile(t, ".test.yaml", `source: work dir`)
+	result := apptest.Run(t, command, apptest.RunWithArgs("--config", missingFilePath))
+	assert.ErrorContains(t, result.Err, "could not load config")
+	result = apptest.Run(t, command, apptest.RunWithEnv(map[string]string{"TEST_CONFIG": missingFilePath}))
+	assert.ErrorContains(t, result.Err, "could not load config")
+	assert.Empty(t, source)
+}
+
+func newTestConfigCommand(source *string) *appcmd.Command {
+	builder := NewBuilder("test", BuilderWithConfig([]byte(testConfigSchema)))
+	return &appcmd.Command{
+		Use:       "test",
+		BindFlags: builder.BindRoot,
+		Run: builder.NewRunFunc(
+			func(ctx context.Context, container Container) error {
+				*source = container.Config().StringF("source", "none")
+				return nil
+			},
+		),
+	}
+}
+
+func testChdir(t *testing.T, dirPath string) {
+	workDirPath, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dirPath))
+	t.Cleanup(
+		func() {
+			require.NoError(t, os.Chdir(workDirPath))
+		},
+	)
+}
+
+func testWriteFile(t *testing.T, filePath string, data string) {
+	require.NoError(t, os.WriteFile(filePath, []byte(data), 0o600))
+}
@@ -2,6 +2,8 @@ package appext
 
 import (
 	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/configext"
+	"github.com/aesoper101/x/execext/command"
 	"github.com/aesoper101/x/internal/verbose"
 	"go.uber.org/zap"
 )
@@ -12,6 +14,9 @@ type container struct {
 	LoggerContainer
 	TracerContainer
 	VerboseContainer
+	RunnerContainer
+	ConfigContainer
+	CredentialsContainer
 }
 
 func newContainer(
@@ -19,16 +24,23 @@ func newContainer(
 	appName string,
 	logger *zap.Logger,
 	verbosePrinter verbose.Printer,
+	provider *configext.Provider,
+	credentials Credentials,
 ) (*container, error) {
 	nameContainer, err := newNameContainer(baseContainer, appName)
 	if err != nil {
 		return nil, err
 	}
-	return &container{
+	container := &container{
 		Container:        baseContainer,
 		NameContainer:    nameContainer,
 		LoggerContainer:  newLoggerContainer(logger),
 		TracerContainer:  newTracerContainer(appName),
 		VerboseContainer: newVerboseContainer(verbosePrinter),
-	}, nil
+		RunnerContainer:  newRunnerContainer(command.NewRunner()),
+		ConfigContainer:  newConfigContainer(provider),
+	}
+	// The token is read through the container itself, for the env and directories.
+	container.CredentialsContainer = newCredentialsContainer(credentials, container)
+	return container, nil
 }
@@ -0,0 +1,382 @@
+package appext
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aesoper101/x/app/appcmd"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/aesoper101/x/netrc"
+	jose "github.com/go-jose/go-jose/v4"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// defaultCredentialLogin is the login recorded for a token if there is no TokenValidator.
+	defaultCredentialLogin = "token"
+	// credentialsStateStoreName is the name of the StateStore for encrypted credentials.
+	credentialsStateStoreName = "credentials"
+	// credentialsReasonNotLoggedIn is the errorsext reason for missing credentials.
+	credentialsReasonNotLoggedIn = "NOT_LOGGED_IN"
+)
+
+// Credential is a stored login for a host.
+type Credential struct {
+	// Login is the user the token belongs to.
+	Login string `json:"login"`
+	// Token is the authentication token.
+	Token string `json:"token"`
+}
+
+// TokenValidator validates the token for the host, and returns the login it belongs to.
+type TokenValidator func(ctx context.Context, host string, token string) (string, error)
+
+// Credentials manages the login of an application to a single host.
+//
+// The token is read from $APP_NAME_TOKEN if set, and otherwise from the credential store,
+// which is the netrc file unless CredentialsWithEncryptionKey is used.
+type Credentials interface {
+	// Host is the host the credentials are for.
+	Host() string
+	// Token returns the token for the host.
+	//
+	// Returns the empty string if not logged in.
+	Token(ctx context.Context, container Container) (string, error)
+	// Login validates and stores the token, and returns the login it belongs to.
+	Login(ctx context.Context, container Container, token string) (string, error)
+	// Logout deletes the stored token.
+	//
+	// Returns false if there was no stored token.
+	Logout(ctx context.Context, container Container) (bool, error)
+	// Whoami returns the login for the current token.
+	//
+	// If there is a TokenValidator, the token is validated. Otherwise, this is the stored
+	// login, or empty if the token is from $APP_NAME_TOKEN.
+	// Returns an errorsext.Unauthenticated error if not logged in.
+	Whoami(ctx context.Context, container Container) (string, error)
+}
+
+// NewCredentials returns new Credentials for the host.
+func NewCredentials(host string, options ...CredentialsOption) Credentials {
+	return newCredentials(host, options...)
+}
+
+// CredentialsOption is an option for new Credentials.
+type CredentialsOption func(*credentials)
+
+// CredentialsWithValidator returns a new CredentialsOption that validates tokens on login
+// and whoami.
+//
+// The default is to accept all tokens.
+func CredentialsWithValidator(validator TokenValidator) CredentialsOption {
+	return func(credentials *credentials) {
+		credentials.validator = validator
+	}
+}
+
+// CredentialsWithEncryptionKey returns a new CredentialsOption that stores tokens in a file
+// under DataDirPath() encrypted with the key, instead of in the netrc file.
+//
+// The key must be 32 bytes, and is used with AES-256-GCM.
+func CredentialsWithEncryptionKey(getKey func(Container) ([]byte, error)) CredentialsOption {
+	return func(credentials *credentials) {
+		credentials.getEncryptionKey = getKey
+	}
+}
+
+// BuilderWithCredentials returns a new BuilderOption that makes the token of the credentials
+// available with Container.Token.
+func BuilderWithCredentials(credentials Credentials) BuilderOption {
+	return func(builder *builder) {
+		builder.credentials = credentials
+	}
+}
+
+// NewLoginCommand returns a new command that logs in to the host of the credentials.
+//
+// The token is prompted for if stdin is a terminal, and read from stdin otherwise.
+func NewLoginCommand(use string, builder SubCommandBuilder, credentials Credentials) *appcmd.Command {
+	return &appcmd.Command{
+		Use:   use,
+		Short: fmt.Sprintf("Log in to %s", credentials.Host()),
+		Args:  appcmd.NoArgs,
+		Run: builder.NewRunFunc(
+			func(ctx context.Context, container Container) error {
+				token, err := readToken(container)
+				if err != nil {
+					return err
+				}
+				login, err := credentials.Login(ctx, container, token)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(container.Stdout(), "Logged in to %s as %s\n", credentials.Host(), login)
+				return err
+			},
+		),
+	}
+}
+
+// NewLogoutCommand returns a new command that logs out of the host of the credentials.
+func NewLogoutCommand(use string, builder SubCommandBuilder, credentials Credentials) *appcmd.Command {
+	return &appcmd.Command{
+		Use:   use,
+		Short: fmt.Sprintf("Log out of %s", credentials.Host()),
+		Args:  appcmd.NoArgs,
+		Run: builder.NewRunFunc(
+			func(ctx context.Context, container Container) error {
+				deleted, err := credentials.Logout(ctx, container)
+				if err != nil {
+					return err
+				}
+				if !deleted {
+					_, err = fmt.Fprintf(container.Stdout(), "Not logged in to %s\n", credentials.Host())
+					return err
+				}
+				_, err = fmt.Fprintf(container.Stdout(), "Logged out of %s\n", credentials.Host())
+				return err
+			},
+		),
+	}
+}
+
+// NewWhoamiCommand returns a new command that prints the login for the host of the credentials.
+func NewWhoamiCommand(use string, builder SubCommandBuilder, credentials Credentials) *appcmd.Command {
+	return &appcmd.Command{
+		Use:   use,
+		Short: fmt.Sprintf("Print the login for %s", credentials.Host()),
+		Args:  appcmd.NoArgs,
+		Run: builder.NewRunFunc(
+			func(ctx context.Context, container Container) error {
+				login, err := credentials.Whoami(ctx, container)
+				if err != nil {
+					return err
+				}
+				if login == "" {
+					_, err = fmt.Fprintf(
+						container.Stdout(),
+						"Logged in to %s with $%sTOKEN\n",
+						credentials.Host(),
+						getAppNameEnvPrefix(container.AppName()),
+					)
+					return err
+				}
+				_, err = fmt.Fprintf(container.Stdout(), "Logged in to %s as %s\n", credentials.Host(), login)
+				return err
+			},
+		),
+	}
+}
+
+// *** PRIVATE ***
+
+type credentials struct {
+	host             string
+	validator        TokenValidator
+	getEncryptionKey func(Container) ([]byte, error)
+}
+
+func newCredentials(host string, options ...CredentialsOption) *credentials {
+	credentials := &credentials{
+		host: host,
+	}
+	for _, option := range options {
+		option(credentials)
+	}
+	return credentials
+}
+
+func (c *credentials) Host() string {
+	return c.host
+}
+
+func (c *credentials) Token(ctx context.Context, container Container) (string, error) {
+	if token := container.Env(getTokenEnvKey(container)); token != "" {
+		return token, nil
+	}
+	credential, err := c.get(ctx, container)
+	if err != nil || credential == nil {
+		return "", err
+	}
+	return credential.Token, nil
+}
+
+func (c *credentials) Login(ctx context.Context, container Container, token string) (string, error) {
+	if token == "" {
+		return "", errorsext.ThrowInvalidArgument(nil, "EMPTY_TOKEN", "token is required")
+	}
+	login := defaultCredentialLogin
+	if c.validator != nil {
+		validatedLogin, err := c.validator(ctx, c.host, token)
+		if err != nil {
+			return "", err
+		}
+		login = validatedLogin
+	}
+	if err := c.put(ctx, container, Credential{Login: login, Token: token}); err != nil {
+		return "", err
+	}
+	return login, nil
+}
+
+func (c *credentials) Logout(ctx context.Context, container Container) (bool, error) {
+	if c.getEncryptionKey == nil {
+		return netrc.DeleteMachineForName(container, c.host)
+	}
+	store, err := NewStateStore[string](container, credentialsStateStoreName)
+	if err != nil {
+		return false, err
+	}
+	_, ok, err := store.Get(ctx, c.host)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, store.Delete(ctx, c.host)
+}
+
+func (c *credentials) Whoami(ctx context.Context, container Container) (string, error) {
+	token := container.Env(getTokenEnvKey(container))
+	login := ""
+	if token == "" {
+		credential, err := c.get(ctx, container)
+		if err != nil {
+			return "", err
+		}
+		if credential == nil {
+			return "", errorsext.ThrowUnauthenticatedF(
+				nil,
+				credentialsReasonNotLoggedIn,
+				"not logged in to %s",
+				c.host,
+			)
+		}
+		token = credential.Token
+		login = credential.Login
+	}
+	if c.validator == nil {
+		return login, nil
+	}
+	return c.validator(ctx, c.host, token)
+}
+
+// get returns the stored credential, or nil if there is none.
+func (c *credentials) get(ctx context.Context, container Container) (*Credential, error) {
+	if c.getEncryptionKey == nil {
+		machine, err := netrc.GetMachineForName(container, c.host)
+		// The default machine is not for this host.
+		if err != nil || machine == nil || machine.Name() == "" {
+			return nil, err
+		}
+		return &Credential{
+			Login: machine.Login(),
+			Token: machine.Password(),
+		}, nil
+	}
+	key, err := c.getEncryptionKey(container)
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewStateStore[string](container, credentialsStateStoreName)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, ok, err := store.Get(ctx, c.host)
+	if err != nil || !ok {
+		return nil, err
+	}
+	jwe, err := jose.ParseEncrypted(encrypted, []jose.KeyAlgorithm{jose.DIRECT}, []jose.ContentEncryption{jose.A256GCM})
+	if err != nil {
+		return nil, err
+	}
+	data, err := jwe.Decrypt(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt credentials for %s: %w", c.host, err)
+	}
+	credential := &Credential{}
+	if err := json.Unmarshal(data, credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func (c *credentials) put(ctx context.Context, container Container, credential Credential) error {
+	if c.getEncryptionKey == nil {
+		return netrc.PutMachines(container, netrc.NewMachine(c.host, credential.Login, credential.Token))
+	}
+	key, err := c.getEncryptionKey(container)
+	if err != nil {
+		return err
+	}
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: key}, nil)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	jwe, err := encrypter.Encrypt(data)
+	if err != nil {
+		return err
+	}
+	encrypted, err := jwe.CompactSerialize()
+	if err != nil {
+		return err
+	}
+	store, err := NewStateStore[string](container, credentialsStateStoreName)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, c.host, encrypted)
+}
+
+type credentialsContainer struct {
+	credentials Credentials
+	container   Container
+}
+
+func newCredentialsContainer(credentials Credentials, container Container) *credentialsContainer {
+	return &credentialsContainer{
+		credentials: credentials,
+		container:   container,
+	}
+}
+
+func (c *credentialsContainer) Token(ctx context.Context) (string, error) {
+	if c.credentials == nil {
+		return "", nil
+	}
+	return c.credentials.Token(ctx, c.container)
+}
+
+// readToken prompts for the token if stdin is a terminal, and reads the first line of
+// stdin otherwise.
+func readToken(container Container) (string, error) {
+	if file, ok := container.Stdin().(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		if _, err := fmt.Fprint(container.Stderr(), "Token: "); err != nil {
+			return "", err
+		}
+		data, err := term.ReadPassword(int(file.Fd()))
+		if _, printErr := fmt.Fprintln(container.Stderr()); err == nil {
+			err = printErr
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	line, err := bufio.NewReader(container.Stdin()).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func getTokenEnvKey(container NameContainer) string {
+	return getAppNameEnvPrefix(container.AppName()) + "TOKEN"
+}
@@ -0,0 +1,198 @@
+package appext
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/app/appcmd"
+	"github.com/aesoper101/x/app/apptest"
+	"github.com/aesoper101/x/netrc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCredentialsNetrc(t *testing.T) {
+	t.Parallel()
+	homeDirPath := apptest.NewHomeDir(t)
+	command := newTestCredentialsCommand(NewCredentials("example.com", CredentialsWithValidator(testTokenValidator)))
+
+	result := apptest.Run(
+		t,
+		command,
+		apptest.RunWithHomeDirPath(homeDirPath),
+		apptest.RunWithArgs("login"),
+		apptest.RunWithStdin("invalid\n"),
+	)
+	assert.EqualError(t, result.Err, "invalid token")
+	result = apptest.Run(
+		t,
+		command,
+		apptest.RunWithHomeDirPath(homeDirPath),
+		apptest.RunWithArgs("login"),
+		apptest.RunWithStdin("secret\n"),
+	)
+	require.NoError(t, result.Err)
+	assert.Equal(t, "Logged in to example.com as foo\n", result.Stdout)
+	machine, err := netrc.GetMachineForNameAndFilePath("example.com", filepath.Join(homeDirPath, netrc.Filename))
+	require.NoError(t, err)
+	require.NotNil(t, machine)
+	assert.Equal(t, "foo", machine.Login())
+	assert.Equal(t, "secret", machine.Password())
+
+	result = apptest.Run(t, command, apptest.RunWithHomeDirPath(homeDirPath), apptest.RunWithArgs("whoami"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "Logged in to example.com as foo\n", result.Stdout)
+	result = apptest.Run(t, command, apptest.RunWithHomeDirPath(homeDirPath), apptest.RunWithArgs("token"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "secret\n", result.Stdout)
+
+	result = apptest.Run(t, command, apptest.RunWithHomeDirPath(homeDirPath), apptest.RunWithArgs("logout"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "Logged out of example.com\n", result.Stdout)
+	result = apptest.Run(t, command, apptest.RunWithHomeDirPath(homeDirPath), apptest.RunWithArgs("logout"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "Not logged in to example.com\n", result.Stdout)
+	result = apptest.Run(t, command, apptest.RunWithHomeDirPath(homeDirPath), apptest.RunWithArgs("whoami"))
+	assert.EqualError(t, result.Err, "reason=NOT_LOGGED_IN message=not logged in to example.com")
+	assert.Equal(t, app.ExitCodeNoUser, result.ExitCode)
+}
+
+func TestCredentialsEnvOverride(t *testing.T) {
+	t.Parallel()
+	command := newTestCredentialsCommand(NewCredentials("example.com"))
+	result := apptest.Run(
+		t,
+		command,
+		apptest.RunWithArgs("token"),
+		apptest.RunWithEnv(map[string]string{"TEST_TOKEN": "fromenv"}),
+	)
+	require.NoError(t, result.Err)
+	assert.Equal(t, "fromenv\n", result.Stdout)
+	result = apptest.Run(
+		t,
+		command,
+		apptest.RunWithArgs("whoami"),
+		apptest.RunWithEnv(map[string]string{"TEST_TOKEN": "fromenv"}),
+	)
+	require.NoError(t, result.Err)
+	assert.Equal(t, "Logged in to example.com with $TEST_TOKEN\n", result.Stdout)
+	result = apptest.Run(t, command, apptest.RunWithArgs("token"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "\n", result.Stdout)
+}
+
+func TestCredentialsEncrypted(t *testing.T) {
+	t.Parallel()
+	homeDirPath := apptest.NewHomeDir(t)
+	key := bytes.Repeat([]byte{1}, 32)
+	command := newTestCredentialsCommand(
+		NewCredentials(
+			"example.com",
+			CredentialsWithEncryptionKey(
+				func(Container) ([]byte, error) {
+					return key, nil
+				},
+			),
+		),
+	)
+	result := apptest.Run(
+		t,
+		command,
+		apptest.RunWithHomeDirPath(homeDirPath),
+		apptest.RunWithArgs("login"),
+		apptest.RunWithStdin("secret"),
+	)
+	require.NoError(t, result.Err)
+	assert.Equal(t, "Logged in to example.com as token\n", result.Stdout)
+	assert.NoFileExists(t, filepath.Join(homeDirPath, netrc.Filename))
+	data, err := os.ReadFile(filepath.Join(homeDirPath, ".local", "share", "test", "state", "credentials.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	result = apptest.Run(t, command, apptest.RunWithHomeDirPath(homeDirPath), apptest.RunWithArgs("token"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, "secret\n", result.Stdout)
+
+	key = bytes.Repeat([]byte{2}, 32)
+	result = apptest.Run(t, command, apptest.RunWithHomeDirPath(homeDirPath), apptest.RunWithArgs("token"))
+	assert.ErrorContains(t, result.Err, "could not decrypt credentials for example.com")
+}
+
+func TestCredentialsContext(t *testing.T) {
+	t.Parallel()
+	credentials := NewCredentials(
+		"example.com",
+		CredentialsWithEncryptionKey(
+			func(Container) ([]byte, error) {
+				return bytes.Repeat([]byte{1}, 32), nil
+			},
+		),
+	)
+	builder := NewBuilder("test", BuilderWithCredentials(credentials))
+	command := &appcmd.Command{
+		Use:       "test",
+		BindFlags: builder.BindRoot,
+		Run: builder.NewRunFunc(
+			func(ctx context.Context, container Container) error {
+				_, err := credentials.Login(ctx, container, "secret")
+				require.NoError(t, err)
+				credentialsContainer := NewCredentialsContainer(credentials, container)
+				token, err := credentialsContainer.Token(ctx)
+				require.NoError(t, err)
+				assert.Equal(t, "secret", token)
+				// The credential store is not read or written once the context is canceled.
+				canceledCtx, cancel := context.WithCancel(ctx)
+				cancel()
+				_, err = credentialsContainer.Token(canceledCtx)
+				assert.ErrorIs(t, err, context.Canceled)
+				_, err = credentials.Logout(canceledCtx, container)
+				assert.ErrorIs(t, err, context.Canceled)
+				deleted, err := credentials.Logout(ctx, container)
+				require.NoError(t, err)
+				assert.True(t, deleted)
+				token, err = NewCredentialsContainer(nil, container).Token(ctx)
+				require.NoError(t, err)
+				assert.Empty(t, token)
+				return nil
+			},
+		),
+	}
+	require.NoError(t, apptest.Run(t, command).Err)
+}
+
+func newTestCredentialsCommand(credentials Credentials) *appcmd.Command {
+	builder := NewBuilder("test", BuilderWithCredentials(credentials))
+	return &appcmd.Command{
+		Use:                 "test",
+		BindPersistentFlags: builder.BindRoot,
+		SubCommands: []*appcmd.Command{
+			NewLoginCommand("login", builder, credentials),
+			NewLogoutCommand("logout", builder, credentials),
+			NewWhoamiCommand("whoami", builder, credentials),
+			{
+				Use:  "token",
+				Args: appcmd.NoArgs,
+				Run: builder.NewRunFunc(
+					func(ctx context.Context, container Container) error {
+						token, err := container.Token(ctx)
+						if err != nil {
+							return err
+						}
+						_, err = container.Stdout().Write([]byte(token + "\n"))
+						return err
+					},
+				),
+			},
+		},
+	}
+}
+
+func testTokenValidator(_ context.Context, host string, token string) (string, error) {
+	if host != "example.com" || token != "secret" {
+		return "", errors.New("invalid token")
+	}
+	return "foo", nil
+}
@@ -0,0 +1,19 @@
+package appext
+
+import (
+	"github.com/aesoper101/x/execext/command"
+)
+
+type runnerContainer struct {
+	runner command.Runner
+}
+
+func newRunnerContainer(runner command.Runner) *runnerContainer {
+	return &runnerContainer{
+		runner: runner,
+	}
+}
+
+func (c *runnerContainer) Runner() command.Runner {
+	return c.runner
+}
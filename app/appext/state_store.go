@@ -0,0 +1,397 @@
+package appext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aesoper101/x/fileutil/filelock"
+	"go.uber.org/multierr"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// stateStoreDirName is the directory within DataDirPath that state stores are written to.
+const stateStoreDirName = "state"
+
+// StateStore is a typed key/value store persisted to a single JSON file.
+//
+// Every operation reads the file under a file lock, so a StateStore can be shared
+// between concurrent invocations of the application.
+type StateStore[T any] interface {
+	// Get gets the value for the key.
+	//
+	// Returns false if the key does not exist or has expired.
+	Get(ctx context.Context, key string) (T, bool, error)
+	// Put sets the value for the key.
+	Put(ctx context.Context, key string, value T) error
+	// Delete deletes the key.
+	//
+	// This is a no-op if the key does not exist.
+	Delete(ctx context.Context, key string) error
+	// Keys returns the keys that exist and have not expired, sorted.
+	Keys(ctx context.Context) ([]string, error)
+}
+
+// NewStateStore returns a new StateStore persisted at DataDirPath()/state/name.json.
+//
+// The name must be in [a-zA-Z0-9-_].
+func NewStateStore[T any](container NameContainer, name string, options ...StateStoreOption) (StateStore[T], error) {
+	return newStateStore[T](container.DataDirPath(), name, 0, options...)
+}
+
+// NewCacheStore returns a new StateStore persisted at CacheDirPath()/name.json, where
+// values expire after the TTL.
+//
+// Expired values are evicted on the next write. The name must be in [a-zA-Z0-9-_].
+func NewCacheStore[T any](
+	container NameContainer,
+	name string,
+	ttl time.Duration,
+	options ...StateStoreOption,
+) (StateStore[T], error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("cache TTL must be positive, got %v", ttl)
+	}
+	return newStateStore[T](container.CacheDirPath(), name, ttl, options...)
+}
+
+// StateMigration migrates the raw JSON values of a StateStore from one schema version to the next.
+//
+// Keys mapped to nil values are deleted.
+type StateMigration func(values map[string]json.RawMessage) (map[string]json.RawMessage, error)
+
+// StateStoreOption is an option for a new StateStore.
+type StateStoreOption func(*stateStoreOptions)
+
+// StateStoreWithMigrations returns a new StateStoreOption that sets the schema migrations.
+//
+// The schema version of the store is the number of migrations, and the migration at index i
+// migrates values from version i to version i+1. Stores are migrated when first read, and
+// reading a store written with a newer schema version is an error.
+//
+// The default is no migrations, that is schema version 0.
+func StateStoreWithMigrations(migrations ...StateMigration) StateStoreOption {
+	return func(stateStoreOptions *stateStoreOptions) {
+		stateStoreOptions.migrations = migrations
+	}
+}
+
+// StateStoreWithLockTimeout returns a new StateStoreOption that sets the file lock timeout.
+//
+// The default is filelock.DefaultLockTimeout.
+func StateStoreWithLockTimeout(lockTimeout time.Duration) StateStoreOption {
+	return func(stateStoreOptions *stateStoreOptions) {
+		stateStoreOptions.lockTimeout = lockTimeout
+	}
+}
+
+// *** PRIVATE ***
+
+type stateStoreOptions struct {
+	migrations  []StateMigration
+	lockTimeout time.Duration
+}
+
+func newStateStoreOptions() *stateStoreOptions {
+	return &stateStoreOptions{
+		lockTimeout: filelock.DefaultLockTimeout,
+	}
+}
+
+type stateStore[T any] struct {
+	dirPath     string
+	fileName    string
+	ttl         time.Duration
+	migrations  []StateMigration
+	lockTimeout time.Duration
+	// now is swapped in tests.
+	now func() time.Time
+}
+
+func newStateStore[T any](
+	dirPath string,
+	name string,
+	ttl time.Duration,
+	options ...StateStoreOption,
+) (*stateStore[T], error) {
+	if dirPath == "" {
+		return nil, errors.New("could not determine the directory for the state store")
+	}
+	if err := validateStateStoreName(name); err != nil {
+		return nil, err
+	}
+	stateStoreOptions := newStateStoreOptions()
+	for _, option := range options {
+		option(stateStoreOptions)
+	}
+	if ttl == 0 {
+		// State is kept apart from anything else the application writes to DataDirPath.
+		dirPath = filepath.Join(dirPath, stateStoreDirName)
+	}
+	return &stateStore[T]{
+		dirPath:     dirPath,
+		fileName:    name + ".json",
+		ttl:         ttl,
+		migrations:  stateStoreOptions.migrations,
+		lockTimeout: stateStoreOptions.lockTimeout,
+		now:         time.Now,
+	}, nil
+}
+
+func (s *stateStore[T]) Get(ctx context.Context, key string) (T, bool, error) {
+	var value T
+	var ok bool
+	err := s.read(
+		ctx,
+		func(stateFile *stateFile) error {
+			entry, found := stateFile.Entries[key]
+			if !found || s.isExpired(entry) {
+				return nil
+			}
+			if err := json.Unmarshal(entry.Value, &value); err != nil {
+				return fmt.Errorf("could not decode %q in %s: %w", key, s.filePath(), err)
+			}
+			ok = true
+			return nil
+		},
+	)
+	return value, ok, err
+}
+
+func (s *stateStore[T]) Put(ctx context.Context, key string, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.write(
+		ctx,
+		func(stateFile *stateFile) error {
+			entry := &stateEntry{
+				Value: data,
+			}
+			if s.ttl > 0 {
+				expiresAt := s.now().Add(s.ttl)
+				entry.ExpiresAt = &expiresAt
+			}
+			stateFile.Entries[key] = entry
+			return nil
+		},
+	)
+}
+
+func (s *stateStore[T]) Delete(ctx context.Context, key string) error {
+	return s.write(
+		ctx,
+		func(stateFile *stateFile) error {
+			delete(stateFile.Entries, key)
+			return nil
+		},
+	)
+}
+
+func (s *stateStore[T]) Keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	err := s.read(
+		ctx,
+		func(stateFile *stateFile) error {
+			for key, entry := range stateFile.Entries {
+				if !s.isExpired(entry) {
+					keys = append(keys, key)
+				}
+			}
+			return nil
+		},
+	)
+	sort.Strings(keys)
+	return keys, err
+}
+
+func (s *stateStore[T]) read(ctx context.Context, f func(*stateFile) error) (retErr error) {
+	// Stores are migrated on read, which needs the write lock.
+	unlocker, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		retErr = multierr.Append(retErr, unlocker.Unlock())
+	}()
+	stateFile, migrated, err := s.readFile()
+	if err != nil {
+		return err
+	}
+	if migrated {
+		if err := s.writeFile(stateFile); err != nil {
+			return err
+		}
+	}
+	return f(stateFile)
+}
+
+func (s *stateStore[T]) write(ctx context.Context, f func(*stateFile) error) (retErr error) {
+	unlocker, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		retErr = multierr.Append(retErr, unlocker.Unlock())
+	}()
+	stateFile, _, err := s.readFile()
+	if err != nil {
+		return err
+	}
+	if err := f(stateFile); err != nil {
+		return err
+	}
+	for key, entry := range stateFile.Entries {
+		if s.isExpired(entry) {
+			delete(stateFile.Entries, key)
+		}
+	}
+	return s.writeFile(stateFile)
+}
+
+func (s *stateStore[T]) lock(ctx context.Context) (filelock.Unlocker, error) {
+	if err := os.MkdirAll(s.dirPath, 0755); err != nil {
+		return nil, err
+	}
+	locker, err := filelock.NewLocker(s.dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return locker.Lock(ctx, s.fileName+".lock", filelock.LockWithTimeout(s.lockTimeout))
+}
+
+// readFile reads and migrates the state file.
+//
+// Returns true if the state file was migrated and should be written back.
+func (s *stateStore[T]) readFile() (*stateFile, bool, error) {
+	version := len(s.migrations)
+	data, err := os.ReadFile(s.filePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return newStateFile(version), false, nil
+		}
+		return nil, false, err
+	}
+	stateFile := newStateFile(0)
+	if err := json.Unmarshal(data, stateFile); err != nil {
+		if s.ttl > 0 {
+			// A corrupt cache is discarded rather than failing the application.
+			return newStateFile(version), false, nil
+		}
+		return nil, false, fmt.Errorf("could not decode %s: %w", s.filePath(), err)
+	}
+	if stateFile.Entries == nil {
+		stateFile.Entries = make(map[string]*stateEntry)
+	}
+	if stateFile.Version > version {
+		return nil, false, fmt.Errorf(
+			"%s has schema version %d, but only versions up to %d are supported",
+			s.filePath(),
+			stateFile.Version,
+			version,
+		)
+	}
+	if stateFile.Version == version {
+		return stateFile, false, nil
+	}
+	for ; stateFile.Version < version; stateFile.Version++ {
+		if err := stateFile.migrate(s.migrations[stateFile.Version]); err != nil {
+			return nil, false, fmt.Errorf(
+				"could not migrate %s from schema version %d: %w",
+				s.filePath(),
+				stateFile.Version,
+				err,
+			)
+		}
+	}
+	return stateFile, true, nil
+}
+
+// writeFile writes the state file atomically.
+func (s *stateStore[T]) writeFile(stateFile *stateFile) (retErr error) {
+	data, err := json.MarshalIndent(stateFile, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(s.dirPath, "."+s.fileName+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			retErr = multierr.Append(retErr, removeIfExists(file.Name()))
+		}
+	}()
+	_, err = file.Write(data)
+	if err = multierr.Append(err, file.Close()); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), s.filePath())
+}
+
+func (s *stateStore[T]) filePath() string {
+	return filepath.Join(s.dirPath, s.fileName)
+}
+
+func (s *stateStore[T]) isExpired(entry *stateEntry) bool {
+	return entry.ExpiresAt != nil && !s.now().Before(*entry.ExpiresAt)
+}
+
+func validateStateStoreName(name string) error {
+	if name == "" {
+		return errors.New("empty state store name")
+	}
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_') {
+			return fmt.Errorf("invalid state store name: %s", name)
+		}
+	}
+	return nil
+}
+
+type stateFile struct {
+	Version int                    `json:"version"`
+	Entries map[string]*stateEntry `json:"entries"`
+}
+
+func newStateFile(version int) *stateFile {
+	return &stateFile{
+		Version: version,
+		Entries: make(map[string]*stateEntry),
+	}
+}
+
+func (f *stateFile) migrate(migration StateMigration) error {
+	values := make(map[string]json.RawMessage, len(f.Entries))
+	for key, entry := range f.Entries {
+		values[key] = entry.Value
+	}
+	values, err := migration(values)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]*stateEntry, len(values))
+	for key, value := range values {
+		if value == nil {
+			continue
+		}
+		entry := &stateEntry{
+			Value: value,
+		}
+		if existingEntry, ok := f.Entries[key]; ok {
+			entry.ExpiresAt = existingEntry.ExpiresAt
+		}
+		entries[key] = entry
+	}
+	f.Entries = entries
+	return nil
+}
+
+type stateEntry struct {
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,174 @@
+package appext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/app/apptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogin struct {
+	Username string `json:"username"`
+}
+
+func TestStateStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	nameContainer := newTestStateNameContainer(t)
+	store, err := NewStateStore[testLogin](nameContainer, "logins")
+	require.NoError(t, err)
+
+	_, ok, err := store.Get(ctx, "example.com")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, store.Put(ctx, "example.com", testLogin{Username: "foo"}))
+	require.NoError(t, store.Put(ctx, "example.org", testLogin{Username: "bar"}))
+	login, ok, err := store.Get(ctx, "example.com")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, testLogin{Username: "foo"}, login)
+	keys, err := store.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "example.org"}, keys)
+	require.NoError(t, store.Delete(ctx, "example.com"))
+	require.NoError(t, store.Delete(ctx, "example.com"))
+	keys, err = store.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.org"}, keys)
+	assert.FileExists(t, filepath.Join(nameContainer.DataDirPath(), "state", "logins.json"))
+
+	_, err = NewStateStore[testLogin](nameContainer, "../logins")
+	assert.EqualError(t, err, "invalid state store name: ../logins")
+}
+
+func TestStateStoreConcurrentPuts(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	nameContainer := newTestStateNameContainer(t)
+	var waitGroup sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			// Each goroutine has its own store, as separate processes would.
+			store, err := NewStateStore[int](nameContainer, "counters", StateStoreWithLockTimeout(10*time.Second))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = store.Put(ctx, fmt.Sprintf("key%d", i), i)
+		}()
+	}
+	waitGroup.Wait()
+	require.NoError(t, errors.Join(errs...))
+	store, err := NewStateStore[int](nameContainer, "counters")
+	require.NoError(t, err)
+	keys, err := store.Keys(ctx)
+	require.NoError(t, err)
+	assert.Len(t, keys, len(errs))
+}
+
+func TestStateStoreMigrations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	nameContainer := newTestStateNameContainer(t)
+	storeV0, err := NewStateStore[string](nameContainer, "logins")
+	require.NoError(t, err)
+	require.NoError(t, storeV0.Put(ctx, "example.com", "foo"))
+	require.NoError(t, storeV0.Put(ctx, "example.org", ""))
+
+	migrations := []StateMigration{
+		// Version 0 stored usernames, version 1 stores logins.
+		func(values map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+			for key, value := range values {
+				var username string
+				if err := json.Unmarshal(value, &username); err != nil {
+					return nil, err
+				}
+				if username == "" {
+					values[key] = nil
+					continue
+				}
+				data, err := json.Marshal(testLogin{Username: username})
+				if err != nil {
+					return nil, err
+				}
+				values[key] = data
+			}
+			return values, nil
+		},
+	}
+	storeV1, err := NewStateStore[testLogin](nameContainer, "logins", StateStoreWithMigrations(migrations...))
+	require.NoError(t, err)
+	login, ok, err := storeV1.Get(ctx, "example.com")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, testLogin{Username: "foo"}, login)
+	keys, err := storeV1.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com"}, keys)
+
+	// The store was written back with version 1, which version 0 cannot read.
+	_, _, err = storeV0.Get(ctx, "example.com")
+	assert.ErrorContains(t, err, "has schema version 1, but only versions up to 0 are supported")
+}
+
+func TestCacheStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	nameContainer := newTestStateNameContainer(t)
+	_, err := NewCacheStore[string](nameContainer, "lookups", 0)
+	assert.Error(t, err)
+	cacheStore, err := NewCacheStore[string](nameContainer, "lookups", time.Minute)
+	require.NoError(t, err)
+	store := cacheStore.(*stateStore[string])
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Put(ctx, "a", "1"))
+	now = now.Add(30 * time.Second)
+	require.NoError(t, store.Put(ctx, "b", "2"))
+	value, ok, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "1", value)
+
+	now = now.Add(30 * time.Second)
+	_, ok, err = store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	keys, err := store.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, keys)
+
+	// Expired values are evicted from the file on write.
+	require.NoError(t, store.Put(ctx, "c", "3"))
+	cacheFilePath := filepath.Join(nameContainer.CacheDirPath(), "lookups.json")
+	data, err := os.ReadFile(cacheFilePath)
+	require.NoError(t, err)
+	var stateFile stateFile
+	require.NoError(t, json.Unmarshal(data, &stateFile))
+	assert.Len(t, stateFile.Entries, 2)
+
+	// A corrupt cache is discarded.
+	require.NoError(t, os.WriteFile(cacheFilePath, []byte("{"), 0600))
+	keys, err = store.Keys(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func newTestStateNameContainer(t *testing.T) NameContainer {
+	nameContainer, err := NewNameContainer(app.NewEnvContainer(apptest.HomeEnv(apptest.NewHomeDir(t))), "test")
+	require.NoError(t, err)
+	return nameContainer
+}
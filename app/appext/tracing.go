@@ -0,0 +1,307 @@
+package appext
+
+import (
+	"context"
+	"fmt"
+	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/observabilityzap"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TracingExporterZap logs spans at debug level.
+	TracingExporterZap = "zap"
+	// TracingExporterFile writes spans to a file, one JSON object per line.
+	TracingExporterFile = "file"
+	// TracingExporterOTLPHTTP sends spans to a collector with OTLP over HTTP.
+	TracingExporterOTLPHTTP = "otlp-http"
+	// TracingExporterStdout pretty-prints spans to stdout.
+	TracingExporterStdout = "stdout"
+
+	// tracingShutdownTimeout is the maximum time spent flushing spans when the run is done.
+	tracingShutdownTimeout = 5 * time.Second
+	// otlpTracesURLPath is the path appended to an OTLP endpoint without a path.
+	otlpTracesURLPath = "/v1/traces"
+)
+
+// tracingExporters are the valid values of --trace-exporter.
+var tracingExporters = []string{
+	TracingExporterZap,
+	TracingExporterFile,
+	TracingExporterOTLPHTTP,
+	TracingExporterStdout,
+}
+
+type tracingFlags struct {
+	exporter           string
+	filePath           string
+	endpoint           string
+	sampleRatio        float64
+	resourceAttributes []string
+}
+
+// Bind binds the flags, whose help names the environment variables they fall
+// back to, with envPrefix being the prefix of the application.
+func (f *tracingFlags) Bind(flagSet *pflag.FlagSet, envPrefix string) {
+	flagSet.StringVar(
+		&f.exporter,
+		"trace-exporter",
+		TracingExporterZap,
+		fmt.Sprintf(
+			"The tracing exporter [%s], defaults to $%sTRACE_EXPORTER",
+			strings.Join(tracingExporters, ","),
+			envPrefix,
+		),
+	)
+	flagSet.StringVar(
+		&f.filePath,
+		"trace-file",
+		"",
+		fmt.Sprintf("The file to write spans to, for the file exporter, defaults to $%sTRACE_FILE", envPrefix),
+	)
+	flagSet.StringVar(
+		&f.endpoint,
+		"trace-endpoint",
+		"",
+		"The collector URL, for the otlp-http exporter, defaults to $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, then $OTEL_EXPORTER_OTLP_ENDPOINT",
+	)
+	flagSet.Float64Var(
+		&f.sampleRatio,
+		"trace-sample-ratio",
+		1,
+		fmt.Sprintf("The ratio of traces to sample, between 0 and 1, defaults to $%sTRACE_SAMPLE_RATIO", envPrefix),
+	)
+	flagSet.StringSliceVar(
+		&f.resourceAttributes,
+		"trace-resource-attribute",
+		nil,
+		"Additional resource attributes for spans, in the form key=value, defaults to $OTEL_RESOURCE_ATTRIBUTES",
+	)
+}
+
+// startTracing starts the tracer provider for the flags and sets it as the global
+// tracer provider.
+//
+// Flags that were not set on the command line fall back to the environment:
+//
+//   - $APP_NAME_TRACE_EXPORTER for --trace-exporter.
+//   - $APP_NAME_TRACE_FILE for --trace-file.
+//   - $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, then $OTEL_EXPORTER_OTLP_ENDPOINT, for --trace-endpoint.
+//   - $APP_NAME_TRACE_SAMPLE_RATIO for --trace-sample-ratio.
+//   - $OTEL_RESOURCE_ATTRIBUTES for --trace-resource-attribute.
+//
+// The returned io.Closer flushes and shuts down the tracer provider.
+func (b *builder) startTracing(
+	ctx context.Context,
+	container app.Container,
+	logger *zap.Logger,
+) (*sdktrace.TracerProvider, io.Closer, error) {
+	envPrefix := getAppNameEnvPrefix(b.appName)
+	exporterName := b.tracingFlagOrEnv("trace-exporter", b.tracingFlags.exporter, container, envPrefix+"TRACE_EXPORTER")
+	filePath := b.tracingFlagOrEnv("trace-file", b.tracingFlags.filePath, container, envPrefix+"TRACE_FILE")
+	endpoint := b.tracingFlagOrEnv(
+		"trace-endpoint",
+		b.tracingFlags.endpoint,
+		container,
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+	)
+	if endpoint == "" {
+		// The generic endpoint is the base URL of the collector.
+		endpoint = container.Env("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	sampleRatio := b.tracingFlags.sampleRatio
+	if !b.tracingFlagChanged("trace-sample-ratio") {
+		if sampleRatioString := container.Env(envPrefix + "TRACE_SAMPLE_RATIO"); sampleRatioString != "" {
+			var err error
+			sampleRatio, err = strconv.ParseFloat(sampleRatioString, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid $%sTRACE_SAMPLE_RATIO: %w", envPrefix, err)
+			}
+		}
+	}
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return nil, nil, fmt.Errorf("--trace-sample-ratio must be between 0 and 1, got %v", sampleRatio)
+	}
+	resourceAttributes, err := parseResourceAttributes(b.tracingFlags.resourceAttributes, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !b.tracingFlagChanged("trace-resource-attribute") {
+		if resourceAttributesString := container.Env("OTEL_RESOURCE_ATTRIBUTES"); resourceAttributesString != "" {
+			resourceAttributes, err = parseResourceAttributes(strings.Split(resourceAttributesString, ","), true)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid $OTEL_RESOURCE_ATTRIBUTES: %w", err)
+			}
+		}
+	}
+	tracingResource := b.newTracingResource(resourceAttributes)
+
+	var exporter sdktrace.SpanExporter
+	var exporterCloser io.Closer
+	switch exporterName {
+	case TracingExporterZap:
+		exporter = observabilityzap.NewExporter(logger)
+	case TracingExporterFile:
+		if filePath == "" {
+			return nil, nil, fmt.Errorf("--trace-file is required for the %s exporter", TracingExporterFile)
+		}
+		file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The stdouttrace exporter writes one JSON object per line unless pretty-printing.
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			return nil, nil, multierr.Append(err, file.Close())
+		}
+		exporterCloser = file
+	case TracingExporterOTLPHTTP:
+		var options []otlptracehttp.Option
+		if endpoint != "" {
+			endpointURL, err := getOTLPTracesEndpointURL(endpoint)
+			if err != nil {
+				return nil, nil, err
+			}
+			options = append(options, otlptracehttp.WithEndpointURL(endpointURL))
+		}
+		// This does not connect, spans are sent when batches are exported.
+		exporter, err = otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, nil, err
+		}
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New(
+			stdouttrace.WithWriter(container.Stdout()),
+			stdouttrace.WithPrettyPrint(),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf(
+			"unknown tracing exporter %q, must be one of [%s]",
+			exporterName,
+			strings.Join(tracingExporters, ","),
+		)
+	}
+	logger.Debug("tracing", zap.String("exporter", exporterName), zap.Float64("sample_ratio", sampleRatio))
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(tracingResource),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	)
+	return tracerProvider, newTracingCloser(tracerProvider, exporterCloser), nil
+}
+
+// newTracingResource returns the resource describing this application.
+//
+// The service name is the app name, and the service version is set if BuilderWithVersion was used.
+func (b *builder) newTracingResource(resourceAttributes []attribute.KeyValue) *resource.Resource {
+	attributes := []attribute.KeyValue{
+		semconv.ServiceName(b.appName),
+	}
+	if b.version != "" {
+		attributes = append(attributes, semconv.ServiceVersion(b.version))
+	}
+	return resource.NewWithAttributes(semconv.SchemaURL, append(attributes, resourceAttributes...)...)
+}
+
+// parseResourceAttributes parses resource attributes in the form key=value.
+//
+// If percentDecode is set, keys and values are percent-decoded, as required
+// for $OTEL_RESOURCE_ATTRIBUTES.
+func parseResourceAttributes(resourceAttributes []string, percentDecode bool) ([]attribute.KeyValue, error) {
+	attributes := make([]attribute.KeyValue, 0, len(resourceAttributes))
+	for _, resourceAttribute := range resourceAttributes {
+		key, value, ok := strings.Cut(strings.TrimSpace(resourceAttribute), "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid resource attribute %q, must be in the form key=value", resourceAttribute)
+		}
+		if percentDecode {
+			var err error
+			if key, err = url.PathUnescape(key); err != nil {
+				return nil, fmt.Errorf("invalid resource attribute %q: %w", resourceAttribute, err)
+			}
+			if value, err = url.PathUnescape(value); err != nil {
+				return nil, fmt.Errorf("invalid resource attribute %q: %w", resourceAttribute, err)
+			}
+		}
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	return attributes, nil
+}
+
+func (b *builder) tracingFlagChanged(name string) bool {
+	if b.flagSet == nil {
+		return false
+	}
+	flag := b.flagSet.Lookup(name)
+	return flag != nil && flag.Changed
+}
+
+func (b *builder) tracingFlagOrEnv(name string, value string, envContainer app.EnvContainer, envKey string) string {
+	if b.tracingFlagChanged(name) {
+		return value
+	}
+	if envValue := envContainer.Env(envKey); envValue != "" {
+		return envValue
+	}
+	return value
+}
+
+// getOTLPTracesEndpointURL returns the URL to send traces to.
+//
+// As with $OTEL_EXPORTER_OTLP_ENDPOINT, /v1/traces is appended if the URL has no path.
+func getOTLPTracesEndpointURL(endpoint string) (string, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Scheme == "" || endpointURL.Host == "" {
+		return "", fmt.Errorf("invalid tracing endpoint %q, must be a URL such as http://localhost:4318", endpoint)
+	}
+	if endpointURL.Path == "" || endpointURL.Path == "/" {
+		endpointURL.Path = otlpTracesURLPath
+	}
+	return endpointURL.String(), nil
+}
+
+type tracingCloser struct {
+	tracerProvider *sdktrace.TracerProvider
+	exporterCloser io.Closer
+}
+
+func newTracingCloser(tracerProvider *sdktrace.TracerProvider, exporterCloser io.Closer) *tracingCloser {
+	return &tracingCloser{
+		tracerProvider: tracerProvider,
+		exporterCloser: exporterCloser,
+	}
+}
+
+func (t *tracingCloser) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	err := t.tracerProvider.Shutdown(ctx)
+	if t.exporterCloser != nil {
+		err = multierr.Append(err, t.exporterCloser.Close())
+	}
+	return err
+}
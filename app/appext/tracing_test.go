@@ -0,0 +1,182 @@
+package appext
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aesoper101/x/app/appcmd"
+	"github.com/aesoper101/x/app/apptest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The tracing tests set the global tracer provider, so they do not run in parallel.
+func TestTracingFile(t *testing.T) {
+	homeDirPath := apptest.NewHomeDir(t)
+	traceFilePath := filepath.Join(homeDirPath, "spans.jsonl")
+	result := apptest.Run(
+		t,
+		newTestTracingCommand(BuilderWithVersion("v1.2.3")),
+		apptest.RunWithHomeDirPath(homeDirPath),
+		apptest.RunWithArgs("--trace-exporter", "file", "--trace-resource-attribute", "env=test"),
+		apptest.RunWithEnv(map[string]string{"TEST_TRACE_FILE": traceFilePath}),
+	)
+	require.NoError(t, result.Err)
+	data, err := os.ReadFile(traceFilePath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	type jsonSpan struct {
+		Name     string
+		Resource []struct {
+			Key   string
+			Value struct {
+				Value interface{}
+			}
+		}
+	}
+	var spans []jsonSpan
+	for _, line := range lines {
+		var span jsonSpan
+		require.NoError(t, json.Unmarshal([]byte(line), &span))
+		spans = append(spans, span)
+	}
+	// Child spans end first.
+	assert.Equal(t, "work", spans[0].Name)
+	assert.Equal(t, "command", spans[1].Name)
+	resource := make(map[string]interface{})
+	for _, keyValue := range spans[1].Resource {
+		resource[keyValue.Key] = keyValue.Value.Value
+	}
+	assert.Equal(t, "test", resource["service.name"])
+	assert.Equal(t, "v1.2.3", resource["service.version"])
+	assert.Equal(t, "test", resource["env"])
+}
+
+func TestTracingOTLPHTTP(t *testing.T) {
+	var lock sync.Mutex
+	var paths []string
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				lock.Lock()
+				defer lock.Unlock()
+				paths = append(paths, request.URL.Path)
+				responseWriter.Header().Set("Content-Type", "application/x-protobuf")
+			},
+		),
+	)
+	defer server.Close()
+	result := apptest.Run(
+		t,
+		newTestTracingCommand(),
+		apptest.RunWithArgs("--trace-endpoint", server.URL),
+		apptest.RunWithEnv(map[string]string{"TEST_TRACE_EXPORTER": "otlp-http"}),
+	)
+	require.NoError(t, result.Err)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"/v1/traces"}, paths)
+}
+
+func TestTracingSampleRatio(t *testing.T) {
+	homeDirPath := apptest.NewHomeDir(t)
+	traceFilePath := filepath.Join(homeDirPath, "spans.jsonl")
+	result := apptest.Run(
+		t,
+		newTestTracingCommand(),
+		apptest.RunWithHomeDirPath(homeDirPath),
+		apptest.RunWithArgs("--trace-exporter", "file", "--trace-file", traceFilePath),
+		apptest.RunWithEnv(map[string]string{"TEST_TRACE_SAMPLE_RATIO": "0"}),
+	)
+	require.NoError(t, result.Err)
+	data, err := os.ReadFile(traceFilePath)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+	result = apptest.Run(
+		t,
+		newTestTracingCommand(),
+		apptest.RunWithArgs("--trace-exporter", "file", "--trace-file", traceFilePath, "--trace-sample-ratio", "2"),
+	)
+	assert.EqualError(t, result.Err, "--trace-sample-ratio must be between 0 and 1, got 2")
+	result = apptest.Run(
+		t,
+		newTestTracingCommand(),
+		apptest.RunWithArgs("--trace-exporter", "jaeger"),
+	)
+	assert.EqualError(t, result.Err, `unknown tracing exporter "jaeger", must be one of [zap,file,otlp-http,stdout]`)
+}
+
+func TestGetOTLPTracesEndpointURL(t *testing.T) {
+	t.Parallel()
+	for endpoint, expected := range map[string]string{
+		"http://localhost:4318":            "http://localhost:4318/v1/traces",
+		"http://localhost:4318/":           "http://localhost:4318/v1/traces",
+		"https://collector/custom/traces":  "https://collector/custom/traces",
+		"http://localhost:4318/v1/traces/": "http://localhost:4318/v1/traces/",
+	} {
+		actual, err := getOTLPTracesEndpointURL(endpoint)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+	_, err := getOTLPTracesEndpointURL("localhost:4318")
+	assert.Error(t, err)
+}
+
+func TestParseResourceAttributes(t *testing.T) {
+	t.Parallel()
+	attributes, err := parseResourceAttributes([]string{"team=a%2Cb", " env = prod"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []attribute.KeyValue{attribute.String("team", "a%2Cb"), attribute.String("env ", " prod")}, attributes)
+	// The values of $OTEL_RESOURCE_ATTRIBUTES are percent-decoded.
+	attributes, err = parseResourceAttributes([]string{"team%20name=a%2Cb%3Dc", "env=prod"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []attribute.KeyValue{attribute.String("team name", "a,b=c"), attribute.String("env", "prod")}, attributes)
+	_, err = parseResourceAttributes([]string{"team=%zz"}, true)
+	assert.Error(t, err)
+	_, err = parseResourceAttributes([]string{"team"}, false)
+	assert.EqualError(t, err, `invalid resource attribute "team", must be in the form key=value`)
+}
+
+func TestTracingFlagsHelp(t *testing.T) {
+	t.Parallel()
+	flagSet := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	var flags tracingFlags
+	flags.Bind(flagSet, "TEST_")
+	for name, envKeys := range map[string][]string{
+		"trace-exporter":           {"$TEST_TRACE_EXPORTER"},
+		"trace-file":               {"$TEST_TRACE_FILE"},
+		"trace-endpoint":           {"$OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "$OTEL_EXPORTER_OTLP_ENDPOINT"},
+		"trace-sample-ratio":       {"$TEST_TRACE_SAMPLE_RATIO"},
+		"trace-resource-attribute": {"$OTEL_RESOURCE_ATTRIBUTES"},
+	} {
+		flag := flagSet.Lookup(name)
+		require.NotNil(t, flag, name)
+		for _, envKey := range envKeys {
+			assert.Contains(t, flag.Usage, envKey)
+		}
+	}
+}
+
+func newTestTracingCommand(options ...BuilderOption) *appcmd.Command {
+	builder := NewBuilder("test", append([]BuilderOption{BuilderWithTracing()}, options...)...)
+	return &appcmd.Command{
+		Use:       "test",
+		BindFlags: builder.BindRoot,
+		Run: builder.NewRunFunc(
+			func(ctx context.Context, container Container) error {
+				_, span := container.Tracer().Start(ctx, "work")
+				span.End()
+				return nil
+			},
+		),
+	}
+}
@@ -0,0 +1,503 @@
+package appext
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/app/appcmd"
+	"github.com/aesoper101/x/joseutil"
+	jose "github.com/go-jose/go-jose/v4"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultUpdateCheckTTL is the default duration an update check result is cached for.
+	DefaultUpdateCheckTTL = 24 * time.Hour
+
+	// defaultUpdateCheckWait is how long to wait for the update check after the command
+	// is done by default, which is enough to read a cached result.
+	defaultUpdateCheckWait = 100 * time.Millisecond
+
+	// updateCheckTimeout is how long the background update check may take.
+	updateCheckTimeout = 2 * time.Second
+
+	// updateCheckCacheFileName is the name of the cached update check result within CacheDirPath.
+	updateCheckCacheFileName = "update-check.json"
+)
+
+// updateSignatureAlgorithms are the accepted algorithms for asset signatures.
+var updateSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.EdDSA,
+	jose.ES256,
+	jose.ES384,
+	jose.ES512,
+	jose.RS256,
+	jose.RS384,
+	jose.RS512,
+	jose.PS256,
+	jose.PS384,
+	jose.PS512,
+}
+
+// ReleaseManifest describes the latest release of an application.
+//
+// This is the JSON document served at the manifest location given to NewUpdater.
+type ReleaseManifest struct {
+	// Version is the semver version of the release.
+	Version string `json:"version"`
+	// URL is the release notes URL. Optional.
+	URL string `json:"url,omitempty"`
+	// Assets are the binaries of the release, one per platform.
+	Assets []ReleaseAsset `json:"assets,omitempty"`
+}
+
+// Asset returns the asset for the given GOOS and GOARCH.
+//
+// Returns false if there is no such asset.
+func (m *ReleaseManifest) Asset(goos string, goarch string) (ReleaseAsset, bool) {
+	for _, asset := range m.Assets {
+		if asset.OS == goos && asset.Arch == goarch {
+			return asset, true
+		}
+	}
+	return ReleaseAsset{}, false
+}
+
+// ReleaseAsset is a binary for a single platform.
+type ReleaseAsset struct {
+	// OS is the GOOS of the binary.
+	OS string `json:"os"`
+	// Arch is the GOARCH of the binary.
+	Arch string `json:"arch"`
+	// URL is where the binary is downloaded from.
+	URL string `json:"url"`
+	// SHA256 is the hex-encoded SHA-256 checksum of the binary.
+	SHA256 string `json:"sha256"`
+	// Signature is a compact JWS whose payload is the SHA256 value.
+	//
+	// Required if the Updater has a public key.
+	Signature string `json:"signature,omitempty"`
+}
+
+// Updater checks for and installs new versions of an application.
+type Updater interface {
+	// CurrentVersion is the version of the running application.
+	CurrentVersion() string
+	// Check returns the latest release if it is newer than the current version.
+	//
+	// The result is cached under container.CacheDirPath() for the TTL of the Updater.
+	// If force is true, the cache is ignored.
+	//
+	// Returns nil if the current version is up to date.
+	Check(ctx context.Context, container NameContainer, force bool) (*ReleaseManifest, error)
+	// Update downloads the binary for the current platform from the release, verifies it, and
+	// atomically replaces the file at executablePath with it.
+	Update(ctx context.Context, release *ReleaseManifest, executablePath string) error
+}
+
+// NewUpdater returns a new Updater.
+//
+// The current version must be a semver version. The manifest location is either an
+// http(s) URL or a local file path, and must contain a JSON ReleaseManifest.
+func NewUpdater(currentVersion string, manifestLocation string, options ...UpdaterOption) (Updater, error) {
+	return newUpdater(currentVersion, manifestLocation, options...)
+}
+
+// UpdaterOption is an option for a new Updater.
+type UpdaterOption func(*updater) error
+
+// UpdaterWithTTL returns a new UpdaterOption that sets the duration update check results are cached for.
+//
+// The default is DefaultUpdateCheckTTL.
+func UpdaterWithTTL(ttl time.Duration) UpdaterOption {
+	return func(updater *updater) error {
+		updater.ttl = ttl
+		return nil
+	}
+}
+
+// UpdaterWithPublicKey returns a new UpdaterOption that requires assets to be signed
+// by the given key.
+//
+// The key is PEM, DER, or JWK-encoded, as accepted by joseutil.LoadPublicKey.
+func UpdaterWithPublicKey(data []byte) UpdaterOption {
+	return func(updater *updater) error {
+		publicKey, err := joseutil.LoadPublicKey(data)
+		if err != nil {
+			return err
+		}
+		updater.publicKey = publicKey
+		return nil
+	}
+}
+
+// UpdaterWithHTTPClient returns a new UpdaterOption that sets the client used for
+// the manifest and downloads.
+//
+// The default is http.DefaultClient.
+func UpdaterWithHTTPClient(client *http.Client) UpdaterOption {
+	return func(updater *updater) error {
+		updater.client = client
+		return nil
+	}
+}
+
+// BuilderWithUpdater returns a new BuilderOption that checks for a new version on every
+// run, and prints a notice to stderr if one is available.
+//
+// The check runs while the command runs, and delays the command by at most the wait set
+// with BuilderWithUpdateCheckWait, which by default is only long enough to read a cached
+// result. A check that has not completed by then continues in the background for up to
+// two seconds to cache its result, and the notice is printed on a later run.
+// Set $APP_NAME_NO_UPDATE_CHECK to true to turn the check off.
+func BuilderWithUpdater(updater Updater) BuilderOption {
+	return func(builder *builder) {
+		builder.updater = updater
+	}
+}
+
+// BuilderWithUpdateCheckWait returns a new BuilderOption that waits up to the given
+// duration after the command is done for the update check of BuilderWithUpdater, so
+// that the notice is printed on the same run.
+//
+// The default is 100ms. Use 0 to never wait.
+func BuilderWithUpdateCheckWait(wait time.Duration) BuilderOption {
+	return func(builder *builder) {
+		builder.updateCheckWait = wait
+	}
+}
+
+// NewUpdateCommand returns a new command that updates the running binary to the
+// latest release.
+func NewUpdateCommand(use string, builder SubCommandBuilder, updater Updater) *appcmd.Command {
+	return &appcmd.Command{
+		Use:   use,
+		Short: "Update to the latest version",
+		Args:  appcmd.NoArgs,
+		Run: builder.NewRunFunc(
+			func(ctx context.Context, container Container) error {
+				release, err := updater.Check(ctx, container, true)
+				if err != nil {
+					return err
+				}
+				if release == nil {
+					_, err := fmt.Fprintf(
+						container.Stdout(),
+						"%s is already up to date (%s)\n",
+						container.AppName(),
+						updater.CurrentVersion(),
+					)
+					return err
+				}
+				executablePath, err := os.Executable()
+				if err != nil {
+					return err
+				}
+				executablePath, err = filepath.EvalSymlinks(executablePath)
+				if err != nil {
+					return err
+				}
+				if err := updater.Update(ctx, release, executablePath); err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(
+					container.Stdout(),
+					"Updated %s from %s to %s\n",
+					container.AppName(),
+					updater.CurrentVersion(),
+					release.Version,
+				)
+				return err
+			},
+		),
+	}
+}
+
+// *** PRIVATE ***
+
+type updater struct {
+	currentVersionString string
+	currentVersion       *semver.Version
+	manifestLocation     string
+	ttl                  time.Duration
+	publicKey            interface{}
+	client               *http.Client
+}
+
+func newUpdater(currentVersion string, manifestLocation string, options ...UpdaterOption) (*updater, error) {
+	version, err := semver.NewVersion(currentVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current version %q: %w", currentVersion, err)
+	}
+	if manifestLocation == "" {
+		return nil, errors.New("manifest location is required")
+	}
+	updater := &updater{
+		currentVersionString: currentVersion,
+		currentVersion:       version,
+		manifestLocation:     manifestLocation,
+		ttl:                  DefaultUpdateCheckTTL,
+		client:               http.DefaultClient,
+	}
+	for _, option := range options {
+		if err := option(updater); err != nil {
+			return nil, err
+		}
+	}
+	return updater, nil
+}
+
+func (u *updater) CurrentVersion() string {
+	return u.currentVersionString
+}
+
+func (u *updater) Check(ctx context.Context, container NameContainer, force bool) (*ReleaseManifest, error) {
+	cacheFilePath := ""
+	if cacheDirPath := container.CacheDirPath(); cacheDirPath != "" {
+		cacheFilePath = filepath.Join(cacheDirPath, updateCheckCacheFileName)
+	}
+	var manifest *ReleaseManifest
+	if !force && cacheFilePath != "" {
+		manifest = u.readCache(cacheFilePath)
+	}
+	if manifest == nil {
+		var err error
+		manifest, err = u.readManifest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if cacheFilePath != "" {
+			if err := u.writeCache(cacheFilePath, manifest); err != nil {
+				return nil, err
+			}
+		}
+	}
+	latestVersion, err := semver.NewVersion(manifest.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version %q in release manifest: %w", manifest.Version, err)
+	}
+	if !latestVersion.GreaterThan(u.currentVersion) {
+		return nil, nil
+	}
+	return manifest, nil
+}
+
+func (u *updater) Update(ctx context.Context, release *ReleaseManifest, executablePath string) (retErr error) {
+	asset, ok := release.Asset(runtime.GOOS, runtime.GOARCH)
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s/%s", release.Version, runtime.GOOS, runtime.GOARCH)
+	}
+	if err := u.verifySignature(asset); err != nil {
+		return err
+	}
+	fileInfo, err := os.Stat(executablePath)
+	if err != nil {
+		return err
+	}
+	readCloser, err := u.open(ctx, asset.URL)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		retErr = multierr.Append(retErr, readCloser.Close())
+	}()
+	// The temporary file is in the same directory so that the rename is atomic.
+	file, err := os.CreateTemp(filepath.Dir(executablePath), "."+filepath.Base(executablePath)+".update-*")
+	if err != nil {
+		return err
+	}
+	tmpFilePath := file.Name()
+	defer func() {
+		if retErr != nil {
+			retErr = multierr.Append(retErr, removeIfExists(tmpFilePath))
+		}
+	}()
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), readCloser)
+	if err = multierr.Append(err, file.Close()); err != nil {
+		return err
+	}
+	if checksum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(checksum, asset.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", asset.URL, asset.SHA256, checksum)
+	}
+	if err := os.Chmod(tmpFilePath, fileInfo.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilePath, executablePath)
+}
+
+// verifySignature verifies that the signature of the asset is over its checksum.
+//
+// This is a no-op if the updater has no public key.
+func (u *updater) verifySignature(asset ReleaseAsset) error {
+	if u.publicKey == nil {
+		return nil
+	}
+	if asset.Signature == "" {
+		return fmt.Errorf("binary %s is not signed", asset.URL)
+	}
+	jws, err := jose.ParseSigned(asset.Signature, updateSignatureAlgorithms)
+	if err != nil {
+		return fmt.Errorf("invalid signature for %s: %w", asset.URL, err)
+	}
+	payload, err := jws.Verify(u.publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid signature for %s: %w", asset.URL, err)
+	}
+	if !strings.EqualFold(string(payload), asset.SHA256) {
+		return fmt.Errorf("signature for %s is not for checksum %s", asset.URL, asset.SHA256)
+	}
+	return nil
+}
+
+func (u *updater) readManifest(ctx context.Context) (_ *ReleaseManifest, retErr error) {
+	readCloser, err := u.open(ctx, u.manifestLocation)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		retErr = multierr.Append(retErr, readCloser.Close())
+	}()
+	manifest := &ReleaseManifest{}
+	if err := json.NewDecoder(readCloser).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("invalid release manifest %s: %w", u.manifestLocation, err)
+	}
+	return manifest, nil
+}
+
+// open opens the http(s) URL or local file path.
+func (u *updater) open(ctx context.Context, location string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.Open(strings.TrimPrefix(location, "file://"))
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := u.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, multierr.Append(
+			fmt.Errorf("GET %s: unexpected status %s", location, response.Status),
+			response.Body.Close(),
+		)
+	}
+	return response.Body, nil
+}
+
+type updateCheckCache struct {
+	ManifestLocation string           `json:"manifest_location"`
+	CheckedAt        time.Time        `json:"checked_at"`
+	Manifest         *ReleaseManifest `json:"manifest"`
+}
+
+// readCache returns the cached manifest, or nil if there is no valid cached manifest.
+func (u *updater) readCache(cacheFilePath string) *ReleaseManifest {
+	data, err := os.ReadFile(cacheFilePath)
+	if err != nil {
+		return nil
+	}
+	var cache updateCheckCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil
+	}
+	if cache.ManifestLocation != u.manifestLocation || cache.Manifest == nil || time.Since(cache.CheckedAt) > u.ttl {
+		return nil
+	}
+	return cache.Manifest
+}
+
+func (u *updater) writeCache(cacheFilePath string, manifest *ReleaseManifest) error {
+	data, err := json.Marshal(
+		updateCheckCache{
+			ManifestLocation: u.manifestLocation,
+			CheckedAt:        time.Now(),
+			Manifest:         manifest,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheFilePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(cacheFilePath, data, 0644)
+}
+
+// startUpdateCheck starts checking for a new version in the background.
+//
+// The check is not canceled when the command returns, so that it can finish and
+// cache its result even for fast commands. The returned function waits for the
+// check for up to the update check wait, unless the command was canceled, and
+// prints a notice to stderr if a new version is available. A check that is still
+// running is left to finish in the background, within updateCheckTimeout.
+func (b *builder) startUpdateCheck(ctx context.Context, container Container) func() {
+	if noUpdateCheck, _ := app.EnvBool(container, getAppNameEnvPrefix(b.appName)+"NO_UPDATE_CHECK", false); noUpdateCheck {
+		return func() {}
+	}
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), updateCheckTimeout)
+	done := make(chan struct{})
+	var release *ReleaseManifest
+	go func() {
+		defer close(done)
+		defer cancel()
+		var err error
+		release, err = b.updater.Check(checkCtx, container, false)
+		if err != nil {
+			container.Logger().Debug("update_check", zap.Error(err))
+		}
+	}()
+	return func() {
+		if ctx.Err() != nil {
+			// Do not delay exiting after an interrupt or timeout.
+			cancel()
+			return
+		}
+		timer := time.NewTimer(b.updateCheckWait)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			select {
+			case <-done:
+			default:
+				return
+			}
+		}
+		if release == nil {
+			return
+		}
+		_, _ = fmt.Fprintf(
+			container.Stderr(),
+			"\nA new version of %s is available: %s -> %s\n",
+			container.AppName(),
+			b.updater.CurrentVersion(),
+			release.Version,
+		)
+		if release.URL != "" {
+			_, _ = fmt.Fprintln(container.Stderr(), release.URL)
+		}
+	}
+}
+
+func removeIfExists(filePath string) error {
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package appext
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/app/appcmd"
+	"github.com/aesoper101/x/app/apptest"
+	"github.com/aesoper101/x/joseutil"
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpdaterCheck(t *testing.T) {
+	t.Parallel()
+	homeDirPath := apptest.NewHomeDir(t)
+	nameContainer, err := NewNameContainer(app.NewEnvContainer(apptest.HomeEnv(homeDirPath)), "test")
+	require.NoError(t, err)
+	manifestFilePath := filepath.Join(homeDirPath, "manifest.json")
+	writeTestManifest(t, manifestFilePath, &ReleaseManifest{Version: "v1.1.0"})
+	updater, err := NewUpdater("v1.0.0", manifestFilePath)
+	require.NoError(t, err)
+
+	release, err := updater.Check(context.Background(), nameContainer, false)
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, "v1.1.0", release.Version)
+	assert.FileExists(t, filepath.Join(nameContainer.CacheDirPath(), updateCheckCacheFileName))
+
+	// The cached result is used until the TTL expires.
+	writeTestManifest(t, manifestFilePath, &ReleaseManifest{Version: "v1.0.0"})
+	release, err = updater.Check(context.Background(), nameContainer, false)
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, "v1.1.0", release.Version)
+	release, err = updater.Check(context.Background(), nameContainer, true)
+	require.NoError(t, err)
+	assert.Nil(t, release)
+
+	_, err = NewUpdater("dev", manifestFilePath)
+	assert.Error(t, err)
+}
+
+func TestUpdaterUpdate(t *testing.T) {
+	t.Parallel()
+	binary := []byte("new binary")
+	checksum := sha256.Sum256(binary)
+	checksumHex := hex.EncodeToString(checksum[:])
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				_, _ = responseWriter.Write(binary)
+			},
+		),
+	)
+	defer server.Close()
+	publicKey, privateKey, err := joseutil.NewSigningKey(jose.EdDSA, 0)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: privateKey}, nil)
+	require.NoError(t, err)
+	jws, err := signer.Sign([]byte(checksumHex))
+	require.NoError(t, err)
+	signature, err := jws.CompactSerialize()
+	require.NoError(t, err)
+
+	dirPath := t.TempDir()
+	executablePath := filepath.Join(dirPath, "test")
+	require.NoError(t, os.WriteFile(executablePath, []byte("old binary"), 0755))
+	updater, err := NewUpdater("v1.0.0", filepath.Join(dirPath, "manifest.json"), UpdaterWithPublicKey(publicKeyPEM))
+	require.NoError(t, err)
+	newRelease := func(asset ReleaseAsset) *ReleaseManifest {
+		asset.OS = runtime.GOOS
+		asset.Arch = runtime.GOARCH
+		asset.URL = server.URL + "/test"
+		return &ReleaseManifest{Version: "v1.1.0", Assets: []ReleaseAsset{asset}}
+	}
+
+	err = updater.Update(context.Background(), newRelease(ReleaseAsset{SHA256: checksumHex}), executablePath)
+	assert.EqualError(t, err, "binary "+server.URL+"/test is not signed")
+	err = updater.Update(
+		context.Background(),
+		newRelease(ReleaseAsset{SHA256: hex.EncodeToString(make([]byte, sha256.Size)), Signature: signature}),
+		executablePath,
+	)
+	assert.ErrorContains(t, err, "is not for checksum")
+	assertOnlyFile(t, dirPath, "test")
+
+	err = updater.Update(
+		context.Background(),
+		newRelease(ReleaseAsset{SHA256: checksumHex, Signature: signature}),
+		executablePath,
+	)
+	require.NoError(t, err)
+	data, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, binary, data)
+	fileInfo, err := os.Stat(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), fileInfo.Mode().Perm())
+	assertOnlyFile(t, dirPath, "test")
+}
+
+func TestUpdateNotice(t *testing.T) {
+	t.Parallel()
+	homeDirPath := apptest.NewHomeDir(t)
+	manifestFilePath := filepath.Join(homeDirPath, "manifest.json")
+	writeTestManifest(t, manifestFilePath, &ReleaseManifest{Version: "v1.1.0", URL: "https://example.com/releases"})
+	updater, err := NewUpdater("v1.0.0", manifestFilePath)
+	require.NoError(t, err)
+	builder := NewBuilder("test", BuilderWithUpdater(updater), BuilderWithUpdateCheckWait(time.Second))
+	command := &appcmd.Command{
+		Use:       "test",
+		BindFlags: builder.BindRoot,
+		Run: builder.NewRunFunc(
+			func(ctx context.Context, container Container) error {
+				return nil
+			},
+		),
+	}
+	result := apptest.Run(t, command, apptest.RunWithHomeDirPath(homeDirPath))
+	require.NoError(t, result.Err)
+	assert.Equal(
+		t,
+		"\nA new version of test is available: v1.0.0 -> v1.1.0\nhttps://example.com/releases\n",
+		result.Stderr,
+	)
+	result = apptest.Run(
+		t,
+		command,
+		apptest.RunWithHomeDirPath(homeDirPath),
+		apptest.RunWithEnv(map[string]string{"TEST_NO_UPDATE_CHECK": "true"}),
+	)
+	require.NoError(t, result.Err)
+	assert.Empty(t, result.Stderr)
+}
+
+func TestUpdateNoticeFastCommand(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int64
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				requests.Add(1)
+				// The command returns before the manifest is served.
+				time.Sleep(500 * time.Millisecond)
+				_ = json.NewEncoder(responseWriter).Encode(&ReleaseManifest{Version: "v1.1.0"})
+			},
+		),
+	)
+	defer server.Close()
+	updater, err := NewUpdater("v1.0.0", server.URL)
+	require.NoError(t, err)
+	newCommand := func(options ...BuilderOption) *appcmd.Command {
+		builder := NewBuilder("test", append([]BuilderOption{BuilderWithUpdater(updater)}, options...)...)
+		return &appcmd.Command{
+			Use:       "test",
+			BindFlags: builder.BindRoot,
+			Run: builder.NewRunFunc(
+				func(ctx context.Context, container Container) error {
+					return nil
+				},
+			),
+		}
+	}
+	notice := "\nA new version of test is available: v1.0.0 -> v1.1.0\n"
+
+	// The command does not wait for the check beyond the default wait, and the
+	// check caches its result in the background for the notice of the next run.
+	homeDirPath := apptest.NewHomeDir(t)
+	nameContainer, err := NewNameContainer(app.NewEnvContainer(apptest.HomeEnv(homeDirPath)), "test")
+	require.NoError(t, err)
+	cacheFilePath := filepath.Join(nameContainer.CacheDirPath(), updateCheckCacheFileName)
+	start := time.Now()
+	result := apptest.Run(t, newCommand(), apptest.RunWithHomeDirPath(homeDirPath))
+	require.NoError(t, result.Err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Empty(t, result.Stderr)
+	require.Eventually(
+		t,
+		func() bool {
+			_, err := os.Stat(cacheFilePath)
+			return err == nil
+		},
+		2*time.Second,
+		10*time.Millisecond,
+	)
+	result = apptest.Run(t, newCommand(), apptest.RunWithHomeDirPath(homeDirPath))
+	require.NoError(t, result.Err)
+	assert.Equal(t, notice, result.Stderr)
+	assert.Equal(t, int64(1), requests.Load())
+
+	// With waiting, the notice is printed on the same run.
+	result = apptest.Run(t, newCommand(BuilderWithUpdateCheckWait(2*time.Second)))
+	require.NoError(t, result.Err)
+	assert.Equal(t, notice, result.Stderr)
+}
+
+func writeTestManifest(t *testing.T, filePath string, manifest *ReleaseManifest) {
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filePath, data, 0600))
+}
+
+func assertOnlyFile(t *testing.T, dirPath string, name string) {
+	entries, err := os.ReadDir(dirPath)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{name}, names)
+}
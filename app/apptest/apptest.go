@@ -0,0 +1,256 @@
+// Package apptest provides an in-memory harness to run appcmd.Commands end-to-end in tests.
+package apptest
+
+import (
+	"bytes"
+	"context"
+	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/app/appcmd"
+	"github.com/aesoper101/x/diff/diffmyers"
+	"github.com/aesoper101/x/tmp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// UpdateGoldenEnvKey is the environment variable that, when set to true, makes
+// AssertGolden write the actual value to the golden file instead of comparing.
+const UpdateGoldenEnvKey = "APPTEST_UPDATE_GOLDEN"
+
+// Result is the result of running a command.
+type Result struct {
+	// Stdout is everything the command wrote to stdout.
+	Stdout string
+	// Stderr is everything the command wrote to stderr.
+	Stderr string
+	// Err is the error returned from the command.
+	Err error
+	// ExitCode is the exit code for Err, as returned by app.GetExitCode.
+	ExitCode int
+	// HomeDirPath is the home directory the command was run with.
+	HomeDirPath string
+}
+
+// AssertStdoutGolden asserts that stdout matches the golden file.
+//
+// See AssertGolden for details.
+func (r *Result) AssertStdoutGolden(t testing.TB, goldenFilePath string) bool {
+	t.Helper()
+	return AssertGolden(t, goldenFilePath, r.Stdout)
+}
+
+// AssertStderrGolden asserts that stderr matches the golden file.
+//
+// See AssertGolden for details.
+func (r *Result) AssertStderrGolden(t testing.TB, goldenFilePath string) bool {
+	t.Helper()
+	return AssertGolden(t, goldenFilePath, r.Stderr)
+}
+
+// Run runs the command end-to-end and returns the result.
+//
+// The binary name is the first word of command.Use. Unless RunWithHomeDirPath is
+// used, the command runs with a new home directory created with NewHomeDir.
+//
+// Setup failures fail the test. Errors from the command itself are returned on
+// the Result.
+func Run(t testing.TB, command *appcmd.Command, options ...RunOption) *Result {
+	t.Helper()
+	runOptions := newRunOptions()
+	for _, option := range options {
+		option(runOptions)
+	}
+	homeDirPath := runOptions.homeDirPath
+	if homeDirPath == "" {
+		homeDirPath = NewHomeDir(t)
+	}
+	env := HomeEnv(homeDirPath)
+	for key, value := range runOptions.env {
+		env[key] = value
+	}
+	binaryName, _, _ := strings.Cut(command.Use, " ")
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	container := app.NewContainer(
+		env,
+		strings.NewReader(runOptions.stdin),
+		stdout,
+		stderr,
+		append([]string{binaryName}, runOptions.args...)...,
+	)
+	err := appcmd.Run(context.Background(), container, command, runOptions.appcmdRunOptions...)
+	return &Result{
+		Stdout:      stdout.String(),
+		Stderr:      stderr.String(),
+		Err:         err,
+		ExitCode:    app.GetExitCode(err),
+		HomeDirPath: homeDirPath,
+	}
+}
+
+// RunOption is an option for Run.
+type RunOption func(*runOptions)
+
+// RunWithArgs returns a new RunOption that sets the arguments, excluding the binary name.
+//
+// The default is no arguments.
+func RunWithArgs(args ...string) RunOption {
+	return func(runOptions *runOptions) {
+		runOptions.args = args
+	}
+}
+
+// RunWithEnv returns a new RunOption that adds environment variables.
+//
+// These override the variables from HomeEnv.
+func RunWithEnv(env map[string]string) RunOption {
+	return func(runOptions *runOptions) {
+		for key, value := range env {
+			runOptions.env[key] = value
+		}
+	}
+}
+
+// RunWithStdin returns a new RunOption that sets stdin.
+//
+// The default is an empty stdin.
+func RunWithStdin(stdin string) RunOption {
+	return func(runOptions *runOptions) {
+		runOptions.stdin = stdin
+	}
+}
+
+// RunWithHomeDirPath returns a new RunOption that sets the home directory.
+//
+// Use this with NewHomeDir to seed files before running, or to share state
+// between multiple runs.
+func RunWithHomeDirPath(homeDirPath string) RunOption {
+	return func(runOptions *runOptions) {
+		runOptions.homeDirPath = homeDirPath
+	}
+}
+
+// RunWithAppcmdOptions returns a new RunOption that passes the given options to appcmd.Run.
+func RunWithAppcmdOptions(options ...appcmd.RunOption) RunOption {
+	return func(runOptions *runOptions) {
+		runOptions.appcmdRunOptions = append(runOptions.appcmdRunOptions, options...)
+	}
+}
+
+// NewHomeDir returns the path to a new temporary home directory.
+//
+// The directory contains the XDG layout returned by HomeEnv, and is removed
+// when the test completes.
+func NewHomeDir(t testing.TB) string {
+	t.Helper()
+	dir, err := tmp.NewDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(
+		func() {
+			if err := dir.Close(); err != nil {
+				t.Error(err)
+			}
+		},
+	)
+	for key, value := range HomeEnv(dir.AbsPath()) {
+		if key == "HOME" {
+			continue
+		}
+		if err := os.MkdirAll(value, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir.AbsPath()
+}
+
+// HomeEnv returns the environment variables for a home directory.
+//
+// This sets $HOME, $XDG_CONFIG_HOME, $XDG_CACHE_HOME, and $XDG_DATA_HOME so
+// that app.ConfigDirPath, app.CacheDirPath, and app.DataDirPath all resolve
+// within the home directory.
+func HomeEnv(homeDirPath string) map[string]string {
+	return map[string]string{
+		"HOME":            homeDirPath,
+		"XDG_CONFIG_HOME": filepath.Join(homeDirPath, ".config"),
+		"XDG_CACHE_HOME":  filepath.Join(homeDirPath, ".cache"),
+		"XDG_DATA_HOME":   filepath.Join(homeDirPath, ".local", "share"),
+	}
+}
+
+// AssertGolden asserts that actual matches the content of the golden file.
+//
+// On mismatch, the test fails with a unified diff from the golden file to actual.
+// If $APPTEST_UPDATE_GOLDEN is true, the golden file is written instead.
+func AssertGolden(t testing.TB, goldenFilePath string, actual string) bool {
+	t.Helper()
+	if update, _ := strconv.ParseBool(os.Getenv(UpdateGoldenEnvKey)); update {
+		if err := os.MkdirAll(filepath.Dir(goldenFilePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(goldenFilePath, []byte(actual), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+	data, err := os.ReadFile(goldenFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := string(data)
+	if expected == actual {
+		return true
+	}
+	diff, err := unifiedDiff(expected, actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Errorf(
+		"output does not match golden file %s (set $%s=true to update):\n--- %s\n+++ actual\n%s",
+		goldenFilePath,
+		UpdateGoldenEnvKey,
+		goldenFilePath,
+		diff,
+	)
+	return false
+}
+
+// *** PRIVATE ***
+
+type runOptions struct {
+	args             []string
+	env              map[string]string
+	stdin            string
+	homeDirPath      string
+	appcmdRunOptions []appcmd.RunOption
+}
+
+func newRunOptions() *runOptions {
+	return &runOptions{
+		env: make(map[string]string),
+	}
+}
+
+func unifiedDiff(from string, to string) (string, error) {
+	fromLines := splitLines(from)
+	toLines := splitLines(to)
+	diff, err := diffmyers.Print(fromLines, toLines, diffmyers.Diff(fromLines, toLines))
+	if err != nil {
+		return "", err
+	}
+	return string(diff), nil
+}
+
+func splitLines(s string) [][]byte {
+	if s == "" {
+		return nil
+	}
+	lines := bytes.SplitAfter([]byte(s), []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
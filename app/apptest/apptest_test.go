@@ -0,0 +1,68 @@
+package apptest
+
+import (
+	"context"
+	"fmt"
+	"github.com/aesoper101/x/app"
+	"github.com/aesoper101/x/app/appcmd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	command := &appcmd.Command{
+		Use: "test",
+		SubCommands: []*appcmd.Command{
+			{
+				Use: "echo",
+				Run: func(ctx context.Context, container app.Container) error {
+					data, err := io.ReadAll(container.Stdin())
+					if err != nil {
+						return err
+					}
+					configDirPath, err := app.ConfigDirPath(container)
+					if err != nil {
+						return err
+					}
+					_, _ = fmt.Fprintf(container.Stdout(), "%s %s %s\n", app.Args(container), data, container.Env("KEY"))
+					_, _ = fmt.Fprintln(container.Stderr(), configDirPath)
+					return nil
+				},
+			},
+			{
+				Use: "fail",
+				Run: func(context.Context, app.Container) error {
+					return app.NewError(3, "failed")
+				},
+			},
+		},
+	}
+
+	result := Run(
+		t,
+		command,
+		RunWithArgs("echo", "a", "b"),
+		RunWithEnv(map[string]string{"KEY": "VALUE"}),
+		RunWithStdin("hello"),
+	)
+	require.NoError(t, result.Err)
+	assert.Equal(t, 0, result.ExitCode)
+	result.AssertStdoutGolden(t, filepath.Join("testdata", "echo.golden"))
+	assert.Equal(t, filepath.Join(result.HomeDirPath, ".config")+"\n", result.Stderr)
+
+	result = Run(t, command, RunWithArgs("fail"))
+	require.Error(t, result.Err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "failed\n", result.Stderr)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Parallel()
+	diff, err := unifiedDiff("a\nb\nc\n", "a\nB\nc\n")
+	require.NoError(t, err)
+	assert.Contains(t, diff, " a\n-b\n+B\n c\n")
+}
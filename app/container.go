@@ -6,6 +6,7 @@ type container struct {
 	StdoutContainer
 	StderrContainer
 	ArgContainer
+	ShutdownContainer
 }
 
 func newContainer(
@@ -14,12 +15,14 @@ func newContainer(
 	stdoutContainer StdoutContainer,
 	stderrContainer StderrContainer,
 	argContainer ArgContainer,
+	shutdownContainer ShutdownContainer,
 ) *container {
 	return &container{
-		EnvContainer:    envContainer,
-		StdinContainer:  stdinContainer,
-		StdoutContainer: stdoutContainer,
-		StderrContainer: stderrContainer,
-		ArgContainer:    argContainer,
+		EnvContainer:      envContainer,
+		StdinContainer:    stdinContainer,
+		StdoutContainer:   stdoutContainer,
+		StderrContainer:   stderrContainer,
+		ArgContainer:      argContainer,
+		ShutdownContainer: shutdownContainer,
 	}
 }
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"github.com/aesoper101/x/errorsext"
+)
+
+// Exit codes used by GetExitCode for errorsext errors.
+//
+// These follow sysexits.h so that scripts can branch on them, and are stable.
+const (
+	// ExitCodeUsage is used for errorsext.InvalidArgument errors.
+	ExitCodeUsage = 64
+	// ExitCodeDataErr is used for errorsext.PreconditionFailed errors.
+	ExitCodeDataErr = 65
+	// ExitCodeNoInput is used for errorsext.NotFound errors.
+	ExitCodeNoInput = 66
+	// ExitCodeNoUser is used for errorsext.Unauthenticated errors.
+	ExitCodeNoUser = 67
+	// ExitCodeUnavailable is used for errorsext.Unavailable and errorsext.Unimplemented errors.
+	ExitCodeUnavailable = 69
+	// ExitCodeSoftware is used for errorsext.Internal errors.
+	ExitCodeSoftware = 70
+	// ExitCodeCantCreate is used for errorsext.AlreadyExists errors.
+	ExitCodeCantCreate = 73
+	// ExitCodeTempFail is used for errorsext.ResourceExhausted and errorsext.DeadlineExceeded errors.
+	ExitCodeTempFail = 75
+	// ExitCodeNoPerm is used for errorsext.PermissionDenied errors.
+	ExitCodeNoPerm = 77
+)
+
+// errorsextExitCodes maps errorsext error classes to exit codes.
+//
+// The first matching class wins.
+var errorsextExitCodes = []struct {
+	is       func(error) bool
+	exitCode int
+}{
+	{errorsext.IsErrorInvalidArgument, ExitCodeUsage},
+	{errorsext.IsPreconditionFailed, ExitCodeDataErr},
+	{errorsext.IsNotFound, ExitCodeNoInput},
+	{errorsext.IsUnauthenticated, ExitCodeNoUser},
+	{errorsext.IsPermissionDenied, ExitCodeNoPerm},
+	{errorsext.IsErrorAlreadyExists, ExitCodeCantCreate},
+	{errorsext.IsUnavailable, ExitCodeUnavailable},
+	{errorsext.IsUnimplemented, ExitCodeUnavailable},
+	{errorsext.IsResourceExhausted, ExitCodeTempFail},
+	{errorsext.IsDeadlineExceeded, ExitCodeTempFail},
+	{errorsext.IsInternal, ExitCodeSoftware},
+}
+
+// getErrorsextExitCode returns the exit code for the errorsext class of err.
+//
+// Returns false if err is not of a mapped class.
+func getErrorsextExitCode(err error) (int, bool) {
+	for _, errorsextExitCode := range errorsextExitCodes {
+		if errorsextExitCode.is(err) {
+			return errorsextExitCode.exitCode, true
+		}
+	}
+	return 0, false
+}
+
+// Exit codes used when the process is forced to exit by a signal.
+//
+// These follow the shell convention of 128 plus the signal number.
+const (
+	// ExitCodeInterrupt is used when forced to exit by SIGINT.
+	ExitCodeInterrupt = 130
+	// ExitCodeTerminate is used when forced to exit by SIGTERM.
+	ExitCodeTerminate = 143
+)
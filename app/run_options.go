@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"github.com/aesoper101/x/interrupt"
+	"os"
+	"syscall"
+	"time"
+)
+
+type runOptions struct {
+	gracePeriod    time.Duration
+	signalHandling bool
+	// newSignalChannel and exit are swapped in tests.
+	newSignalChannel func() (<-chan os.Signal, func())
+	exit             func(int)
+}
+
+func newRunOptions() *runOptions {
+	return &runOptions{
+		signalHandling:   true,
+		newSignalChannel: interrupt.NewSignalChannel,
+		exit:             os.Exit,
+	}
+}
+
+// handleSignals returns a context that is cancelled on the first interrupt signal.
+//
+// The process exits on the second interrupt signal, or when the grace period after the
+// first interrupt signal expires. Call the returned function to stop handling signals.
+func (r *runOptions) handleSignals(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	signalC, closer := r.newSignalChannel()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var first os.Signal
+		var graceC <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case <-graceC:
+				r.exit(getSignalExitCode(first))
+				return
+			case signal, ok := <-signalC:
+				if !ok {
+					return
+				}
+				if first != nil {
+					r.exit(getSignalExitCode(signal))
+					return
+				}
+				first = signal
+				cancel()
+				if r.gracePeriod > 0 {
+					timer := time.NewTimer(r.gracePeriod)
+					defer timer.Stop()
+					graceC = timer.C
+				}
+			}
+		}
+	}()
+	return ctx, func() {
+		close(done)
+		<-stopped
+		closer()
+		cancel()
+	}
+}
+
+// getSignalExitCode returns 128 plus the signal number.
+func getSignalExitCode(signal os.Signal) int {
+	switch signal {
+	case syscall.SIGINT:
+		return ExitCodeInterrupt
+	case syscall.SIGTERM:
+		return ExitCodeTerminate
+	}
+	if syscallSignal, ok := signal.(syscall.Signal); ok {
+		return 128 + int(syscallSignal)
+	}
+	return ExitCodeInterrupt
+}
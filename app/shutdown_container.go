@@ -0,0 +1,34 @@
+package app
+
+import (
+	"context"
+	"go.uber.org/multierr"
+	"sync"
+)
+
+type shutdownContainer struct {
+	hooks []func(context.Context) error
+	lock  sync.Mutex
+}
+
+func newShutdownContainer() *shutdownContainer {
+	return &shutdownContainer{}
+}
+
+func (s *shutdownContainer) OnShutdown(hook func(context.Context) error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+func (s *shutdownContainer) RunShutdownHooks(ctx context.Context) error {
+	s.lock.Lock()
+	hooks := s.hooks
+	s.hooks = nil
+	s.lock.Unlock()
+	var err error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		err = multierr.Append(err, hooks[i](ctx))
+	}
+	return err
+}
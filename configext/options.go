@@ -62,6 +62,14 @@ func DisableEnvLoading() OptionModifier {
 	}
 }
 
+// WithEnvPrefix only loads environment variables with the given prefix, for
+// example "APP_". The prefix is stripped before matching the schema paths.
+func WithEnvPrefix(prefix string) OptionModifier {
+	return func(p *Provider) {
+		p.envPrefix = prefix
+	}
+}
+
 func WithValue(key string, value interface{}) OptionModifier {
 	return func(p *Provider) {
 		p.forcedValues = append(p.forcedValues, tuple{Key: key, Value: value})
@@ -29,6 +29,15 @@ func NewPFlagProvider(rawSchema []byte, schema *jsonschema.Schema, f *pflag.Flag
 	}, nil
 }
 
+// withKoanf returns a copy of the provider that only falls back to flag defaults
+// for keys that are not already set in k.
+func (p *PFlagProvider) withKoanf(f *pflag.FlagSet, k *koanf.Koanf) *PFlagProvider {
+	return &PFlagProvider{
+		p:     posflag.Provider(f, ".", k),
+		paths: p.paths,
+	}
+}
+
 func (p *PFlagProvider) ReadBytes() ([]byte, error) {
 	return nil, errors.New("pflag provider does not support this method")
 }
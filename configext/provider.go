@@ -7,6 +7,7 @@ import (
 	"github.com/aesoper101/x/watcherext"
 	"github.com/aesoper101/x/zaputil"
 	"github.com/inhies/go-bytesize"
+	"github.com/knadh/koanf/maps"
 	"github.com/knadh/koanf/parsers/json"
 	"github.com/knadh/koanf/providers/posflag"
 	"github.com/knadh/koanf/v2"
@@ -16,6 +17,7 @@ import (
 	"go.uber.org/zap"
 	"net/url"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 )
@@ -43,6 +45,7 @@ type Provider struct {
 
 	skipValidation    bool
 	disableEnvLoading bool
+	envPrefix         string
 
 	logger *zap.Logger
 
@@ -53,6 +56,9 @@ type Provider struct {
 const (
 	FlagConfig = "config"
 	Delimiter  = "."
+
+	// RedactedValue replaces the values of omitted keys in Redacted.
+	RedactedValue = "[REDACTED]"
 )
 
 // RegisterConfigFlag registers the "--config" flag on pflag.FlagSet.
@@ -218,7 +224,7 @@ func (p *Provider) createEnvProvider() (koanf.Provider, error) {
 		return nil, nil
 	}
 
-	envProvider, err := NewKoanfEnv("", p.schema, p.validator)
+	envProvider, err := NewKoanfEnv(p.envPrefix, p.schema, p.validator)
 	if err != nil {
 		return nil, err
 	}
@@ -277,8 +283,11 @@ func (p *Provider) newKoanf() (_ *koanf.Koanf, err error) {
 	for _, provider := range p.providers {
 		// posflag.Posflag requires access to Koanf instance so we recreate the provider here which is a workaround
 		// for posflag.Provider's API.
-		if _, ok := provider.(*posflag.Posflag); ok {
+		switch t := provider.(type) {
+		case *posflag.Posflag:
 			provider = posflag.Provider(p.flags, ".", k)
+		case *PFlagProvider:
+			provider = t.withKoanf(p.flags, k)
 		}
 
 		var opts []koanf.Option
@@ -536,6 +545,34 @@ func (p *Provider) GetF(key string, fallback interface{}) (val interface{}) {
 	return p.Get(key)
 }
 
+// Redacted returns the effective configuration as a nested map.
+//
+// The values of keys that have a path component containing any of the keys set
+// with OmitKeysFromTracing, case-insensitively, are replaced by RedactedValue.
+func (p *Provider) Redacted() map[string]interface{} {
+	p.l.RLock()
+	defer p.l.RUnlock()
+
+	values := p.All()
+	for key := range values {
+		if p.isOmittedKey(key) {
+			values[key] = RedactedValue
+		}
+	}
+	return maps.Unflatten(values, Delimiter)
+}
+
+func (p *Provider) isOmittedKey(key string) bool {
+	for _, component := range strings.Split(strings.ToLower(key), Delimiter) {
+		for _, omitted := range p.excludeFieldsFromTracing {
+			if omitted != "" && strings.Contains(component, strings.ToLower(omitted)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (p *Provider) RequestURIF(path string, fallback *url.URL) *url.URL {
 	p.l.RLock()
 	defer p.l.RUnlock()
@@ -1,6 +1,15 @@
 package jsonschemaext
 
-import "github.com/santhosh-tekuri/jsonschema/v6"
+import (
+	"errors"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"strings"
+)
+
+var printer = message.NewPrinter(language.English)
 
 // ErrorType is the schema error type.
 type ErrorType int
@@ -33,3 +42,64 @@ func NewFromSanthoshError(validationError jsonschema.ValidationError) *Error {
 		// DocumentFieldName: JSONPointerToDotNotation(validationError.InstancePtr),
 	}
 }
+
+// FieldError is a validation error of a single field of a document.
+type FieldError struct {
+	// DocumentPointer is the JSON Pointer in the document.
+	DocumentPointer string
+
+	// DocumentFieldName is a pointer to the document in dot-notation: fo.bar.baz
+	DocumentFieldName string
+
+	// Message describes why the field is invalid.
+	Message string
+}
+
+// NewFieldErrors returns the errors of the fields of a
+// github.com/santhosh-tekuri/jsonschema.ValidationError in err, ordered as in
+// the ValidationError, or nil if err has no ValidationError.
+//
+// A missing required property is reported as an error of that property, and
+// not of the object that lacks it.
+func NewFieldErrors(err error) []FieldError {
+	var validationError *jsonschema.ValidationError
+	if !errors.As(err, &validationError) {
+		return nil
+	}
+	var fieldErrors []FieldError
+	var visit func(validationError *jsonschema.ValidationError)
+	visit = func(validationError *jsonschema.ValidationError) {
+		if len(validationError.Causes) > 0 {
+			for _, cause := range validationError.Causes {
+				visit(cause)
+			}
+			return
+		}
+		if required, ok := validationError.ErrorKind.(*kind.Required); ok {
+			for _, missing := range required.Missing {
+				location := append(append([]string(nil), validationError.InstanceLocation...), missing)
+				fieldErrors = append(fieldErrors, newFieldError(location, "is required"))
+			}
+			return
+		}
+		fieldErrors = append(
+			fieldErrors,
+			newFieldError(validationError.InstanceLocation, validationError.ErrorKind.LocalizedString(printer)),
+		)
+	}
+	visit(validationError)
+	return fieldErrors
+}
+
+func newFieldError(location []string, message string) FieldError {
+	var pointer strings.Builder
+	for _, token := range location {
+		pointer.WriteByte('/')
+		pointer.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return FieldError{
+		DocumentPointer:   pointer.String(),
+		DocumentFieldName: strings.Join(location, "."),
+		Message:           message,
+	}
+}
@@ -0,0 +1,52 @@
+package jsonschemaext
+
+import (
+	"errors"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestNewFieldErrors(t *testing.T) {
+	schema, err := jsonschema.UnmarshalJSON(
+		strings.NewReader(
+			`{
+				"type": "object",
+				"required": ["name", "a/b"],
+				"properties": {
+					"name": {"type": "string"},
+					"age": {"type": "integer", "minimum": 0},
+					"address": {
+						"type": "object",
+						"properties": {"zip": {"type": "string", "maxLength": 5}}
+					}
+				}
+			}`,
+		),
+	)
+	require.NoError(t, err)
+	compiler := jsonschema.NewCompiler()
+	require.NoError(t, compiler.AddResource("test.json", schema))
+	validator, err := compiler.Compile("test.json")
+	require.NoError(t, err)
+
+	document, err := jsonschema.UnmarshalJSON(strings.NewReader(`{"age": -1, "address": {"zip": "123456"}}`))
+	require.NoError(t, err)
+	fieldErrors := NewFieldErrors(validator.Validate(document))
+	require.Len(t, fieldErrors, 4)
+	assert.ElementsMatch(
+		t,
+		[]FieldError{
+			{DocumentPointer: "/name", DocumentFieldName: "name", Message: "is required"},
+			{DocumentPointer: "/a~1b", DocumentFieldName: "a/b", Message: "is required"},
+			{DocumentPointer: "/age", DocumentFieldName: "age", Message: "minimum: got -1, want 0"},
+			{DocumentPointer: "/address/zip", DocumentFieldName: "address.zip", Message: "maxLength: got 6, want 5"},
+		},
+		fieldErrors,
+	)
+
+	assert.Nil(t, NewFieldErrors(errors.New("other")))
+	assert.Nil(t, NewFieldErrors(nil))
+}
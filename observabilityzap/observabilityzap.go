@@ -23,3 +23,9 @@ func Start(logger *zap.Logger) (trace.TracerProvider, io.Closer) {
 	otel.SetTextMapPropagator(propagation.TraceContext{})
 	return tracerProvider, newTracerProviderCloser(tracerProvider)
 }
+
+// NewExporter returns a new span exporter that logs sampled spans to the logger
+// at debug level.
+func NewExporter(logger *zap.Logger) sdktrace.SpanExporter {
+	return newZapExporter(logger)
+}
@@ -0,0 +1,84 @@
+package stringutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want int
+	}{
+		{
+			name: "both empty",
+			a:    "",
+			b:    "",
+			want: 0,
+		},
+		{
+			name: "first empty",
+			a:    "",
+			b:    "abc",
+			want: 3,
+		},
+		{
+			name: "second empty",
+			a:    "abc",
+			b:    "",
+			want: 3,
+		},
+		{
+			name: "identical",
+			a:    "build",
+			b:    "build",
+			want: 0,
+		},
+		{
+			name: "substitution",
+			a:    "kitten",
+			b:    "sitten",
+			want: 1,
+		},
+		{
+			name: "insertions and deletions",
+			a:    "kitten",
+			b:    "sitting",
+			want: 3,
+		},
+		{
+			name: "transposition",
+			a:    "bulid",
+			b:    "build",
+			want: 2,
+		},
+		{
+			name: "multi-byte runes",
+			a:    "héllo",
+			b:    "hello",
+			want: 1,
+		},
+		{
+			name: "multi-byte runes only",
+			a:    "日本語",
+			b:    "日本",
+			want: 1,
+		},
+		{
+			name: "identical multi-byte runes",
+			a:    "日本語",
+			b:    "日本語",
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.want, Levenshtein(tt.a, tt.b))
+				assert.Equal(t, tt.want, Levenshtein(tt.b, tt.a))
+			},
+		)
+	}
+}
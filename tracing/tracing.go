@@ -63,6 +63,15 @@ func WithAttributes(attributes ...attribute.KeyValue) StartOption {
 	}
 }
 
+// WithSpanKind sets the span kind.
+//
+// The default is trace.SpanKindInternal.
+func WithSpanKind(spanKind trace.SpanKind) StartOption {
+	return func(startOptions *startOptions) {
+		startOptions.spanKind = spanKind
+	}
+}
+
 // *** PRIVATE ***
 
 type tracer struct {
@@ -88,6 +97,9 @@ func (t *tracer) Start(ctx context.Context, options ...StartOption) (context.Con
 		spanName = spanName + "-" + startOptions.spanNameSuffix
 	}
 	var spanStartOptions []trace.SpanStartOption
+	if startOptions.spanKind != trace.SpanKindUnspecified {
+		spanStartOptions = append(spanStartOptions, trace.WithSpanKind(startOptions.spanKind))
+	}
 	if len(startOptions.attributes) > 0 {
 		spanStartOptions = append(
 			spanStartOptions,
@@ -127,6 +139,7 @@ type startOptions struct {
 	spanNameSuffix string
 	errAddr        *error
 	attributes     []attribute.KeyValue
+	spanKind       trace.SpanKind
 }
 
 func newStartOptions() *startOptions {
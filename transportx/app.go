@@ -5,21 +5,34 @@ package transportx
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/aesoper101/x/interrupt"
 	"github.com/aesoper101/x/uuidutil"
 	"github.com/aesoper101/x/zaputil"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
 	"net/url"
 	"sync"
 	"time"
 )
 
+// defaultHookTimeout is the default timeout of each BeforeStart, AfterStart,
+// BeforeStop, and AfterStop hook.
+const defaultHookTimeout = 30 * time.Second
+
 type Server interface {
 	Start(context.Context) error
 	Stop(context.Context) error
 }
 
+// Endpointer is implemented by servers that publish their endpoint.
+//
+// The runner adds the endpoints of its servers to the Endpoints of its AppInfo
+// before the servers are started.
+type Endpointer interface {
+	Endpoint() (*url.URL, error)
+}
+
 type Runner interface {
 	Run() error
 	Stop() error
@@ -30,13 +43,15 @@ type AppInfo interface {
 	Name() string
 	Version() string
 	Metadata() map[string]string
+	Endpoints() []*url.URL
 }
 
 type appInfo struct {
-	id       string
-	name     string
-	version  string
-	metadata map[string]string
+	id        string
+	name      string
+	version   string
+	metadata  map[string]string
+	endpoints []*url.URL
 }
 
 // ID returns app instance id.
@@ -51,6 +66,9 @@ func (app *appInfo) Version() string { return app.version }
 // Metadata returns service metadata.
 func (app *appInfo) Metadata() map[string]string { return app.metadata }
 
+// Endpoints returns service endpoints.
+func (app *appInfo) Endpoints() []*url.URL { return app.endpoints }
+
 type runner struct {
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -65,14 +83,23 @@ type runner struct {
 	endpoints []*url.URL
 
 	stopTimeout time.Duration
+	hookTimeout time.Duration
 
 	beforeStart []func(context.Context) error
 	beforeStop  []func(context.Context) error
 	afterStart  []func(context.Context) error
 	afterStop   []func(context.Context) error
 
-	servers []Server
+	servers []*serverEntry
+
+	health *Health
+	events *Events
 
+	registrar        Registrar
+	registrarTimeout time.Duration
+	instance         *ServiceInstance
+
+	stopLock   sync.Mutex
 	hasStopped bool
 }
 
@@ -82,6 +109,11 @@ func newRunner(opts ...RunOption) *runner {
 		logger: zaputil.NewLogger(),
 
 		stopTimeout: time.Second * 10,
+		hookTimeout: defaultHookTimeout,
+		health:      NewHealth(),
+		events:      NewEvents(),
+
+		registrarTimeout: defaultRegistrarTimeout,
 	}
 
 	if id, err := uuidutil.New(); err == nil {
@@ -92,12 +124,7 @@ func newRunner(opts ...RunOption) *runner {
 		opt(app)
 	}
 
-	app.appInfo = &appInfo{
-		id:       app.id,
-		name:     app.name,
-		version:  app.version,
-		metadata: app.metadata,
-	}
+	app.appInfo = app.newAppInfo(app.endpoints)
 
 	ctx, cancel := interrupt.WithCancel(app.ctx)
 	app.ctx, app.cancel = ctx, cancel
@@ -106,70 +133,103 @@ func newRunner(opts ...RunOption) *runner {
 }
 
 func (app *runner) Run() (err error) {
+	app.events.Publish(Event{Type: EventStarting})
+	defer func() {
+		app.events.Publish(Event{Type: EventStopped, Err: err})
+	}()
+
+	entries, err := sortServerEntries(app.servers)
+	if err != nil {
+		return err
+	}
+	if err = app.resolveEndpoints(); err != nil {
+		return app.abort(nil, err)
+	}
+	for _, entry := range app.servers {
+		if worker, ok := entry.server.(*workerServer); ok {
+			// A failed worker does not stop the runner, so it is reported by the liveness check.
+			worker.logger = app.logger
+			app.health.RegisterLiveness(entry.name, worker.HealthCheck)
+			app.health.RegisterDetails(entry.name, func() any { return worker.Status() })
+			continue
+		}
+		if checker, ok := entry.server.(HealthChecker); ok {
+			app.health.RegisterReadiness(entry.name, checker.HealthCheck)
+		}
+	}
 	sctx := NewContext(app.ctx, app.appInfo)
-	eg, ctx := errgroup.WithContext(sctx)
-	wg := sync.WaitGroup{}
 
-	for _, fn := range app.beforeStart {
-		if err = fn(sctx); err != nil {
-			return err
+	if err = app.runHooks(sctx, "before start", app.beforeStart, true); err != nil {
+		return app.abort(nil, err)
+	}
+
+	// Servers are started in dependency order, each once the servers it depends on are ready.
+	exitedC := make(chan *serverEntry, len(entries))
+	started := make([]*serverEntry, 0, len(entries))
+	for _, entry := range entries {
+		err = entry.start(app.ctx, sctx, exitedC)
+		started = append(started, entry)
+		if err != nil {
+			app.events.Publish(Event{Type: EventServerFailed, Server: entry.name, Err: err})
+			return app.abort(started, err)
 		}
 	}
 
-	for _, srv := range app.servers {
-		srv := srv
-		eg.Go(
-			func() error {
-				<-ctx.Done() // wait for stop signal
-				stopCtx, cancel := context.WithTimeout(NewContext(app.ctx, app.appInfo), app.stopTimeout)
-				defer cancel()
-				return srv.Stop(stopCtx)
-			},
-		)
-		wg.Add(1)
-		eg.Go(
-			func() error {
-				wg.Done() // here is to ensure server start has begun running before register, so defer is not needed
-				startCtx := NewContext(app.ctx, app.appInfo)
-				return srv.Start(startCtx)
-			},
-		)
-	}
-	wg.Wait()
-
-	for _, fn := range app.afterStart {
-		if err = fn(sctx); err != nil {
-			return err
+	if app.registrar != nil {
+		instance := NewServiceInstance(app.appInfo)
+		rctx, rcancel := context.WithTimeout(sctx, app.registrarTimeout)
+		defer rcancel()
+		if err = app.registrar.Register(rctx, instance); err != nil {
+			return app.abort(started, err)
 		}
+		app.instance = instance
 	}
 
-	eg.Go(
-		func() error {
-			select {
-			case <-app.ctx.Done():
-				return app.Stop()
-			}
-		},
-	)
-	if err = eg.Wait(); err != nil && !errors.Is(err, context.Canceled) {
-		return err
+	if err = app.runHooks(sctx, "after start", app.afterStart, true); err != nil {
+		return multierr.Append(err, app.shutdown(started))
 	}
-	err = nil
-	for _, fn := range app.afterStop {
-		err = fn(sctx)
+	app.health.SetReady(true)
+	app.events.Publish(Event{Type: EventStarted})
+
+	// Run until stopped, or until a server fails.
+	var runErr error
+	for runErr == nil && app.ctx.Err() == nil {
+		select {
+		case <-app.ctx.Done():
+		case entry := <-exitedC:
+			if entry.err != nil && !errors.Is(entry.err, context.Canceled) {
+				runErr = fmt.Errorf("server %s failed: %w", entry.name, entry.err)
+				app.events.Publish(Event{Type: EventServerFailed, Server: entry.name, Err: entry.err})
+			}
+		}
 	}
-	return err
+	err = multierr.Append(runErr, app.shutdown(started))
+
+	// The runner context is canceled by now.
+	stopCtx := NewContext(context.WithoutCancel(app.ctx), app.appInfo)
+	return multierr.Append(err, app.runHooks(stopCtx, "after stop", app.afterStop, false))
 }
 
 func (app *runner) Stop() (err error) {
+	app.stopLock.Lock()
+	defer app.stopLock.Unlock()
 	if app.hasStopped {
 		app.logger.Warn("runner has stopped")
 		return nil
 	}
 
-	sctx := NewContext(app.ctx, app.appInfo)
-	for _, fn := range app.beforeStop {
-		err = fn(sctx)
+	app.events.Publish(Event{Type: EventStopping})
+	// Stop receiving traffic before anything is stopped.
+	app.health.SetReady(false)
+
+	// The runner context may already be canceled.
+	sctx := NewContext(context.WithoutCancel(app.ctx), app.appInfo)
+	err = app.runHooks(sctx, "before stop", app.beforeStop, false)
+
+	if app.registrar != nil && app.instance != nil {
+		rctx, rcancel := context.WithTimeout(sctx, app.registrarTimeout)
+		defer rcancel()
+		err = multierr.Append(err, app.registrar.Deregister(rctx, app.instance))
 	}
 
 	if app.cancel != nil {
@@ -182,6 +242,125 @@ func (app *runner) Stop() (err error) {
 	return err
 }
 
+// shutdown stops the runner, and then the started servers.
+func (app *runner) shutdown(started []*serverEntry) error {
+	err := app.Stop()
+	return multierr.Append(err, app.stopServers(started))
+}
+
+// abort stops the started servers after a failed start, and the servers that
+// were not started but whose endpoint was resolved, which may hold a listener.
+func (app *runner) abort(started []*serverEntry, err error) error {
+	app.events.Publish(Event{Type: EventStopping})
+	app.cancel()
+	var unstarted []*serverEntry
+	for _, entry := range app.servers {
+		if entry.resolved && entry.doneC == nil {
+			unstarted = append(unstarted, entry)
+		}
+	}
+	// The started servers are stopped first, in reverse order.
+	return multierr.Append(err, app.stopServers(append(unstarted, started...)))
+}
+
+// stopServers stops the servers in the reverse order they were started.
+//
+// Every server is stopped, even if stopping an earlier server fails.
+func (app *runner) stopServers(started []*serverEntry) error {
+	// The runner context is canceled by now.
+	stopCtx := NewContext(context.WithoutCancel(app.ctx), app.appInfo)
+	var err error
+	for i := len(started) - 1; i >= 0; i-- {
+		entry := started[i]
+		if stopErr := entry.stop(stopCtx, app.stopTimeout); stopErr != nil {
+			app.logger.Error("server failed to stop", zap.String("server", entry.name), zap.Error(stopErr))
+			err = multierr.Append(err, stopErr)
+		}
+	}
+	return err
+}
+
+// runHooks runs the hooks in order, each with the hook timeout.
+//
+// If stopOnError is set, the hooks after a failed hook are not run. Otherwise
+// all hooks are run, and their errors are combined.
+func (app *runner) runHooks(
+	ctx context.Context,
+	kind string,
+	hooks []func(context.Context) error,
+	stopOnError bool,
+) error {
+	var err error
+	for i, fn := range hooks {
+		hookErr := app.runHook(ctx, kind, i, fn)
+		if hookErr == nil {
+			continue
+		}
+		if stopOnError {
+			return hookErr
+		}
+		app.logger.Error("hook failed", zap.String("hook", kind), zap.Int("index", i), zap.Error(hookErr))
+		err = multierr.Append(err, hookErr)
+	}
+	return err
+}
+
+// runHook runs the hook with the hook timeout.
+//
+// A hook that does not return within the timeout is left running, and an
+// error that wraps context.DeadlineExceeded is returned in its place.
+func (app *runner) runHook(ctx context.Context, kind string, index int, fn func(context.Context) error) error {
+	if app.hookTimeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, app.hookTimeout)
+	defer cancel()
+	errC := make(chan error, 1)
+	go func() {
+		errC <- fn(ctx)
+	}()
+	// The hook is waited for if the runner is stopped while it runs, as
+	// without a timeout, but not after its own timeout.
+	timer := time.NewTimer(app.hookTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-errC:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%s hook %d did not return within %v: %w", kind, index, app.hookTimeout, context.DeadlineExceeded)
+	}
+}
+
+// resolveEndpoints adds the endpoints of the servers to the AppInfo.
+func (app *runner) resolveEndpoints() error {
+	endpoints := app.endpoints
+	for _, entry := range app.servers {
+		endpointer, ok := entry.server.(Endpointer)
+		if !ok {
+			continue
+		}
+		// The endpoint may be resolved by binding the listener, even if it fails.
+		entry.resolved = true
+		endpoint, err := endpointer.Endpoint()
+		if err != nil {
+			return err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	app.appInfo = app.newAppInfo(endpoints)
+	return nil
+}
+
+func (app *runner) newAppInfo(endpoints []*url.URL) *appInfo {
+	return &appInfo{
+		id:        app.id,
+		name:      app.name,
+		version:   app.version,
+		metadata:  app.metadata,
+		endpoints: endpoints,
+	}
+}
+
 func Run(opts ...RunOption) error {
 	app := newRunner(opts...)
 	return app.Run()
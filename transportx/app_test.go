@@ -2,8 +2,10 @@ package transportx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/aesoper101/x/interrupt"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 	"testing"
@@ -70,3 +72,66 @@ func TestRun(t *testing.T) {
 	)
 	require.NoError(t, err)
 }
+
+func TestRunHookTimeout(t *testing.T) {
+	err := Run(
+		WithContext(context.Background()),
+		WithHookTimeout(10*time.Millisecond),
+		BeforeStart(
+			func(ctx context.Context) error {
+				<-ctx.Done()
+				// Returning after the timeout does not replace the timeout error.
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			},
+		),
+	)
+	require.EqualError(t, err, "before start hook 0 did not return within 10ms: context deadline exceeded")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRunStopHookErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stopped []string
+	err := Run(
+		WithContext(ctx),
+		WithHookTimeout(10*time.Millisecond),
+		AfterStart(
+			func(context.Context) error {
+				cancel()
+				return nil
+			},
+		),
+		BeforeStop(
+			func(ctx context.Context) error {
+				// The stop hooks are run after the runner context is canceled.
+				require.NoError(t, ctx.Err())
+				stopped = append(stopped, "before stop 0")
+				return errors.New("flush failed")
+			},
+			func(ctx context.Context) error {
+				stopped = append(stopped, "before stop 1")
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		),
+		AfterStop(
+			func(context.Context) error {
+				stopped = append(stopped, "after stop 0")
+				return errors.New("close failed")
+			},
+			func(context.Context) error {
+				stopped = append(stopped, "after stop 1")
+				return nil
+			},
+		),
+	)
+	assert.EqualError(
+		t,
+		err,
+		"flush failed; before stop hook 1 did not return within 10ms: context deadline exceeded; close failed",
+	)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []string{"before stop 0", "before stop 1", "after stop 0", "after stop 1"}, stopped)
+}
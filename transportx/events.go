@@ -0,0 +1,112 @@
+package transportx
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType is the type of a lifecycle Event of the runner.
+type EventType string
+
+const (
+	// EventStarting is published when the runner begins to run.
+	EventStarting EventType = "starting"
+	// EventStarted is published once all servers are ready and the AfterStart
+	// hooks have succeeded.
+	EventStarted EventType = "started"
+	// EventStopping is published when the runner begins to stop.
+	EventStopping EventType = "stopping"
+	// EventStopped is published when Run returns, with the error it returns.
+	EventStopped EventType = "stopped"
+	// EventServerFailed is published when a server fails to start, or returns
+	// an error while the runner is running.
+	EventServerFailed EventType = "server-failed"
+)
+
+// Event is a lifecycle event of the runner.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Server is the name of the server of an EventServerFailed.
+	Server string
+	// Err is the error of an EventServerFailed or EventStopped, if any.
+	Err error
+}
+
+// Events publishes the lifecycle events of the runner to its subscriptions.
+//
+// Events are published without blocking the runner, so events are dropped for
+// subscriptions that do not keep up.
+type Events struct {
+	lock          sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// Subscription receives the events published after it was subscribed.
+type Subscription struct {
+	events  *Events
+	c       chan Event
+	dropped atomic.Uint64
+}
+
+// NewEvents returns a new Events without subscriptions.
+func NewEvents() *Events {
+	return &Events{
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe returns a Subscription that buffers up to buffer events.
+//
+// The Subscription must be closed once it is no longer read.
+func (e *Events) Subscribe(buffer int) *Subscription {
+	s := &Subscription{
+		events: e,
+		c:      make(chan Event, max(buffer, 0)),
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.subscriptions[s] = struct{}{}
+	return s
+}
+
+// Publish sends the event to all subscriptions, and drops it for the
+// subscriptions whose buffer is full.
+func (e *Events) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	for s := range e.subscriptions {
+		select {
+		case s.c <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// C returns the channel of the events, which is closed by Close.
+func (s *Subscription) C() <-chan Event {
+	return s.c
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops the Subscription from receiving events, and closes its channel.
+//
+// Calling Close more than once has no effect.
+func (s *Subscription) Close() {
+	s.events.lock.Lock()
+	defer s.events.lock.Unlock()
+	if _, ok := s.events.subscriptions[s]; !ok {
+		return
+	}
+	delete(s.events.subscriptions, s)
+	close(s.c)
+}
@@ -0,0 +1,90 @@
+package transportx
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	events := NewEvents()
+	subscription := events.Subscribe(1)
+	events.Publish(Event{Type: EventStarting})
+	events.Publish(Event{Type: EventStarted})
+	event := <-subscription.C()
+	assert.Equal(t, EventStarting, event.Type)
+	assert.False(t, event.Time.IsZero())
+	// The second event is dropped, since the buffer is full.
+	assert.Equal(t, uint64(1), subscription.Dropped())
+
+	subscription.Close()
+	subscription.Close()
+	_, ok := <-subscription.C()
+	assert.False(t, ok)
+	events.Publish(Event{Type: EventStopping})
+	assert.Equal(t, uint64(1), subscription.Dropped())
+}
+
+func TestRunEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := NewEvents()
+	subscription := events.Subscribe(10)
+	defer subscription.Close()
+	err := Run(
+		WithContext(ctx),
+		WithEvents(events),
+		WithServer("api", newTestServer("api", &testEvents{})),
+		AfterStart(
+			func(context.Context) error {
+				cancel()
+				return nil
+			},
+		),
+	)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]EventType{EventStarting, EventStarted, EventStopping, EventStopped},
+		testEventTypes(subscription),
+	)
+}
+
+func TestRunEventsServerFailed(t *testing.T) {
+	events := NewEvents()
+	subscription := events.Subscribe(10)
+	defer subscription.Close()
+	api := newTestServer("api", &testEvents{})
+	api.readyAfter = -1
+	err := Run(
+		WithContext(context.Background()),
+		WithEvents(events),
+		WithServer("database", newTestServer("database", &testEvents{})),
+		WithServer("api", api, DependsOn("database"), ServerStartTimeout(10*time.Millisecond)),
+	)
+	require.EqualError(t, err, "server api was not ready within 10ms")
+
+	var received []Event
+	for len(subscription.C()) > 0 {
+		received = append(received, <-subscription.C())
+	}
+	require.Len(t, received, 4)
+	assert.Equal(t, EventStarting, received[0].Type)
+	assert.Equal(t, EventServerFailed, received[1].Type)
+	assert.Equal(t, "api", received[1].Server)
+	assert.EqualError(t, received[1].Err, "server api was not ready within 10ms")
+	assert.Equal(t, EventStopping, received[2].Type)
+	assert.Equal(t, EventStopped, received[3].Type)
+	assert.True(t, errors.Is(received[3].Err, received[1].Err))
+}
+
+func testEventTypes(subscription *Subscription) []EventType {
+	var types []EventType
+	for len(subscription.C()) > 0 {
+		types = append(types, (<-subscription.C()).Type)
+	}
+	return types
+}
@@ -0,0 +1,295 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/aesoper101/x/transportx"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var defaultConvertErrorFunc ConvertErrorFunc = func(err error) errorsext.Error {
+	return errorsext.ThrowUnknown(err, "", err.Error()).(errorsext.Error)
+}
+
+// SetDefaultConvertErrorFunc sets the function that converts errors that are
+// neither errorsext errors nor gRPC status errors.
+func SetDefaultConvertErrorFunc(f ConvertErrorFunc) {
+	defaultConvertErrorFunc = f
+}
+
+type ConvertErrorFunc func(err error) errorsext.Error
+
+// NewStatus returns the gRPC status of the error.
+//
+// The code is derived from the errorsext class of the error. The reason is set
+// on an ErrorInfo detail in the domain, with the details of the error as its
+// metadata, and the details are added as a structpb.Struct detail too, so that
+// NewErrorFromStatus restores them with their JSON types. The reason and
+// message of internal and unknown errors are not exposed.
+//
+// A gRPC status error is returned as is, and context errors are converted to
+// the Canceled and DeadlineExceeded codes.
+func NewStatus(err error, domain string) *status.Status {
+	if err == nil {
+		return status.New(codes.OK, "")
+	}
+	var errX errorsext.Error
+	if !errors.As(err, &errX) {
+		if st, ok := status.FromError(err); ok {
+			return st
+		}
+		switch {
+		case errors.Is(err, context.Canceled):
+			return status.New(codes.Canceled, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return status.New(codes.DeadlineExceeded, err.Error())
+		}
+		errX = defaultConvertErrorFunc(err)
+	}
+	code, reason, message, details := codes.Unknown, errX.Reason(), errX.Message(), errX.Details()
+	switch {
+	case errorsext.IsErrorAlreadyExists(errX):
+		code = codes.AlreadyExists
+	case errorsext.IsDeadlineExceeded(errX):
+		code = codes.DeadlineExceeded
+	case errorsext.IsErrorInvalidArgument(errX):
+		code = codes.InvalidArgument
+	case errorsext.IsNotFound(errX):
+		code = codes.NotFound
+	case errorsext.IsPreconditionFailed(errX):
+		code = codes.FailedPrecondition
+	case errorsext.IsResourceExhausted(errX):
+		code = codes.ResourceExhausted
+	case errorsext.IsUnauthenticated(errX):
+		code = codes.Unauthenticated
+	case errorsext.IsUnavailable(errX):
+		code = codes.Unavailable
+	case errorsext.IsUnimplemented(errX):
+		code = codes.Unimplemented
+	case errorsext.IsPermissionDenied(errX):
+		code = codes.PermissionDenied
+	case errorsext.IsInternal(errX):
+		code = codes.Internal
+		// 为了安全，不应该将内部错误暴露给用户
+		reason = "InternalError"
+		message = "oops, something went wrong"
+		details = nil
+	default:
+		// 为了安全，不应该将内部错误暴露给用户
+		reason = "UnknownError"
+		message = "oops, something went wrong"
+		details = nil
+	}
+	st := status.New(code, message)
+	if reason == "" && len(details) == 0 {
+		return st
+	}
+	statusDetails := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{
+			Reason:   reason,
+			Domain:   domain,
+			Metadata: newErrorInfoMetadata(details),
+		},
+	}
+	if detailsStruct := newDetailsStruct(details); detailsStruct != nil {
+		statusDetails = append(statusDetails, detailsStruct)
+	}
+	withDetails, err := st.WithDetails(statusDetails...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// NewErrorFromStatus returns the errorsext error of the gRPC status, with the
+// reason and details of its ErrorInfo detail.
+//
+// The details are those of the structpb.Struct detail, if any, so that the
+// details of a NewStatus keep their JSON types. Otherwise, they are the
+// metadata of the ErrorInfo.
+func NewErrorFromStatus(st *status.Status) error {
+	if st.Code() == codes.OK {
+		return nil
+	}
+	var throw func(cause error, reason, message string) error
+	var cause error
+	switch st.Code() {
+	case codes.AlreadyExists:
+		throw = errorsext.ThrowAlreadyExists
+	case codes.DeadlineExceeded:
+		throw = errorsext.ThrowDeadlineExceeded
+		cause = context.DeadlineExceeded
+	case codes.InvalidArgument, codes.OutOfRange:
+		throw = errorsext.ThrowInvalidArgument
+	case codes.NotFound:
+		throw = errorsext.ThrowNotFound
+	case codes.FailedPrecondition, codes.Aborted:
+		throw = errorsext.ThrowPreconditionFailed
+	case codes.ResourceExhausted:
+		throw = errorsext.ThrowResourceExhausted
+	case codes.Unauthenticated:
+		throw = errorsext.ThrowUnauthenticated
+	case codes.Unavailable:
+		throw = errorsext.ThrowUnavailable
+	case codes.Unimplemented:
+		throw = errorsext.ThrowUnimplemented
+	case codes.PermissionDenied:
+		throw = errorsext.ThrowPermissionDenied
+	case codes.Internal, codes.DataLoss:
+		throw = errorsext.ThrowInternal
+	case codes.Canceled:
+		throw = errorsext.ThrowUnknown
+		cause = context.Canceled
+	default:
+		throw = errorsext.ThrowUnknown
+	}
+	var reason string
+	var details map[string]interface{}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			reason = detail.GetReason()
+			if details == nil && len(detail.GetMetadata()) > 0 {
+				details = make(map[string]interface{}, len(detail.GetMetadata()))
+				for key, value := range detail.GetMetadata() {
+					details[key] = value
+				}
+			}
+		case *structpb.Struct:
+			details = detail.AsMap()
+		}
+	}
+	err := throw(cause, reason, st.Message())
+	if len(details) > 0 {
+		err.(errorsext.Error).WithDetails(details)
+	}
+	return err
+}
+
+// UnaryServerErrorInterceptor returns a grpc.UnaryServerInterceptor that
+// converts the errors of handlers to gRPC status errors with NewStatus.
+//
+// The domain of the ErrorInfo is the name of the transportx.AppInfo in the
+// context, if any.
+func UnaryServerErrorInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, NewStatus(err, getErrorDomain(ctx)).Err()
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerErrorInterceptor returns a grpc.StreamServerInterceptor that
+// converts the errors of handlers to gRPC status errors with NewStatus.
+func StreamServerErrorInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := handler(srv, ss); err != nil {
+			return NewStatus(err, getErrorDomain(ss.Context())).Err()
+		}
+		return nil
+	}
+}
+
+// UnaryClientErrorInterceptor returns a grpc.UnaryClientInterceptor that
+// converts gRPC status errors to errorsext errors with NewErrorFromStatus.
+func UnaryClientErrorInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return convertStatusError(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
+
+// StreamClientErrorInterceptor returns a grpc.StreamClientInterceptor that
+// converts gRPC status errors to errorsext errors with NewErrorFromStatus.
+//
+// The io.EOF at the end of a stream is returned as is.
+func StreamClientErrorInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, convertStatusError(err)
+		}
+		return &errorClientStream{ClientStream: stream}, nil
+	}
+}
+
+type errorClientStream struct {
+	grpc.ClientStream
+}
+
+func (s *errorClientStream) SendMsg(m any) error {
+	return convertStatusError(s.ClientStream.SendMsg(m))
+}
+
+func (s *errorClientStream) RecvMsg(m any) error {
+	return convertStatusError(s.ClientStream.RecvMsg(m))
+}
+
+func convertStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var grpcStatus interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcStatus) {
+		return err
+	}
+	return NewErrorFromStatus(grpcStatus.GRPCStatus())
+}
+
+func getErrorDomain(ctx context.Context) string {
+	if appInfo, ok := transportx.FromContext(ctx); ok {
+		return appInfo.Name()
+	}
+	return ""
+}
+
+// newErrorInfoMetadata returns the details as strings, with the values that
+// are not strings encoded as JSON.
+func newErrorInfoMetadata(details map[string]interface{}) map[string]string {
+	if len(details) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(details))
+	for key, value := range details {
+		if s, ok := value.(string); ok {
+			metadata[key] = s
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(data)
+	}
+	return metadata
+}
+
+// newDetailsStruct returns the details as a structpb.Struct, or nil if there
+// are none or they cannot be encoded as JSON.
+func newDetailsStruct(details map[string]interface{}) *structpb.Struct {
+	if len(details) == 0 {
+		return nil
+	}
+	// Convert the details to JSON types, such as structs to maps.
+	data, err := json.Marshal(details)
+	if err != nil {
+		return nil
+	}
+	var jsonDetails map[string]interface{}
+	if err := json.Unmarshal(data, &jsonDetails); err != nil {
+		return nil
+	}
+	detailsStruct, err := structpb.NewStruct(jsonDetails)
+	if err != nil {
+		return nil
+	}
+	return detailsStruct
+}
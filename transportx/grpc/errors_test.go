@@ -0,0 +1,124 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+	details := map[string]interface{}{"field": "name", "count": float64(2)}
+	for _, tc := range []struct {
+		name  string
+		err   error
+		code  codes.Code
+		check func(error) bool
+	}{
+		{"already exists", errorsext.ThrowAlreadyExists(nil, "UserExists", "user exists"), codes.AlreadyExists, errorsext.IsErrorAlreadyExists},
+		{"deadline exceeded", errorsext.ThrowDeadlineExceeded(nil, "Timeout", "too slow"), codes.DeadlineExceeded, errorsext.IsDeadlineExceeded},
+		{"invalid argument", errorsext.ThrowInvalidArgument(nil, "BadName", "bad name"), codes.InvalidArgument, errorsext.IsErrorInvalidArgument},
+		{"not found", errorsext.ThrowNotFound(nil, "NoUser", "no user"), codes.NotFound, errorsext.IsNotFound},
+		{"precondition failed", errorsext.ThrowPreconditionFailed(nil, "Stale", "stale"), codes.FailedPrecondition, errorsext.IsPreconditionFailed},
+		{"resource exhausted", errorsext.ThrowResourceExhausted(nil, "Quota", "over quota"), codes.ResourceExhausted, errorsext.IsResourceExhausted},
+		{"unauthenticated", errorsext.ThrowUnauthenticated(nil, "NoToken", "no token"), codes.Unauthenticated, errorsext.IsUnauthenticated},
+		{"unavailable", errorsext.ThrowUnavailable(nil, "Down", "down"), codes.Unavailable, errorsext.IsUnavailable},
+		{"unimplemented", errorsext.ThrowUnimplemented(nil, "NoImpl", "no impl"), codes.Unimplemented, errorsext.IsUnimplemented},
+		{"permission denied", errorsext.ThrowPermissionDenied(nil, "NoAccess", "no access"), codes.PermissionDenied, errorsext.IsPermissionDenied},
+		{"internal", errorsext.ThrowInternal(nil, "Bug", "bug"), codes.Internal, errorsext.IsInternal},
+	} {
+		tc := tc
+		t.Run(
+			tc.name, func(t *testing.T) {
+				t.Parallel()
+				tc.err.(errorsext.Error).WithDetails(details)
+				assert.Equal(t, tc.code, NewStatus(tc.err, "").Code())
+				listener := bufconn.Listen(1 << 20)
+				server := NewServer(WithListener(listener))
+				server.RegisterService(&testEchoServiceDesc, &testEchoService{err: tc.err})
+				stop := startTestServer(t, server)
+				defer stop()
+				conn := newTestConn(t, listener, grpc.WithUnaryInterceptor(UnaryClientErrorInterceptor()))
+				defer func() {
+					assert.NoError(t, conn.Close())
+				}()
+				err := conn.Invoke(context.Background(), "/test.Echo/Echo", wrapperspb.String("fail"), new(wrapperspb.StringValue))
+				assert.True(t, tc.check(err), err)
+				var expected, actual errorsext.Error
+				require.ErrorAs(t, tc.err, &expected)
+				require.ErrorAs(t, err, &actual)
+				if errorsext.IsInternal(tc.err) {
+					// The reason, message, and details of internal errors are not exposed.
+					assert.Equal(t, "InternalError", actual.Reason())
+					assert.Empty(t, actual.Details())
+					return
+				}
+				assert.Equal(t, expected.Reason(), actual.Reason())
+				assert.Equal(t, expected.Message(), actual.Message())
+				assert.Equal(t, details, actual.Details())
+			},
+		)
+	}
+}
+
+func TestNewStatus(t *testing.T) {
+	t.Parallel()
+	cause := errorsext.ThrowNotFound(nil, "NoUser", "no user")
+	cause.(errorsext.Error).WithDetails(map[string]interface{}{"id": 1, "name": "foo"})
+	st := NewStatus(cause, "users")
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "no user", st.Message())
+	var errorInfo *errdetails.ErrorInfo
+	for _, detail := range st.Details() {
+		if detail, ok := detail.(*errdetails.ErrorInfo); ok {
+			errorInfo = detail
+		}
+	}
+	require.NotNil(t, errorInfo)
+	assert.Equal(t, "NoUser", errorInfo.GetReason())
+	assert.Equal(t, "users", errorInfo.GetDomain())
+	assert.Equal(t, map[string]string{"id": "1", "name": "foo"}, errorInfo.GetMetadata())
+
+	assert.Equal(t, codes.OK, NewStatus(nil, "").Code())
+	assert.Equal(t, codes.Canceled, NewStatus(context.Canceled, "").Code())
+	assert.Equal(t, codes.DeadlineExceeded, NewStatus(context.DeadlineExceeded, "").Code())
+	assert.Equal(t, codes.Aborted, NewStatus(status.Error(codes.Aborted, "aborted"), "").Code())
+	unknown := NewStatus(errors.New("secret"), "")
+	assert.Equal(t, codes.Unknown, unknown.Code())
+	assert.NotContains(t, unknown.Message(), "secret")
+}
+
+func TestNewErrorFromStatus(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, NewErrorFromStatus(status.New(codes.OK, "")))
+
+	// The metadata of the ErrorInfo are the details without a Struct.
+	st, err := status.New(codes.InvalidArgument, "invalid").WithDetails(
+		&errdetails.ErrorInfo{Reason: "BadName", Domain: "users", Metadata: map[string]string{"field": "name"}},
+	)
+	require.NoError(t, err)
+	err = NewErrorFromStatus(st)
+	assert.True(t, errorsext.IsErrorInvalidArgument(err), err)
+	var errX errorsext.Error
+	require.ErrorAs(t, err, &errX)
+	assert.Equal(t, "BadName", errX.Reason())
+	assert.Equal(t, "invalid", errX.Message())
+	assert.Equal(t, map[string]interface{}{"field": "name"}, errX.Details())
+
+	err = NewErrorFromStatus(status.New(codes.Canceled, "canceled"))
+	assert.ErrorIs(t, err, context.Canceled)
+	err = NewErrorFromStatus(status.New(codes.DeadlineExceeded, "too slow"))
+	assert.True(t, errorsext.IsDeadlineExceeded(err), err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, errorsext.IsPreconditionFailed(NewErrorFromStatus(status.New(codes.Aborted, ""))))
+	assert.True(t, errorsext.IsInternal(NewErrorFromStatus(status.New(codes.DataLoss, ""))))
+}
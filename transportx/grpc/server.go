@@ -0,0 +1,331 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/aesoper101/x/cert"
+	"github.com/aesoper101/x/configext"
+	"github.com/aesoper101/x/transportx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Server is a gRPC server that implements transportx.Server.
+//
+// The listener is created on the first call to Endpoint or Start, so the
+// endpoint of a server listening on port 0 is the port that was bound. The
+// standard health service is registered, and reports that the server is
+// serving from Start until Stop.
+type Server struct {
+	server             *grpc.Server
+	health             *health.Server
+	host               string
+	port               int
+	tlsConfig          *cert.TLSConfig
+	endpoint           *url.URL
+	serverOptions      []grpc.ServerOption
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+
+	// appInfo is the transportx.AppInfo of the context of Start, if any.
+	appInfo atomic.Value
+
+	lock     sync.Mutex
+	listener net.Listener
+	err      error
+	// served is set once the listener is served, after which the grpc.Server
+	// closes it, and stopped once Stop is called.
+	served   bool
+	stopped  bool
+	serving  atomic.Bool
+	ready    chan struct{}
+	readyOne sync.Once
+}
+
+var errNotServing = errors.New("server is not serving")
+
+// ServerOption is an option of NewServer.
+type ServerOption func(*Server)
+
+// WithAddress sets the listen address, formatted with configext.GetAddress.
+//
+// The host may be unix:/path/to/socket to listen on a unix socket, in which
+// case the port is ignored. The default is to listen on all interfaces on a
+// random port.
+func WithAddress(host string, port int) ServerOption {
+	return func(s *Server) {
+		s.host = host
+		s.port = port
+	}
+}
+
+// WithListener serves on the listener, such as a bufconn.Listener, instead of
+// listening on the address.
+func WithListener(listener net.Listener) ServerOption {
+	return func(s *Server) {
+		s.listener = listener
+	}
+}
+
+// WithTLSConfig serves with the TLS credentials of the tls.Config from cert.ConfigureTLS.
+func WithTLSConfig(tlsConfig *cert.TLSConfig) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = tlsConfig
+	}
+}
+
+// WithEndpoint sets the endpoint returned by Endpoint, instead of the bound address.
+func WithEndpoint(endpoint *url.URL) ServerOption {
+	return func(s *Server) {
+		s.endpoint = endpoint
+	}
+}
+
+// WithServerOptions adds options of the grpc.Server.
+func WithServerOptions(opts ...grpc.ServerOption) ServerOption {
+	return func(s *Server) {
+		s.serverOptions = append(s.serverOptions, opts...)
+	}
+}
+
+// WithUnaryInterceptors adds interceptors of unary calls, such as
+// UnaryServerTraceInterceptor.
+//
+// The interceptors run in order, after UnaryServerErrorInterceptor, so they
+// see the errors that the handlers return, and the errors they return are
+// converted to gRPC status errors.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) ServerOption {
+	return func(s *Server) {
+		s.unaryInterceptors = append(s.unaryInterceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors adds interceptors of streams, such as
+// StreamServerTraceInterceptor.
+//
+// The interceptors run in order, after StreamServerErrorInterceptor, so they
+// see the errors that the handlers return, and the errors they return are
+// converted to gRPC status errors.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) ServerOption {
+	return func(s *Server) {
+		s.streamInterceptors = append(s.streamInterceptors, interceptors...)
+	}
+}
+
+// NewServer returns a new Server.
+//
+// The errors of handlers are converted to gRPC status errors with
+// UnaryServerErrorInterceptor and StreamServerErrorInterceptor.
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		health: health.NewServer(),
+		ready:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	serverOptions := append(
+		[]grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(
+				append(
+					[]grpc.UnaryServerInterceptor{s.unaryAppInfoInterceptor, UnaryServerErrorInterceptor()},
+					s.unaryInterceptors...,
+				)...,
+			),
+			grpc.ChainStreamInterceptor(
+				append(
+					[]grpc.StreamServerInterceptor{s.streamAppInfoInterceptor, StreamServerErrorInterceptor()},
+					s.streamInterceptors...,
+				)...,
+			),
+		},
+		s.serverOptions...,
+	)
+	if s.tlsConfig != nil {
+		tlsConfig, err := cert.ConfigureTLS(s.tlsConfig)
+		switch {
+		case err != nil:
+			s.err = err
+		case len(tlsConfig.Certificates) == 0:
+			s.err = cert.ErrNoCertOrKey
+		default:
+			serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+	}
+	s.server = grpc.NewServer(serverOptions...)
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(s.server, s.health)
+	return s
+}
+
+// RegisterService registers a service and its implementation, as generated
+// by protoc-gen-go-grpc, so that the Server is a grpc.ServiceRegistrar.
+//
+// Services must be registered before Start.
+func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	s.server.RegisterService(desc, impl)
+}
+
+// HealthServer returns the health service, to set the serving status of the
+// registered services.
+func (s *Server) HealthServer() *health.Server {
+	return s.health
+}
+
+// Endpoint returns the endpoint of the server, listening if not yet listening.
+//
+// If the server listens on all interfaces, the endpoint uses the loopback
+// address. Use WithEndpoint to publish a routable address instead.
+func (s *Server) Endpoint() (*url.URL, error) {
+	if err := s.listen(); err != nil {
+		return nil, err
+	}
+	return s.endpoint, nil
+}
+
+// Start serves until Stop is called.
+//
+// The transportx.AppInfo of the context is added to the context of all calls.
+func (s *Server) Start(ctx context.Context) error {
+	if err := s.listen(); err != nil {
+		return err
+	}
+	if !s.serve() {
+		return nil
+	}
+	if appInfo, ok := transportx.FromContext(ctx); ok {
+		s.appInfo.Store(appInfo)
+	}
+	s.serving.Store(true)
+	defer s.serving.Store(false)
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	// Connections are accepted by the listener from here on.
+	s.readyOne.Do(func() { close(s.ready) })
+	err := s.server.Serve(s.listener)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Stop gracefully stops the server, waiting for the pending calls to finish,
+// and closes all connections if the context expires first.
+//
+// The health service reports that all services are not serving from then on.
+// A listener that was created by Endpoint but never served is closed.
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.closeUnservedListener(); err != nil {
+		return err
+	}
+	s.health.Shutdown()
+	stoppedC := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stoppedC)
+	}()
+	select {
+	case <-stoppedC:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		<-stoppedC
+		return ctx.Err()
+	}
+}
+
+// Ready returns a channel that is closed once the server is serving.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// HealthCheck returns an error if the server is not serving.
+func (s *Server) HealthCheck(context.Context) error {
+	if !s.serving.Load() {
+		return errNotServing
+	}
+	return nil
+}
+
+func (s *Server) unaryAppInfoInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(s.withAppInfo(ctx), req)
+}
+
+func (s *Server) streamAppInfoInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextServerStream{ServerStream: ss, ctx: s.withAppInfo(ss.Context())})
+}
+
+func (s *Server) withAppInfo(ctx context.Context) context.Context {
+	if appInfo, ok := s.appInfo.Load().(transportx.AppInfo); ok {
+		return transportx.NewContext(ctx, appInfo)
+	}
+	return ctx
+}
+
+func (s *Server) serve() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.served = true
+	return true
+}
+
+// closeUnservedListener closes the listener if it was never served, since the
+// grpc.Server only closes the listeners that it serves.
+func (s *Server) closeUnservedListener() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stopped := s.stopped
+	s.stopped = true
+	if stopped || s.listener == nil || s.served {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) listen() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.listener == nil {
+		s.listener, s.err = s.newListener()
+	}
+	if s.err == nil && s.endpoint == nil {
+		s.endpoint = getEndpoint(s.listener.Addr(), s.tlsConfig != nil)
+	}
+	return s.err
+}
+
+func (s *Server) newListener() (net.Listener, error) {
+	network, address := "tcp", configext.GetAddress(s.host, s.port)
+	if socketPath, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", socketPath
+	}
+	return net.Listen(network, address)
+}
+
+func getEndpoint(addr net.Addr, isTLS bool) *url.URL {
+	if addr.Network() == "unix" {
+		return &url.URL{Scheme: "unix", Path: addr.String()}
+	}
+	scheme := "grpc"
+	if isTLS {
+		scheme = "grpcs"
+	}
+	host := addr.String()
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok && tcpAddr.IP.IsUnspecified() {
+		host = net.JoinHostPort("127.0.0.1", strconv.Itoa(tcpAddr.Port))
+	}
+	return &url.URL{Scheme: scheme, Host: host}
+}
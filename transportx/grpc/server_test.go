@@ -0,0 +1,330 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/aesoper101/x/transportx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testEchoService echoes the string of the request, or returns the error of
+// the testEchoService for "fail".
+type testEchoService struct {
+	err error
+	// startedC, if set, is closed when a call starts, after which the call
+	// waits for releaseC, or until it is canceled.
+	startedC chan struct{}
+	releaseC chan struct{}
+}
+
+func (s *testEchoService) Echo(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	if s.startedC != nil {
+		close(s.startedC)
+		select {
+		case <-s.releaseC:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if req.GetValue() == "fail" {
+		return nil, s.err
+	}
+	value := req.GetValue()
+	if appInfo, ok := transportx.FromContext(ctx); ok {
+		value += " from " + appInfo.Name()
+	}
+	return wrapperspb.String(value), nil
+}
+
+// EchoStream sends the string of the request three times.
+func (s *testEchoService) EchoStream(req *wrapperspb.StringValue, stream grpc.ServerStream) error {
+	if req.GetValue() == "fail" {
+		return s.err
+	}
+	for i := 0; i < 3; i++ {
+		if err := stream.SendMsg(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var testEchoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Echo",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(wrapperspb.StringValue)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req any) (any, error) {
+					return srv.(*testEchoService).Echo(ctx, req.(*wrapperspb.StringValue))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/test.Echo/Echo"}, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "EchoStream",
+			ServerStreams: true,
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				req := new(wrapperspb.StringValue)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(*testEchoService).EchoStream(req, stream)
+			},
+		},
+	},
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(WithListener(listener))
+	server.RegisterService(&testEchoServiceDesc, &testEchoService{})
+	var reply string
+	var servingStatus healthpb.HealthCheckResponse_ServingStatus
+	err := transportx.Run(
+		transportx.WithContext(ctx),
+		transportx.Name("test"),
+		transportx.WithServers(server),
+		transportx.AfterStart(
+			func(ctx context.Context) error {
+				defer cancel()
+				appInfo, _ := transportx.FromContext(ctx)
+				require.Len(t, appInfo.Endpoints(), 1)
+				assert.Equal(t, "grpc", appInfo.Endpoints()[0].Scheme)
+				assert.NoError(t, server.HealthCheck(ctx))
+				conn := newTestConn(t, listener)
+				defer func() {
+					assert.NoError(t, conn.Close())
+				}()
+				response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+				if err != nil {
+					return err
+				}
+				servingStatus = response.GetStatus()
+				echo := new(wrapperspb.StringValue)
+				if err := conn.Invoke(ctx, "/test.Echo/Echo", wrapperspb.String("hello"), echo); err != nil {
+					return err
+				}
+				reply = echo.GetValue()
+				return nil
+			},
+		),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, servingStatus)
+	assert.Equal(t, "hello from test", reply)
+	assert.Error(t, server.HealthCheck(context.Background()))
+}
+
+func TestServerGracefulStop(t *testing.T) {
+	t.Parallel()
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(WithListener(listener))
+	service := &testEchoService{startedC: make(chan struct{}), releaseC: make(chan struct{})}
+	server.RegisterService(&testEchoServiceDesc, service)
+	startErrC := make(chan error, 1)
+	go func() {
+		startErrC <- server.Start(context.Background())
+	}()
+	<-server.Ready()
+	conn := newTestConn(t, listener)
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+	callErrC := make(chan error, 1)
+	go func() {
+		callErrC <- conn.Invoke(context.Background(), "/test.Echo/Echo", wrapperspb.String("slow"), new(wrapperspb.StringValue))
+	}()
+	<-service.startedC
+
+	stopErrC := make(chan error, 1)
+	go func() {
+		stopErrC <- server.Stop(context.Background())
+	}()
+	// The pending call keeps the server from stopping, but the health service
+	// reports that it is not serving.
+	assert.Eventually(
+		t,
+		func() bool {
+			response, err := server.HealthServer().Check(context.Background(), &healthpb.HealthCheckRequest{})
+			return err == nil && response.GetStatus() == healthpb.HealthCheckResponse_NOT_SERVING
+		},
+		time.Second,
+		time.Millisecond,
+	)
+	select {
+	case <-stopErrC:
+		t.Fatal("server stopped before the pending call finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(service.releaseC)
+	assert.NoError(t, <-callErrC)
+	assert.NoError(t, <-stopErrC)
+	assert.NoError(t, <-startErrC)
+}
+
+func TestServerStopTimeout(t *testing.T) {
+	t.Parallel()
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(WithListener(listener))
+	service := &testEchoService{startedC: make(chan struct{}), releaseC: make(chan struct{})}
+	server.RegisterService(&testEchoServiceDesc, service)
+	startErrC := make(chan error, 1)
+	go func() {
+		startErrC <- server.Start(context.Background())
+	}()
+	<-server.Ready()
+	conn := newTestConn(t, listener)
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+	callErrC := make(chan error, 1)
+	go func() {
+		callErrC <- conn.Invoke(context.Background(), "/test.Echo/Echo", wrapperspb.String("slow"), new(wrapperspb.StringValue))
+	}()
+	<-service.startedC
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, server.Stop(ctx), context.DeadlineExceeded)
+	// The connection was closed while the call was pending.
+	assert.Equal(t, codes.Unavailable, status.Code(<-callErrC))
+	assert.NoError(t, <-startErrC)
+}
+
+func TestServerStream(t *testing.T) {
+	t.Parallel()
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(WithListener(listener))
+	server.RegisterService(
+		&testEchoServiceDesc,
+		&testEchoService{err: errorsext.ThrowNotFound(nil, "NoEcho", "no echo")},
+	)
+	stop := startTestServer(t, server)
+	defer stop()
+	conn := newTestConn(
+		t,
+		listener,
+		grpc.WithStreamInterceptor(StreamClientErrorInterceptor()),
+	)
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+
+	values, err := recvTestStream(conn, "hello")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello", "hello", "hello"}, values)
+
+	_, err = recvTestStream(conn, "fail")
+	assert.True(t, errorsext.IsNotFound(err), err)
+}
+
+func TestServerReleasesListener(t *testing.T) {
+	t.Parallel()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+	server := NewServer(WithAddress("127.0.0.1", port))
+	err = transportx.Run(
+		transportx.WithContext(context.Background()),
+		transportx.WithServers(server),
+		transportx.BeforeStart(
+			func(context.Context) error {
+				return errors.New("migration failed")
+			},
+		),
+	)
+	assert.EqualError(t, err, "migration failed")
+	// The listener bound by Endpoint was closed, though the server never started.
+	listener, err = net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	// A stopped server does not start.
+	assert.NoError(t, server.Start(context.Background()))
+}
+
+func recvTestStream(conn *grpc.ClientConn, value string) ([]string, error) {
+	stream, err := conn.NewStream(
+		context.Background(),
+		&testEchoServiceDesc.Streams[0],
+		"/test.Echo/EchoStream",
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(wrapperspb.String(value)); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	var values []string
+	for {
+		reply := new(wrapperspb.StringValue)
+		if err := stream.RecvMsg(reply); err != nil {
+			if err == io.EOF {
+				return values, nil
+			}
+			return values, err
+		}
+		values = append(values, reply.GetValue())
+	}
+}
+
+func startTestServer(t *testing.T, server *Server) func() {
+	startErrC := make(chan error, 1)
+	go func() {
+		startErrC <- server.Start(context.Background())
+	}()
+	<-server.Ready()
+	return func() {
+		assert.NoError(t, server.Stop(context.Background()))
+		assert.NoError(t, <-startErrC)
+	}
+}
+
+func newTestConn(t *testing.T, listener *bufconn.Listener, opts ...grpc.DialOption) *grpc.ClientConn {
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		append(
+			[]grpc.DialOption{
+				grpc.WithContextDialer(
+					func(ctx context.Context, _ string) (net.Conn, error) {
+						return listener.DialContext(ctx)
+					},
+				),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			},
+			opts...,
+		)...,
+	)
+	require.NoError(t, err)
+	return conn
+}
@@ -0,0 +1,210 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/aesoper101/x/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"strings"
+	"sync"
+)
+
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// UnaryServerTraceInterceptor returns a grpc.UnaryServerInterceptor that
+// starts a server span for every call, continuing the W3C trace context of the
+// incoming metadata.
+//
+// The span is named after the full method, and is an error if the status code
+// is a server error.
+func UnaryServerTraceInterceptor(tracer tracing.Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		ctx, span, finish := startServerSpan(ctx, tracer, info.FullMethod)
+		defer span.End()
+		resp, err = handler(ctx, req)
+		finish(err)
+		return resp, err
+	}
+}
+
+// StreamServerTraceInterceptor returns a grpc.StreamServerInterceptor that
+// starts a server span for every stream, continuing the W3C trace context of
+// the incoming metadata.
+func StreamServerTraceInterceptor(tracer tracing.Tracer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span, finish := startServerSpan(ss.Context(), tracer, info.FullMethod)
+		defer span.End()
+		err := handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+		finish(err)
+		return err
+	}
+}
+
+// UnaryClientTraceInterceptor returns a grpc.UnaryClientInterceptor that
+// starts a client span for every call, and propagates its W3C trace context in
+// the outgoing metadata.
+func UnaryClientTraceInterceptor(tracer tracing.Tracer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span, finish := startClientSpan(ctx, tracer, method)
+		defer span.End()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		finish(err)
+		return err
+	}
+}
+
+// StreamClientTraceInterceptor returns a grpc.StreamClientInterceptor that
+// starts a client span for every stream, and propagates its W3C trace context
+// in the outgoing metadata.
+//
+// The span ends when a RecvMsg fails or returns io.EOF, or when the context of
+// the stream is done.
+func StreamClientTraceInterceptor(tracer tracing.Tracer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span, finish := startClientSpan(ctx, tracer, method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			finish(err)
+			span.End()
+			return nil, err
+		}
+		traceStream := &traceClientStream{ClientStream: stream}
+		traceStream.end = func(err error) {
+			traceStream.endOnce.Do(
+				func() {
+					finish(err)
+					span.End()
+				},
+			)
+		}
+		traceStream.stop = context.AfterFunc(ctx, func() { traceStream.end(ctx.Err()) })
+		return traceStream, nil
+	}
+}
+
+type traceClientStream struct {
+	grpc.ClientStream
+	end     func(err error)
+	endOnce sync.Once
+	stop    func() bool
+}
+
+func (s *traceClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.stop()
+		if errors.Is(err, io.EOF) {
+			s.end(nil)
+		} else {
+			s.end(err)
+		}
+	}
+	return err
+}
+
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// startServerSpan starts the span of a server call. The returned function
+// records the status of the error of the call on the span.
+func startServerSpan(ctx context.Context, tracer tracing.Tracer, fullMethod string) (context.Context, trace.Span, func(error)) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = tracePropagator.Extract(ctx, metadataCarrier(md))
+	var retErr error
+	ctx, span := tracer.Start(
+		ctx,
+		tracing.WithSpanName(strings.TrimPrefix(fullMethod, "/")),
+		tracing.WithSpanKind(trace.SpanKindServer),
+		tracing.WithErr(&retErr),
+		tracing.WithAttributes(getMethodAttributes(fullMethod)...),
+	)
+	return ctx, span, func(err error) {
+		code := NewStatus(err, "").Code()
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+		if isServerError(code) {
+			retErr = err
+		}
+	}
+}
+
+// startClientSpan starts the span of a client call, and adds its trace context
+// to the outgoing metadata. The returned function records the status of the
+// error of the call on the span.
+func startClientSpan(ctx context.Context, tracer tracing.Tracer, fullMethod string) (context.Context, trace.Span, func(error)) {
+	var retErr error
+	ctx, span := tracer.Start(
+		ctx,
+		tracing.WithSpanName(strings.TrimPrefix(fullMethod, "/")),
+		tracing.WithSpanKind(trace.SpanKindClient),
+		tracing.WithErr(&retErr),
+		tracing.WithAttributes(getMethodAttributes(fullMethod)...),
+	)
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	tracePropagator.Inject(ctx, metadataCarrier(md))
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	return ctx, span, func(err error) {
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(NewStatus(err, "").Code())))
+		retErr = err
+	}
+}
+
+func getMethodAttributes(fullMethod string) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{semconv.RPCSystemGRPC}
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if ok {
+		attributes = append(attributes, semconv.RPCService(service), semconv.RPCMethod(method))
+	}
+	return attributes
+}
+
+// isServerError returns whether the code is an error of the server, as
+// opposed to an error of the request.
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+// metadataCarrier adapts metadata.MD to a propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,167 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/aesoper101/x/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+func TestTraceInterceptors(t *testing.T) {
+	t.Parallel()
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() {
+		assert.NoError(t, tracerProvider.Shutdown(context.Background()))
+	}()
+	tracer := tracing.NewTracer(tracerProvider.Tracer("test"))
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(
+		WithListener(listener),
+		WithUnaryInterceptors(UnaryServerTraceInterceptor(tracer)),
+		WithStreamInterceptors(StreamServerTraceInterceptor(tracer)),
+	)
+	server.RegisterService(
+		&testEchoServiceDesc,
+		&testEchoService{err: errorsext.ThrowUnavailable(nil, "Down", "down")},
+	)
+	stop := startTestServer(t, server)
+	defer stop()
+	conn := newTestConn(
+		t,
+		listener,
+		grpc.WithChainUnaryInterceptor(UnaryClientTraceInterceptor(tracer), UnaryClientErrorInterceptor()),
+		grpc.WithChainStreamInterceptor(StreamClientTraceInterceptor(tracer), StreamClientErrorInterceptor()),
+	)
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+
+	require.NoError(
+		t,
+		conn.Invoke(context.Background(), "/test.Echo/Echo", wrapperspb.String("hello"), new(wrapperspb.StringValue)),
+	)
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	serverSpan, clientSpan := spans[0], spans[1]
+	assert.Equal(t, "test.Echo/Echo", serverSpan.Name())
+	assert.Equal(t, trace.SpanKindServer, serverSpan.SpanKind())
+	assert.Equal(t, trace.SpanKindClient, clientSpan.SpanKind())
+	// The server span continues the trace of the client span.
+	assert.Equal(t, clientSpan.SpanContext().TraceID(), serverSpan.SpanContext().TraceID())
+	assert.Equal(t, clientSpan.SpanContext().SpanID(), serverSpan.Parent().SpanID())
+	assert.True(t, serverSpan.Parent().IsRemote())
+	assert.Contains(t, serverSpan.Attributes(), semconv.RPCService("test.Echo"))
+	assert.Contains(t, serverSpan.Attributes(), semconv.RPCMethod("Echo"))
+	assert.Contains(t, serverSpan.Attributes(), semconv.RPCGRPCStatusCodeOk)
+	assert.NotEqual(t, otelcodes.Error, serverSpan.Status().Code)
+
+	err := conn.Invoke(context.Background(), "/test.Echo/Echo", wrapperspb.String("fail"), new(wrapperspb.StringValue))
+	assert.True(t, errorsext.IsUnavailable(err), err)
+	spans = recorder.Ended()
+	require.Len(t, spans, 4)
+	for _, span := range spans[2:] {
+		assert.Contains(t, span.Attributes(), semconv.RPCGRPCStatusCodeKey.Int(int(codes.Unavailable)))
+		assert.Equal(t, otelcodes.Error, span.Status().Code)
+	}
+
+	_, err = recvTestStream(conn, "hello")
+	require.NoError(t, err)
+	spans = recorder.Ended()
+	require.Len(t, spans, 6)
+	serverSpan, clientSpan = spans[4], spans[5]
+	assert.Equal(t, "test.Echo/EchoStream", serverSpan.Name())
+	assert.Equal(t, "test.Echo/EchoStream", clientSpan.Name())
+	assert.Equal(t, clientSpan.SpanContext().SpanID(), serverSpan.Parent().SpanID())
+	assert.NotEqual(t, otelcodes.Error, clientSpan.Status().Code)
+}
+
+func TestTraceInterceptorsClientError(t *testing.T) {
+	t.Parallel()
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() {
+		assert.NoError(t, tracerProvider.Shutdown(context.Background()))
+	}()
+	tracer := tracing.NewTracer(tracerProvider.Tracer("test"))
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(
+		WithListener(listener),
+		WithUnaryInterceptors(UnaryServerTraceInterceptor(tracer)),
+	)
+	server.RegisterService(
+		&testEchoServiceDesc,
+		&testEchoService{err: errorsext.ThrowNotFound(nil, "NoEcho", "no echo")},
+	)
+	stop := startTestServer(t, server)
+	defer stop()
+	conn := newTestConn(t, listener, grpc.WithUnaryInterceptor(UnaryClientTraceInterceptor(tracer)))
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+
+	err := conn.Invoke(context.Background(), "/test.Echo/Echo", wrapperspb.String("fail"), new(wrapperspb.StringValue))
+	require.Error(t, err)
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	serverSpan, clientSpan := spans[0], spans[1]
+	// A not found error is an error of the request, but not of the server.
+	assert.NotEqual(t, otelcodes.Error, serverSpan.Status().Code)
+	assert.Equal(t, otelcodes.Error, clientSpan.Status().Code)
+	assert.Contains(t, clientSpan.Attributes(), semconv.RPCGRPCStatusCodeKey.Int(int(codes.NotFound)))
+}
+
+func TestTraceInterceptorsInternalError(t *testing.T) {
+	t.Parallel()
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() {
+		assert.NoError(t, tracerProvider.Shutdown(context.Background()))
+	}()
+	tracer := tracing.NewTracer(tracerProvider.Tracer("test"))
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(
+		WithListener(listener),
+		WithUnaryInterceptors(UnaryServerTraceInterceptor(tracer)),
+		WithStreamInterceptors(StreamServerTraceInterceptor(tracer)),
+	)
+	server.RegisterService(
+		&testEchoServiceDesc,
+		&testEchoService{err: errorsext.ThrowInternal(errors.New("connection reset"), "DBError", "database failed")},
+	)
+	stop := startTestServer(t, server)
+	defer stop()
+	conn := newTestConn(t, listener, grpc.WithUnaryInterceptor(UnaryClientErrorInterceptor()))
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+
+	err := conn.Invoke(context.Background(), "/test.Echo/Echo", wrapperspb.String("fail"), new(wrapperspb.StringValue))
+	assert.True(t, errorsext.IsInternal(err), err)
+	_, err = recvTestStream(conn, "fail")
+	require.Error(t, err)
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		// The trace interceptors see the errors of the handlers, not the
+		// status errors that hide the cause from the client.
+		assert.Equal(t, otelcodes.Error, span.Status().Code)
+		assert.Contains(t, span.Status().Description, "DBError")
+		assert.Contains(t, span.Status().Description, "database failed")
+		require.Len(t, span.Events(), 1)
+		assert.Contains(t, span.Events()[0].Attributes, semconv.ExceptionType("*errorsext.InternalError"))
+		assert.Contains(t, span.Attributes(), semconv.RPCGRPCStatusCodeKey.Int(int(codes.Internal)))
+	}
+}
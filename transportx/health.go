@@ -0,0 +1,211 @@
+package transportx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+
+	// readinessCheckName is the name of the check that fails until the runner has started.
+	readinessCheckName = "runner"
+)
+
+var errNotReady = errors.New("runner is not ready")
+
+// HealthCheck returns an error if the checked component is not healthy.
+type HealthCheck func(ctx context.Context) error
+
+// HealthChecker is implemented by servers that report their health.
+//
+// The runner registers the HealthCheck of its servers as readiness checks.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// Health is a registry of named health checks.
+//
+// The runner marks a Health as ready once all servers have started and the
+// AfterStart hooks have succeeded, and as not ready at the beginning of Stop.
+type Health struct {
+	ready atomic.Bool
+
+	lock            sync.RWMutex
+	livenessChecks  map[string]HealthCheck
+	readinessChecks map[string]HealthCheck
+	details         map[string]func() any
+}
+
+// HealthReport is the result of running health checks.
+type HealthReport struct {
+	Status  string                        `json:"status"`
+	Checks  map[string]*HealthCheckResult `json:"checks,omitempty"`
+	Details map[string]any                `json:"details,omitempty"`
+}
+
+// HealthCheckResult is the result of a single health check.
+type HealthCheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func NewHealth() *Health {
+	return &Health{
+		livenessChecks:  make(map[string]HealthCheck),
+		readinessChecks: make(map[string]HealthCheck),
+		details:         make(map[string]func() any),
+	}
+}
+
+// RegisterLiveness registers a check that fails if the process should be restarted.
+//
+// A check registered with the same name replaces the previous check.
+func (h *Health) RegisterLiveness(name string, check HealthCheck) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.livenessChecks[name] = check
+}
+
+// RegisterReadiness registers a check that fails if the process should not receive traffic.
+//
+// A check registered with the same name replaces the previous check.
+func (h *Health) RegisterReadiness(name string, check HealthCheck) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.readinessChecks[name] = check
+}
+
+// RegisterDetails registers a function that returns details reported by Check,
+// such as the status of a component.
+//
+// The details must be encodable as JSON. Details registered with the same name
+// replace the previous details.
+func (h *Health) RegisterDetails(name string, details func() any) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.details[name] = details
+}
+
+// SetReady sets whether the runner is ready.
+func (h *Health) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// Ready returns whether the runner is ready, without running the readiness checks.
+func (h *Health) Ready() bool {
+	return h.ready.Load()
+}
+
+// Liveness runs the liveness checks.
+func (h *Health) Liveness(ctx context.Context) *HealthReport {
+	h.lock.RLock()
+	checks := copyHealthChecks(h.livenessChecks)
+	h.lock.RUnlock()
+	return runHealthChecks(ctx, checks)
+}
+
+// Readiness runs the readiness checks, and fails if the runner is not ready.
+func (h *Health) Readiness(ctx context.Context) *HealthReport {
+	h.lock.RLock()
+	checks := copyHealthChecks(h.readinessChecks)
+	h.lock.RUnlock()
+	checks[readinessCheckName] = h.checkReady
+	return runHealthChecks(ctx, checks)
+}
+
+// Check runs both the liveness and readiness checks, and adds the registered details.
+func (h *Health) Check(ctx context.Context) *HealthReport {
+	h.lock.RLock()
+	checks := copyHealthChecks(h.livenessChecks)
+	for name, check := range h.readinessChecks {
+		checks[name] = check
+	}
+	details := make(map[string]func() any, len(h.details))
+	for name, f := range h.details {
+		details[name] = f
+	}
+	h.lock.RUnlock()
+	checks[readinessCheckName] = h.checkReady
+	report := runHealthChecks(ctx, checks)
+	if len(details) > 0 {
+		report.Details = make(map[string]any, len(details))
+		for name, f := range details {
+			report.Details[name] = f()
+		}
+	}
+	return report
+}
+
+// Handler returns a handler that serves /healthz, /readyz, and /livez.
+//
+// The HealthReport is written as JSON, with status 200 if all checks pass and
+// 503 otherwise.
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", newHealthHandler(h.Check))
+	mux.Handle("/readyz", newHealthHandler(h.Readiness))
+	mux.Handle("/livez", newHealthHandler(h.Liveness))
+	return mux
+}
+
+func (h *Health) checkReady(context.Context) error {
+	if !h.Ready() {
+		return errNotReady
+	}
+	return nil
+}
+
+func copyHealthChecks(checks map[string]HealthCheck) map[string]HealthCheck {
+	n := make(map[string]HealthCheck, len(checks)+1)
+	for name, check := range checks {
+		n[name] = check
+	}
+	return n
+}
+
+func runHealthChecks(ctx context.Context, checks map[string]HealthCheck) *HealthReport {
+	report := &HealthReport{
+		Status: HealthStatusOK,
+		Checks: make(map[string]*HealthCheckResult, len(checks)),
+	}
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result := &HealthCheckResult{
+			Status: HealthStatusOK,
+		}
+		if err := checks[name](ctx); err != nil {
+			report.Status = HealthStatusFail
+			result.Status = HealthStatusFail
+			result.Error = err.Error()
+		}
+		report.Checks[name] = result
+	}
+	return report
+}
+
+func newHealthHandler(check func(context.Context) *HealthReport) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			report := check(r.Context())
+			statusCode := http.StatusOK
+			if report.Status != HealthStatusOK {
+				statusCode = http.StatusServiceUnavailable
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(statusCode)
+			_ = json.NewEncoder(w).Encode(report)
+		},
+	)
+}
@@ -0,0 +1,120 @@
+package transportx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+	health := NewHealth()
+	health.RegisterLiveness(
+		"deadlock",
+		func(context.Context) error {
+			return nil
+		},
+	)
+	health.RegisterReadiness(
+		"database",
+		func(context.Context) error {
+			return errors.New("connection refused")
+		},
+	)
+	handler := health.Handler()
+
+	report := testHealthRequest(t, handler, "/livez", http.StatusOK)
+	assert.Equal(
+		t,
+		&HealthReport{
+			Status: HealthStatusOK,
+			Checks: map[string]*HealthCheckResult{
+				"deadlock": {Status: HealthStatusOK},
+			},
+		},
+		report,
+	)
+	report = testHealthRequest(t, handler, "/readyz", http.StatusServiceUnavailable)
+	assert.Equal(
+		t,
+		&HealthReport{
+			Status: HealthStatusFail,
+			Checks: map[string]*HealthCheckResult{
+				"database": {Status: HealthStatusFail, Error: "connection refused"},
+				"runner":   {Status: HealthStatusFail, Error: "runner is not ready"},
+			},
+		},
+		report,
+	)
+
+	health.SetReady(true)
+	health.RegisterReadiness(
+		"database",
+		func(context.Context) error {
+			return nil
+		},
+	)
+	report = testHealthRequest(t, handler, "/healthz", http.StatusOK)
+	assert.Len(t, report.Checks, 3)
+}
+
+func TestRunHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	health := NewHealth()
+	mockServer := NewMockServer(ctrl)
+	mockServer.EXPECT().Start(gomock.Any()).DoAndReturn(
+		func(context.Context) error {
+			// Stop the runner once it is ready.
+			for !health.Ready() {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			return nil
+		},
+	)
+	mockServer.EXPECT().Stop(gomock.Any()).Return(nil)
+
+	var readyAfterStart, readyBeforeStop bool
+	err := Run(
+		WithContext(ctx),
+		WithHealth(health),
+		WithServers(mockServer),
+		AfterStart(
+			func(context.Context) error {
+				readyAfterStart = health.Ready()
+				return nil
+			},
+		),
+		BeforeStop(
+			func(context.Context) error {
+				readyBeforeStop = health.Ready()
+				return nil
+			},
+		),
+	)
+	require.NoError(t, err)
+	assert.False(t, readyAfterStart)
+	assert.False(t, readyBeforeStop)
+	assert.False(t, health.Ready())
+}
+
+func testHealthRequest(t *testing.T, handler http.Handler, path string, expectedStatusCode int) *HealthReport {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, expectedStatusCode, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	report := &HealthReport{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), report))
+	return report
+}
@@ -0,0 +1,294 @@
+package http
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/aesoper101/x/configext"
+	"github.com/aesoper101/x/transportx"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// AdminOption is an option for NewAdminHandler and NewAdminServer.
+type AdminOption func(*adminOptions)
+
+type adminOptions struct {
+	provider      *configext.Provider
+	level         *zap.AtomicLevel
+	health        *transportx.Health
+	limiterStats  map[string]func() any
+	serverOptions []ServerOption
+}
+
+// AdminWithConfig serves the configuration of the Provider at /debug/config,
+// with secrets redacted by configext.Provider.Redacted.
+func AdminWithConfig(provider *configext.Provider) AdminOption {
+	return func(o *adminOptions) {
+		o.provider = provider
+	}
+}
+
+// AdminWithLogLevel serves the level at /debug/loglevel, where GET returns the
+// level and PUT changes it, as with zap.AtomicLevel.ServeHTTP.
+//
+// The logger passed to transportx.WithLogger must use the same level, such as
+// a logger returned by zaputil.NewLogger with zaputil.WithAtomicLevel.
+func AdminWithLogLevel(level zap.AtomicLevel) AdminOption {
+	return func(o *adminOptions) {
+		o.level = &level
+	}
+}
+
+// AdminWithHealth also serves the /healthz, /readyz, and /livez endpoints of the Health.
+func AdminWithHealth(health *transportx.Health) AdminOption {
+	return func(o *adminOptions) {
+		o.health = health
+	}
+}
+
+// AdminWithLimiterStats serves the statistics of the limiter at
+// /debug/limiters, by name, such as the Stats of a limit.RateLimiter or
+// limit.ConcurrencyLimiter.
+//
+// The statistics must be encodable as JSON. Statistics added with the same
+// name replace the previous statistics.
+func AdminWithLimiterStats(name string, stats func() any) AdminOption {
+	return func(o *adminOptions) {
+		if o.limiterStats == nil {
+			o.limiterStats = make(map[string]func() any)
+		}
+		o.limiterStats[name] = stats
+	}
+}
+
+// AdminWithServerOptions sets the options of the Server returned by NewAdminServer.
+func AdminWithServerOptions(opts ...ServerOption) AdminOption {
+	return func(o *adminOptions) {
+		o.serverOptions = append(o.serverOptions, opts...)
+	}
+}
+
+// NewAdminHandler returns a new handler for the admin endpoints:
+//
+//   - /debug/pprof/ serves the net/http/pprof profiles.
+//   - /debug/vars serves the expvar variables.
+//   - /debug/runtime serves the goroutine, memory, and GC statistics.
+//   - /debug/buildinfo serves the module versions from debug.ReadBuildInfo.
+//   - /debug/appinfo serves the transportx.AppInfo of the request context.
+//
+// Other endpoints are served depending on the options.
+func NewAdminHandler(opts ...AdminOption) http.Handler {
+	options := &adminOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/runtime", serveRuntime)
+	mux.HandleFunc("/debug/buildinfo", serveBuildInfo)
+	mux.HandleFunc("/debug/appinfo", serveAppInfo)
+	if options.provider != nil {
+		provider := options.provider
+		mux.HandleFunc(
+			"/debug/config",
+			func(w http.ResponseWriter, r *http.Request) {
+				writeAdminJSON(w, http.StatusOK, provider.Redacted())
+			},
+		)
+	}
+	if options.level != nil {
+		mux.Handle("/debug/loglevel", options.level)
+	}
+	if len(options.limiterStats) > 0 {
+		limiterStats := options.limiterStats
+		mux.HandleFunc(
+			"/debug/limiters",
+			func(w http.ResponseWriter, r *http.Request) {
+				stats := make(map[string]any, len(limiterStats))
+				for name, f := range limiterStats {
+					stats[name] = f()
+				}
+				writeAdminJSON(w, http.StatusOK, stats)
+			},
+		)
+	}
+	if options.health != nil {
+		handler := options.health.Handler()
+		mux.Handle("/healthz", handler)
+		mux.Handle("/readyz", handler)
+		mux.Handle("/livez", handler)
+	}
+	return mux
+}
+
+// NewAdminServer returns a new Server that serves the handler returned by
+// NewAdminHandler.
+//
+// The admin endpoints expose internals of the process, so the server should
+// only listen on an address that is not publicly reachable. The write timeout
+// is disabled by default, so CPU profiles and traces can run for longer than
+// DefaultWriteTimeout.
+func NewAdminServer(opts ...AdminOption) *Server {
+	options := &adminOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	serverOptions := []ServerOption{
+		WithHandler(NewAdminHandler(opts...)),
+		WithWriteTimeout(0),
+	}
+	return NewServer(append(serverOptions, options.serverOptions...)...)
+}
+
+type runtimeStats struct {
+	GoVersion    string   `json:"go_version"`
+	GOOS         string   `json:"goos"`
+	GOARCH       string   `json:"goarch"`
+	NumCPU       int      `json:"num_cpu"`
+	GOMAXPROCS   int      `json:"gomaxprocs"`
+	NumGoroutine int      `json:"num_goroutine"`
+	Memory       memStats `json:"memory"`
+	GC           gcStats  `json:"gc"`
+}
+
+type memStats struct {
+	Alloc       uint64 `json:"alloc"`
+	TotalAlloc  uint64 `json:"total_alloc"`
+	Sys         uint64 `json:"sys"`
+	Mallocs     uint64 `json:"mallocs"`
+	Frees       uint64 `json:"frees"`
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapSys     uint64 `json:"heap_sys"`
+	HeapInuse   uint64 `json:"heap_inuse"`
+	HeapObjects uint64 `json:"heap_objects"`
+	StackInuse  uint64 `json:"stack_inuse"`
+}
+
+type gcStats struct {
+	NumGC       uint32        `json:"num_gc"`
+	NumForcedGC uint32        `json:"num_forced_gc"`
+	NextGC      uint64        `json:"next_gc"`
+	LastGC      *time.Time    `json:"last_gc,omitempty"`
+	PauseTotal  time.Duration `json:"pause_total_ns"`
+	CPUFraction float64       `json:"cpu_fraction"`
+}
+
+func serveRuntime(w http.ResponseWriter, _ *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats := runtimeStats{
+		GoVersion:    runtime.Version(),
+		GOOS:         runtime.GOOS,
+		GOARCH:       runtime.GOARCH,
+		NumCPU:       runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumGoroutine: runtime.NumGoroutine(),
+		Memory: memStats{
+			Alloc:       m.Alloc,
+			TotalAlloc:  m.TotalAlloc,
+			Sys:         m.Sys,
+			Mallocs:     m.Mallocs,
+			Frees:       m.Frees,
+			HeapAlloc:   m.HeapAlloc,
+			HeapSys:     m.HeapSys,
+			HeapInuse:   m.HeapInuse,
+			HeapObjects: m.HeapObjects,
+			StackInuse:  m.StackInuse,
+		},
+		GC: gcStats{
+			NumGC:       m.NumGC,
+			NumForcedGC: m.NumForcedGC,
+			NextGC:      m.NextGC,
+			PauseTotal:  time.Duration(m.PauseTotalNs),
+			CPUFraction: m.GCCPUFraction,
+		},
+	}
+	if m.LastGC > 0 {
+		lastGC := time.Unix(0, int64(m.LastGC)).UTC()
+		stats.GC.LastGC = &lastGC
+	}
+	writeAdminJSON(w, http.StatusOK, stats)
+}
+
+type buildInfo struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Main      module            `json:"main"`
+	Deps      []module          `json:"deps"`
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+type module struct {
+	Path    string  `json:"path"`
+	Version string  `json:"version"`
+	Sum     string  `json:"sum,omitempty"`
+	Replace *module `json:"replace,omitempty"`
+}
+
+func serveBuildInfo(w http.ResponseWriter, _ *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "build info is not available", http.StatusNotFound)
+		return
+	}
+	response := buildInfo{
+		GoVersion: info.GoVersion,
+		Path:      info.Path,
+		Main:      newModule(&info.Main),
+		Deps:      make([]module, 0, len(info.Deps)),
+	}
+	for _, dep := range info.Deps {
+		response.Deps = append(response.Deps, newModule(dep))
+	}
+	if len(info.Settings) > 0 {
+		response.Settings = make(map[string]string, len(info.Settings))
+		for _, setting := range info.Settings {
+			response.Settings[setting.Key] = setting.Value
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, response)
+}
+
+func newModule(m *debug.Module) module {
+	result := module{
+		Path:    m.Path,
+		Version: m.Version,
+		Sum:     m.Sum,
+	}
+	if m.Replace != nil {
+		replace := newModule(m.Replace)
+		result.Replace = &replace
+	}
+	return result
+}
+
+func serveAppInfo(w http.ResponseWriter, r *http.Request) {
+	info, ok := transportx.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "app info is not available", http.StatusNotFound)
+		return
+	}
+	// The ServiceInstance is the AppInfo with the endpoints as strings.
+	writeAdminJSON(w, http.StatusOK, transportx.NewServiceInstance(info))
+}
+
+func writeAdminJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(data)
+}
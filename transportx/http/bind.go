@@ -0,0 +1,354 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aesoper101/x/configext"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/aesoper101/x/uuidutil"
+	"github.com/dgraph-io/ristretto"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/tidwall/gjson"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultBindMaxMemory is the maximum memory of a multipart form, after
+	// which files are stored on disk.
+	defaultBindMaxMemory = 32 << 20
+
+	// bindListSeparator separates the items of a slice or map in a single value,
+	// as with args.Unpack.
+	bindListSeparator = ";"
+)
+
+// BindOption is an option for Bind.
+type BindOption func(*bindOptions)
+
+type bindOptions struct {
+	schema      []byte
+	decodeHooks []mapstructure.DecodeHookFunc
+	maxMemory   int64
+}
+
+// BindWithSchema validates a JSON request body against the JSON schema before
+// it is decoded.
+//
+// The schema is compiled once, and cached.
+func BindWithSchema(schema []byte) BindOption {
+	return func(o *bindOptions) {
+		o.schema = schema
+	}
+}
+
+// BindWithDecodeHooks adds mapstructure decode hooks for the query, form, and
+// path parameters, which run before the default hooks.
+func BindWithDecodeHooks(hooks ...mapstructure.DecodeHookFunc) BindOption {
+	return func(o *bindOptions) {
+		o.decodeHooks = append(o.decodeHooks, hooks...)
+	}
+}
+
+// BindWithMaxMemory sets the maximum memory of a multipart form, after which
+// files are stored on disk. The default is 32MB.
+func BindWithMaxMemory(maxMemory int64) BindOption {
+	return func(o *bindOptions) {
+		o.maxMemory = maxMemory
+	}
+}
+
+// Bind decodes the request into a new T, which must be a struct.
+//
+// A JSON body is decoded as with json.Unmarshal. Other parameters are set on
+// the fields of T with a tag for their source:
+//
+//   - `query:"name"` for the query parameter.
+//   - `form:"name"` for the form value of a url-encoded or multipart body.
+//   - `path:"name"` for the path value of a http.ServeMux pattern.
+//
+// Like args.Unpack, a slice field is set from repeated parameters, or a single
+// value with items separated by ";", and a map[string]string field is set from
+// a value like "a=1;b=2". The ";" must be escaped as %3B in a query. Values are converted with the configext decode hooks
+// for URLs, email addresses, and regular expressions, and with the mapstructure
+// hooks for durations, times in RFC 3339, and basic types.
+//
+// Invalid requests return an errorsext.InvalidArgument error with the
+// []InvalidParam of the fields in the details as InvalidParamsKey.
+func Bind[T any](r *http.Request, opts ...BindOption) (T, error) {
+	var result T
+	options := &bindOptions{
+		maxMemory: defaultBindMaxMemory,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	value := reflect.ValueOf(&result).Elem()
+	if value.Kind() != reflect.Struct {
+		return result, errorsext.ThrowInternalF(nil, "", "cannot bind to %T, which is not a struct", result)
+	}
+	if err := bindBody(r, &result, options); err != nil {
+		return result, err
+	}
+	query := r.URL.Query()
+	var invalidParams []InvalidParam
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		for _, source := range []struct {
+			tag       string
+			getValues func(name string) []string
+		}{
+			{"query", func(name string) []string { return query[name] }},
+			{"form", func(name string) []string { return getFormValues(r, name) }},
+			{"path", func(name string) []string { return getPathValues(r, name) }},
+		} {
+			name, ok := getBindName(field, source.tag)
+			if !ok {
+				continue
+			}
+			values := source.getValues(name)
+			if len(values) == 0 {
+				continue
+			}
+			if err := bindField(value.Field(i), values, options.decodeHooks); err != nil {
+				invalidParams = append(invalidParams, InvalidParam{Name: name, Reason: err.Error()})
+			}
+		}
+	}
+	if len(invalidParams) > 0 {
+		return result, newInvalidParamsError(nil, "request parameters are invalid", invalidParams)
+	}
+	return result, nil
+}
+
+// bindBody decodes a JSON body into result, or parses a form body.
+func bindBody(r *http.Request, result interface{}, options *bindOptions) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return newBodyError(err, "request form is invalid")
+		}
+		return nil
+	case mediaType == "multipart/form-data":
+		if err := r.ParseMultipartForm(options.maxMemory); err != nil {
+			return newBodyError(err, "request form is invalid")
+		}
+		return nil
+	case mediaType != MediaTypeJSON && !strings.HasSuffix(mediaType, "+json"):
+		return nil
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return newBodyError(err, "failed to read the request body")
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if options.schema != nil {
+		schema, err := getBindSchema(options.schema)
+		if err != nil {
+			return errorsext.ThrowInternal(err, "", "failed to compile the request schema")
+		}
+		document, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			return errorsext.ThrowInvalidArgument(err, "", "request body is not valid JSON")
+		}
+		if err := schema.Validate(document); err != nil {
+			return newInvalidParamsError(err, "request body is invalid", newInvalidParams(err))
+		}
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return newInvalidParamsError(
+				err,
+				"request body is invalid",
+				[]InvalidParam{
+					{
+						Name:    typeErr.Field,
+						Reason:  fmt.Sprintf("cannot be %s, want %s", typeErr.Value, typeErr.Type),
+						Pointer: "/" + strings.ReplaceAll(typeErr.Field, ".", "/"),
+					},
+				},
+			)
+		}
+		return errorsext.ThrowInvalidArgument(err, "", "request body is not valid JSON")
+	}
+	return nil
+}
+
+// bindField decodes the values into the field.
+func bindField(field reflect.Value, values []string, decodeHooks []mapstructure.DecodeHookFunc) error {
+	var input interface{}
+	switch field.Kind() {
+	case reflect.Slice:
+		if len(values) == 1 {
+			values = strings.Split(values[0], bindListSeparator)
+		}
+		input = values
+	default:
+		if len(values) != 1 {
+			return fmt.Errorf("cannot be assigned multiple values: %v", values)
+		}
+		input = values[0]
+	}
+	target := reflect.New(field.Type())
+	decoder, err := mapstructure.NewDecoder(
+		&mapstructure.DecoderConfig{
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				append(
+					append([]mapstructure.DecodeHookFunc(nil), decodeHooks...),
+					configext.StringToURLHookFunc(),
+					configext.StringToMailAddressHookFunc(),
+					configext.StringToRegexpHookFunc(),
+					mapstructure.StringToTimeDurationHookFunc(),
+					mapstructure.StringToTimeHookFunc(time.RFC3339),
+					stringToStringMapHookFunc(),
+					mapstructure.StringToBasicTypeHookFunc(),
+				)...,
+			),
+			Result: target.Interface(),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(input); err != nil {
+		// Remove the context that mapstructure adds to the errors of decode hooks.
+		if cause := errors.Unwrap(err); cause != nil {
+			return cause
+		}
+		return err
+	}
+	field.Set(target.Elem())
+	return nil
+}
+
+// stringToStringMapHookFunc decodes a value like "a=1;b=2" into a map[string]string.
+func stringToStringMapHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != reflect.TypeOf(map[string]string(nil)) {
+			return data, nil
+		}
+		result := make(map[string]string)
+		for _, pair := range strings.Split(data.(string), bindListSeparator) {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid key-value pair '%s'", pair)
+			}
+			result[key] = value
+		}
+		return result, nil
+	}
+}
+
+// getBindName returns the name in the tag of the field, if any.
+func getBindName(field reflect.StructField, tag string) (string, bool) {
+	value, ok := field.Tag.Lookup(tag)
+	if !ok {
+		return "", false
+	}
+	name, _, _ := strings.Cut(value, ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+func getFormValues(r *http.Request, name string) []string {
+	if r.PostForm == nil {
+		return nil
+	}
+	return r.PostForm[name]
+}
+
+func getPathValues(r *http.Request, name string) []string {
+	if value := r.PathValue(name); value != "" {
+		return []string{value}
+	}
+	return nil
+}
+
+func newBodyError(err error, message string) error {
+	var maxBytesErr *http.MaxBytesError
+	if errorsext.IsResourceExhausted(err) || errors.As(err, &maxBytesErr) {
+		return err
+	}
+	return errorsext.ThrowInvalidArgument(err, "", message)
+}
+
+func newInvalidParamsError(cause error, message string, invalidParams []InvalidParam) error {
+	err := errorsext.ThrowInvalidArgument(cause, "", message)
+	err.(errorsext.Error).WithDetails(map[string]interface{}{InvalidParamsKey: invalidParams})
+	return err
+}
+
+var bindSchemaCacheConfig = &ristretto.Config{
+	// Hold up to 100 schemas in cache, usually one per route.
+	MaxCost:            100,
+	NumCounters:        1000,
+	BufferItems:        64,
+	Metrics:            false,
+	IgnoreInternalCost: true,
+	Cost: func(value interface{}) int64 {
+		return 1
+	},
+}
+
+var bindSchemaCache, _ = ristretto.NewCache(bindSchemaCacheConfig)
+
+func getBindSchema(schema []byte) (*jsonschema.Schema, error) {
+	key := fmt.Sprintf("%x", sha256.Sum256(schema))
+	if val, found := bindSchemaCache.Get(key); found {
+		if validator, ok := val.(*jsonschema.Schema); ok {
+			return validator, nil
+		}
+		bindSchemaCache.Del(key)
+	}
+
+	id := gjson.GetBytes(schema, "$id").String()
+	if id == "" {
+		uuid, err := uuidutil.New()
+		if err != nil {
+			return nil, err
+		}
+		id = fmt.Sprintf("%s.json", uuid.String())
+	}
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema))
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(id, document); err != nil {
+		return nil, err
+	}
+	compiler.AssertContent()
+	compiler.AssertFormat()
+	compiler.AssertVocabs()
+	validator, err := compiler.Compile(id)
+	if err != nil {
+		return nil, err
+	}
+
+	bindSchemaCache.Set(key, validator, 1)
+	bindSchemaCache.Wait()
+	return validator, nil
+}
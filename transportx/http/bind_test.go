@@ -0,0 +1,189 @@
+package http
+
+import (
+	"bytes"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBindRequest struct {
+	ID       int               `path:"id"`
+	Name     string            `json:"name"`
+	Age      int               `json:"age"`
+	Tags     []string          `query:"tag"`
+	IDs      []int             `query:"ids"`
+	Labels   map[string]string `query:"labels"`
+	Timeout  time.Duration     `query:"timeout"`
+	Since    time.Time         `query:"since"`
+	Callback *url.URL          `query:"callback"`
+	Pattern  *regexp.Regexp    `query:"pattern"`
+	Verbose  bool              `query:"verbose"`
+	Comment  string            `form:"comment"`
+	Ignored  string            `query:"-"`
+}
+
+func TestBind(t *testing.T) {
+	t.Parallel()
+	var bound testBindRequest
+	var bindErr error
+	mux := http.NewServeMux()
+	mux.HandleFunc(
+		"/users/{id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			bound, bindErr = Bind[testBindRequest](r)
+		},
+	)
+	request := httptest.NewRequest(
+		http.MethodPost,
+		"/users/42?tag=a&tag=b&ids=1%3B2%3B3&labels=x%3D1%3By%3D2&timeout=1m30s&since=2024-01-02T03:04:05Z"+
+			"&callback=https://example.com/cb&pattern=^a.c$&verbose=true&Ignored=x",
+		strings.NewReader(`{"name":"foo","age":30}`),
+	)
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	mux.ServeHTTP(httptest.NewRecorder(), request)
+	require.NoError(t, bindErr)
+	assert.Equal(t, 42, bound.ID)
+	assert.Equal(t, "foo", bound.Name)
+	assert.Equal(t, 30, bound.Age)
+	assert.Equal(t, []string{"a", "b"}, bound.Tags)
+	assert.Equal(t, []int{1, 2, 3}, bound.IDs)
+	assert.Equal(t, map[string]string{"x": "1", "y": "2"}, bound.Labels)
+	assert.Equal(t, 90*time.Second, bound.Timeout)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), bound.Since)
+	assert.Equal(t, "https://example.com/cb", bound.Callback.String())
+	assert.True(t, bound.Pattern.MatchString("abc"))
+	assert.True(t, bound.Verbose)
+	assert.Empty(t, bound.Ignored)
+}
+
+func TestBindForm(t *testing.T) {
+	t.Parallel()
+	request := httptest.NewRequest(http.MethodPost, "/?tag=a", strings.NewReader("comment=hello&tag=b"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	bound, err := Bind[testBindRequest](request)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", bound.Comment)
+	// Query parameters are not taken from the form.
+	assert.Equal(t, []string{"a"}, bound.Tags)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	require.NoError(t, writer.WriteField("comment", "multipart"))
+	require.NoError(t, writer.Close())
+	request = httptest.NewRequest(http.MethodPost, "/", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	bound, err = Bind[testBindRequest](request)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart", bound.Comment)
+}
+
+func TestBindInvalidParams(t *testing.T) {
+	t.Parallel()
+	request := httptest.NewRequest(http.MethodGet, "/?ids=1%3Bx&timeout=soon&verbose=true&verbose=false&labels=x", nil)
+	_, err := Bind[testBindRequest](request)
+	require.True(t, errorsext.IsErrorInvalidArgument(err), err)
+	invalidParams := getInvalidParams(t, err)
+	require.Len(t, invalidParams, 4)
+	var names []string
+	for _, invalidParam := range invalidParams {
+		names = append(names, invalidParam.Name)
+		assert.NotEmpty(t, invalidParam.Reason)
+	}
+	assert.Equal(t, []string{"ids", "labels", "timeout", "verbose"}, names)
+
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"age":"old"}`))
+	request.Header.Set("Content-Type", "application/json")
+	_, err = Bind[testBindRequest](request)
+	require.True(t, errorsext.IsErrorInvalidArgument(err), err)
+	assert.Equal(
+		t,
+		[]InvalidParam{{Name: "age", Reason: "cannot be string, want int", Pointer: "/age"}},
+		getInvalidParams(t, err),
+	)
+
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"age":`))
+	request.Header.Set("Content-Type", "application/json")
+	_, err = Bind[testBindRequest](request)
+	assert.True(t, errorsext.IsErrorInvalidArgument(err), err)
+
+	_, err = Bind[string](request)
+	assert.True(t, errorsext.IsInternal(err), err)
+}
+
+func TestBindSchema(t *testing.T) {
+	t.Parallel()
+	schema := []byte(
+		`{
+			"type": "object",
+			"required": ["name"],
+			"properties": {
+				"name": {"type": "string", "minLength": 1},
+				"age": {"type": "integer", "minimum": 0}
+			}
+		}`,
+	)
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"foo","age":1}`))
+	request.Header.Set("Content-Type", "application/json")
+	bound, err := Bind[testBindRequest](request, BindWithSchema(schema))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", bound.Name)
+
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"age":-1}`))
+	request.Header.Set("Content-Type", "application/json")
+	_, err = Bind[testBindRequest](request, BindWithSchema(schema))
+	require.True(t, errorsext.IsErrorInvalidArgument(err), err)
+	assert.ElementsMatch(
+		t,
+		[]InvalidParam{
+			{Name: "name", Reason: "is required", Pointer: "/name"},
+			{Name: "age", Reason: "minimum: got -1, want 0", Pointer: "/age"},
+		},
+		getInvalidParams(t, err),
+	)
+
+	// The compiled schema is cached.
+	first, err := getBindSchema(schema)
+	require.NoError(t, err)
+	second, err := getBindSchema(schema)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	request.Header.Set("Content-Type", "application/json")
+	_, err = Bind[testBindRequest](request, BindWithSchema([]byte(`{`)))
+	assert.True(t, errorsext.IsInternal(err), err)
+}
+
+func TestBindBodyLimit(t *testing.T) {
+	t.Parallel()
+	var bindErr error
+	handler := BodyLimit(4)(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				_, bindErr = Bind[testBindRequest](r)
+			},
+		),
+	)
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"foo"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	assert.True(t, errorsext.IsResourceExhausted(bindErr), bindErr)
+}
+
+func getInvalidParams(t *testing.T, err error) []InvalidParam {
+	var xErr errorsext.Error
+	require.ErrorAs(t, err, &xErr)
+	invalidParams, ok := xErr.Details()[InvalidParamsKey].([]InvalidParam)
+	require.True(t, ok)
+	return invalidParams
+}
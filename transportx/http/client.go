@@ -0,0 +1,312 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aesoper101/x/cert"
+	"github.com/aesoper101/x/errorsext"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultClientInitialBackoff = 100 * time.Millisecond
+	defaultClientMaxBackoff     = 5 * time.Second
+)
+
+// Client is a client for JSON APIs that respond with SuccessResponse and
+// FailureResponse.
+//
+// Use Do, or one of Get, Post, Put, Patch, and Delete, to send requests.
+type Client struct {
+	client         *http.Client
+	baseURL        string
+	header         http.Header
+	tlsConfig      *cert.TLSConfig
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+type ClientOption func(*Client)
+
+// ClientWithHTTPClient sets the http.Client. The default is a new http.Client
+// with the http.DefaultTransport.
+func ClientWithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		if client != nil {
+			c.client = client
+		}
+	}
+}
+
+// ClientWithTLSConfig sets the TLS configuration of the transport with the
+// tls.Config from cert.ConfigureTLS.
+//
+// If set with ClientWithHTTPClient, the transport of the http.Client must be
+// nil or an *http.Transport.
+func ClientWithTLSConfig(tlsConfig *cert.TLSConfig) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// ClientWithHeader adds a header that is sent with every request.
+func ClientWithHeader(key string, value string) ClientOption {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// ClientWithRetries sets how many times a request that fails with an
+// Unavailable or ResourceExhausted error is retried, except for a request body
+// that is too large.
+//
+// Requests that fail in the transport are retried as Unavailable, even if the
+// server may have processed the request. The default is not to retry.
+func ClientWithRetries(maxRetries int) ClientOption {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+	}
+}
+
+// ClientWithBackoff sets the delay before retrying a request.
+//
+// The delay starts at initial and doubles with every retry, up to max. A
+// Retry-After header in the response takes precedence. The default is 100ms,
+// up to 5s.
+func ClientWithBackoff(initial time.Duration, max time.Duration) ClientOption {
+	return func(c *Client) {
+		c.initialBackoff = initial
+		c.maxBackoff = max
+	}
+}
+
+// NewClient returns a new Client that sends requests to paths relative to baseURL.
+func NewClient(baseURL string, opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		client:         &http.Client{},
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		header:         make(http.Header),
+		initialBackoff: defaultClientInitialBackoff,
+		maxBackoff:     defaultClientMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tlsConfig != nil {
+		tlsConfig, err := cert.ConfigureTLS(c.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		var transport *http.Transport
+		switch t := c.client.Transport.(type) {
+		case nil:
+			transport = http.DefaultTransport.(*http.Transport).Clone()
+		case *http.Transport:
+			transport = t.Clone()
+		default:
+			return nil, fmt.Errorf("cannot set the TLS configuration of transport %T", t)
+		}
+		transport.TLSClientConfig = tlsConfig
+		client := *c.client
+		client.Transport = transport
+		c.client = &client
+	}
+	return c, nil
+}
+
+// Get sends a GET request, and returns the data of the SuccessResponse.
+func Get[T any](ctx context.Context, client *Client, path string) (T, error) {
+	return Do[T](ctx, client, http.MethodGet, path, nil)
+}
+
+// Post sends a POST request with body as JSON, and returns the data of the SuccessResponse.
+func Post[T any](ctx context.Context, client *Client, path string, body interface{}) (T, error) {
+	return Do[T](ctx, client, http.MethodPost, path, body)
+}
+
+// Put sends a PUT request with body as JSON, and returns the data of the SuccessResponse.
+func Put[T any](ctx context.Context, client *Client, path string, body interface{}) (T, error) {
+	return Do[T](ctx, client, http.MethodPut, path, body)
+}
+
+// Patch sends a PATCH request with body as JSON, and returns the data of the SuccessResponse.
+func Patch[T any](ctx context.Context, client *Client, path string, body interface{}) (T, error) {
+	return Do[T](ctx, client, http.MethodPatch, path, body)
+}
+
+// Delete sends a DELETE request, and returns the data of the SuccessResponse.
+func Delete[T any](ctx context.Context, client *Client, path string) (T, error) {
+	return Do[T](ctx, client, http.MethodDelete, path, nil)
+}
+
+// Do sends a request with body as JSON, unless nil, and returns the data of the
+// SuccessResponse decoded into T.
+//
+// A response with an error status is returned as the errorsext error for the
+// status, as returned by NewErrorFromFailure. The request ID of ctx, if any, is
+// sent in the RequestIDHeader.
+func Do[T any](ctx context.Context, client *Client, method string, path string, body interface{}) (T, error) {
+	var result T
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return result, errorsext.ThrowInvalidArgument(err, "", "failed to encode the request body")
+		}
+	}
+	backoff := client.initialBackoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, retry, err := client.do(ctx, method, path, data, &result)
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= client.maxRetries || !retry {
+			return result, err
+		}
+		delay := retryAfter
+		if delay <= 0 {
+			delay = backoff
+			backoff = min(2*backoff, client.maxBackoff)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
+// NewErrorFromFailure returns the errorsext error for the code of the
+// FailureResponse, with its reason, message, and details.
+//
+// This is the inverse of Failure, so errors keep their class between services.
+func NewErrorFromFailure(failure *FailureResponse) error {
+	var throw func(cause error, reason, message string) error
+	switch failure.Code {
+	case http.StatusConflict:
+		throw = errorsext.ThrowAlreadyExists
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		throw = errorsext.ThrowDeadlineExceeded
+	case http.StatusBadRequest:
+		throw = errorsext.ThrowInvalidArgument
+	case http.StatusNotFound:
+		throw = errorsext.ThrowNotFound
+	case http.StatusPreconditionFailed:
+		throw = errorsext.ThrowPreconditionFailed
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
+		throw = errorsext.ThrowResourceExhausted
+	case http.StatusUnauthorized:
+		throw = errorsext.ThrowUnauthenticated
+	case http.StatusServiceUnavailable:
+		throw = errorsext.ThrowUnavailable
+	case http.StatusNotImplemented:
+		throw = errorsext.ThrowUnimplemented
+	case http.StatusForbidden:
+		throw = errorsext.ThrowPermissionDenied
+	case http.StatusInternalServerError:
+		throw = errorsext.ThrowInternal
+	default:
+		throw = errorsext.ThrowUnknown
+	}
+	err := throw(nil, failure.Reason, failure.Message)
+	if len(failure.Details) > 0 {
+		err.(errorsext.Error).WithDetails(failure.Details)
+	}
+	return err
+}
+
+// do sends the request once. If it failed, do returns the delay of the
+// Retry-After header of the response, if any, and whether it can be retried.
+//
+// Requests that failed to connect, or with the 429 Too Many Requests and 503
+// Service Unavailable statuses are retried, but not a request that is too
+// large, even though that is ResourceExhausted too.
+func (c *Client) do(ctx context.Context, method string, path string, data []byte, result interface{}) (time.Duration, bool, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		return 0, false, errorsext.ThrowInvalidArgument(err, "", err.Error())
+	}
+	for key, values := range c.header {
+		request.Header[key] = append([]string(nil), values...)
+	}
+	request.Header.Set("Accept", "application/json")
+	if data != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if requestID, ok := RequestIDFromContext(ctx); ok {
+		request.Header.Set(RequestIDHeader, requestID)
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, false, ctx.Err()
+		}
+		return 0, true, errorsext.ThrowUnavailable(err, "", err.Error())
+	}
+	defer response.Body.Close()
+	responseData, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, true, errorsext.ThrowUnavailable(err, "", err.Error())
+	}
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		retry := response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable
+		return parseRetryAfter(response.Header.Get("Retry-After")), retry, newErrorFromResponse(response.StatusCode, responseData)
+	}
+	if len(bytes.TrimSpace(responseData)) == 0 {
+		return 0, false, nil
+	}
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{
+		Data: result,
+	}
+	if err := json.Unmarshal(responseData, &envelope); err != nil {
+		return 0, false, errorsext.ThrowInternal(err, "", "failed to decode the response body")
+	}
+	return 0, false, nil
+}
+
+// newErrorFromResponse returns the error for a response with an error status.
+//
+// Bodies that are not a FailureResponse are used as the message.
+func newErrorFromResponse(statusCode int, data []byte) error {
+	failure := &FailureResponse{}
+	if err := json.Unmarshal(data, failure); err != nil || (failure.Reason == "" && failure.Message == "") {
+		failure = &FailureResponse{
+			Message: strings.TrimSpace(string(data)),
+		}
+		if failure.Message == "" {
+			failure.Message = http.StatusText(statusCode)
+		}
+	}
+	failure.Code = statusCode
+	return NewErrorFromFailure(failure)
+}
+
+// parseRetryAfter returns the delay of a Retry-After header in seconds or as
+// an HTTP date, or zero if invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
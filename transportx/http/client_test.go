@@ -0,0 +1,251 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aesoper101/x/cert"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				render := NewJSONResponseRender(w)
+				switch r.URL.Path {
+				case "/api/users/1":
+					assert.Equal(t, "token", r.Header.Get("Authorization"))
+					assert.Equal(t, "abc-123", r.Header.Get(RequestIDHeader))
+					Success(render, "ok", testUser{ID: 1, Name: "foo"})
+				case "/api/users":
+					assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+					var user testUser
+					assert.NoError(t, json.NewDecoder(r.Body).Decode(&user))
+					user.ID = 2
+					Success(render, "created", user)
+				case "/api/empty":
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					http.NotFound(w, r)
+				}
+			},
+		),
+	)
+	defer server.Close()
+	client, err := NewClient(
+		server.URL+"/api/",
+		ClientWithHTTPClient(newTestClient(nil)),
+		ClientWithHeader("Authorization", "token"),
+	)
+	require.NoError(t, err)
+	ctx := contextWithRequestID("abc-123")
+
+	user, err := Get[testUser](ctx, client, "/users/1")
+	require.NoError(t, err)
+	assert.Equal(t, testUser{ID: 1, Name: "foo"}, user)
+
+	created, err := Post[*testUser](ctx, client, "users", testUser{Name: "bar"})
+	require.NoError(t, err)
+	assert.Equal(t, &testUser{ID: 2, Name: "bar"}, created)
+
+	empty, err := Delete[map[string]string](ctx, client, "/empty")
+	require.NoError(t, err)
+	assert.Nil(t, empty)
+
+	_, err = Get[testUser](ctx, client, "/missing")
+	assert.True(t, errorsext.IsNotFound(err))
+	var xErr errorsext.Error
+	require.ErrorAs(t, err, &xErr)
+	assert.Equal(t, "404 page not found", xErr.Message())
+}
+
+func TestClientErrors(t *testing.T) {
+	t.Parallel()
+	details := map[string]interface{}{"field": "name"}
+	for _, tc := range []struct {
+		name  string
+		err   error
+		check func(error) bool
+	}{
+		{"already exists", errorsext.ThrowAlreadyExists(nil, "UserExists", "user exists"), errorsext.IsErrorAlreadyExists},
+		{"deadline exceeded", errorsext.ThrowDeadlineExceeded(nil, "Timeout", "too slow"), errorsext.IsDeadlineExceeded},
+		{"invalid argument", errorsext.ThrowInvalidArgument(nil, "BadName", "bad name"), errorsext.IsErrorInvalidArgument},
+		{"not found", errorsext.ThrowNotFound(nil, "NoUser", "no user"), errorsext.IsNotFound},
+		{"precondition failed", errorsext.ThrowPreconditionFailed(nil, "Stale", "stale"), errorsext.IsPreconditionFailed},
+		{"resource exhausted", errorsext.ThrowResourceExhausted(nil, "Quota", "over quota"), errorsext.IsResourceExhausted},
+		{"unauthenticated", errorsext.ThrowUnauthenticated(nil, "NoToken", "no token"), errorsext.IsUnauthenticated},
+		{"unavailable", errorsext.ThrowUnavailable(nil, "Down", "down"), errorsext.IsUnavailable},
+		{"unimplemented", errorsext.ThrowUnimplemented(nil, "NoImpl", "no impl"), errorsext.IsUnimplemented},
+		{"permission denied", errorsext.ThrowPermissionDenied(nil, "NoAccess", "no access"), errorsext.IsPermissionDenied},
+		{"internal", errorsext.ThrowInternal(nil, "Bug", "bug"), errorsext.IsInternal},
+	} {
+		tc := tc
+		t.Run(
+			tc.name, func(t *testing.T) {
+				t.Parallel()
+				tc.err.(errorsext.Error).WithDetails(details)
+				server := httptest.NewServer(
+					http.HandlerFunc(
+						func(w http.ResponseWriter, r *http.Request) {
+							Failure(NewJSONResponseRender(w), tc.err)
+						},
+					),
+				)
+				defer server.Close()
+				client, err := NewClient(server.URL, ClientWithHTTPClient(newTestClient(nil)))
+				require.NoError(t, err)
+				_, err = Get[testUser](context.Background(), client, "/")
+				assert.True(t, tc.check(err), err)
+				var expected, actual errorsext.Error
+				require.ErrorAs(t, tc.err, &expected)
+				require.ErrorAs(t, err, &actual)
+				if !errorsext.IsInternal(tc.err) {
+					// Failure hides the reason and message of internal errors.
+					assert.Equal(t, expected.Reason(), actual.Reason())
+					assert.Equal(t, expected.Message(), actual.Message())
+				}
+				assert.Equal(t, details, actual.Details())
+			},
+		)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	t.Parallel()
+	var attempts atomic.Int32
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, `{"id":1,"name":"foo"}`, string(body))
+				switch attempts.Add(1) {
+				case 1:
+					Failure(NewJSONResponseRender(w), errorsext.ThrowUnavailable(nil, "Down", "down"))
+				case 2:
+					w.Header().Set("Retry-After", "0")
+					Failure(NewJSONResponseRender(w), errorsext.ThrowResourceExhausted(nil, "Quota", "over quota"))
+				default:
+					Success(NewJSONResponseRender(w), "ok", "done")
+				}
+			},
+		),
+	)
+	defer server.Close()
+	client, err := NewClient(
+		server.URL,
+		ClientWithHTTPClient(newTestClient(nil)),
+		ClientWithRetries(2),
+		ClientWithBackoff(time.Millisecond, time.Millisecond),
+	)
+	require.NoError(t, err)
+	result, err := Put[string](context.Background(), client, "/", testUser{ID: 1, Name: "foo"})
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+	assert.Equal(t, int32(3), attempts.Load())
+
+	attempts.Store(0)
+	client, err = NewClient(
+		server.URL,
+		ClientWithHTTPClient(newTestClient(nil)),
+		ClientWithRetries(1),
+		ClientWithBackoff(time.Millisecond, time.Millisecond),
+	)
+	require.NoError(t, err)
+	_, err = Put[string](context.Background(), client, "/", testUser{ID: 1, Name: "foo"})
+	assert.True(t, errorsext.IsResourceExhausted(err))
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestClientDoesNotRetry(t *testing.T) {
+	t.Parallel()
+	var attempts atomic.Int32
+	server := httptest.NewServer(
+		BodyLimit(1)(
+			http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					attempts.Add(1)
+					Failure(NewJSONResponseRender(w), errorsext.ThrowNotFound(nil, "", "not found"))
+				},
+			),
+		),
+	)
+	defer server.Close()
+	client, err := NewClient(
+		server.URL,
+		ClientWithHTTPClient(newTestClient(nil)),
+		ClientWithRetries(3),
+		ClientWithBackoff(time.Millisecond, time.Millisecond),
+	)
+	require.NoError(t, err)
+	_, err = Get[string](context.Background(), client, "/")
+	assert.True(t, errorsext.IsNotFound(err))
+	assert.Equal(t, int32(1), attempts.Load())
+
+	_, err = Post[string](context.Background(), client, "/", "too large")
+	assert.True(t, errorsext.IsResourceExhausted(err))
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestClientTLS(t *testing.T) {
+	t.Parallel()
+	certPEM, keyPEM := newTestCertificate(t)
+	server := NewServer(
+		WithAddress("127.0.0.1", 0),
+		WithHandler(
+			http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					Success(NewJSONResponseRender(w), "ok", "secure")
+				},
+			),
+		),
+		WithTLSConfig(&cert.TLSConfig{CertPEM: certPEM, KeyPEM: keyPEM}),
+	)
+	endpoint, err := server.Endpoint()
+	require.NoError(t, err)
+	stop := startTestServer(t, server)
+	defer stop()
+	client, err := NewClient(
+		endpoint.String(),
+		ClientWithHTTPClient(newTestClient(nil)),
+		ClientWithTLSConfig(&cert.TLSConfig{CAPem: certPEM, Address: "localhost"}),
+	)
+	require.NoError(t, err)
+	result, err := Get[string](context.Background(), client, "/")
+	require.NoError(t, err)
+	assert.Equal(t, "secure", result)
+
+	_, err = NewClient(
+		endpoint.String(),
+		ClientWithHTTPClient(&http.Client{Transport: http.NewFileTransport(http.Dir("."))}),
+		ClientWithTLSConfig(&cert.TLSConfig{}),
+	)
+	assert.Error(t, err)
+}
+
+func contextWithRequestID(requestID string) context.Context {
+	var ctx context.Context
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, requestID)
+	RequestID()(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				ctx = r.Context()
+			},
+		),
+	).ServeHTTP(httptest.NewRecorder(), request)
+	return ctx
+}
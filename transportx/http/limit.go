@@ -0,0 +1,121 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/aesoper101/x/transportx/limit"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader is the header of the API key of KeyByAPIKey.
+const APIKeyHeader = "X-Api-Key"
+
+// KeyFunc returns the key that a request is rate limited by.
+//
+// Requests with an empty key share a single limit.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP returns a KeyFunc that limits requests by the IP address of the
+// client connection.
+//
+// Forwarded headers are ignored, since clients can set them to any value.
+func KeyByIP() KeyFunc {
+	return func(r *http.Request) string {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+}
+
+// KeyByHeader returns a KeyFunc that limits requests by the value of the header.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByAPIKey returns a KeyFunc that limits requests by the API key of the
+// X-Api-Key header, or else the bearer token of the Authorization header.
+//
+// The key is hashed, so that the limiter does not hold the secrets.
+func KeyByAPIKey() KeyFunc {
+	return func(r *http.Request) string {
+		apiKey := r.Header.Get(APIKeyHeader)
+		if apiKey == "" {
+			authorization := r.Header.Get("Authorization")
+			if scheme, token, ok := strings.Cut(authorization, " "); ok && strings.EqualFold(scheme, "Bearer") {
+				apiKey = strings.TrimSpace(token)
+			}
+		}
+		if apiKey == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(apiKey))
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// RateLimit returns a Middleware that limits the rate of requests per key of
+// the KeyFunc with the limit.RateLimiter.
+//
+// Requests over the limit are rejected with a ResourceExhausted error rendered
+// with RenderFailure, and a Retry-After header with the seconds until the
+// request would be allowed.
+func RateLimit(limiter *limit.RateLimiter, key KeyFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if ok, retryAfter := limiter.Allow(key(r)); !ok {
+					setRetryAfter(w, retryAfter)
+					RenderFailure(w, r, errorsext.ThrowResourceExhausted(nil, "RateLimited", "too many requests"))
+					return
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// ConcurrencyLimit returns a Middleware that limits the number of requests in
+// flight with the limit.ConcurrencyLimiter.
+//
+// Requests over the limit are rejected with an Unavailable error rendered with
+// RenderFailure, and a Retry-After header of one second. Requests that panic,
+// time out, or fail with a 5xx status are released as dropped, so that the
+// limit shrinks while the server is overloaded.
+func ConcurrencyLimit(limiter *limit.ConcurrencyLimiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				release, ok := limiter.Acquire()
+				if !ok {
+					setRetryAfter(w, time.Second)
+					RenderFailure(w, r, errorsext.ThrowUnavailable(nil, "Overloaded", "the server is overloaded"))
+					return
+				}
+				dropped := true
+				defer func() {
+					release(dropped)
+				}()
+				recorder := newResponseRecorder(w)
+				next.ServeHTTP(recorder, r)
+				dropped = recorder.statusCode >= http.StatusInternalServerError ||
+					recorder.statusCode == http.StatusRequestTimeout
+			},
+		)
+	}
+}
+
+// setRetryAfter sets the Retry-After header to the delay, rounded up to whole seconds.
+func setRetryAfter(w http.ResponseWriter, delay time.Duration) {
+	seconds := int64(math.Ceil(delay.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(max(seconds, 1), 10))
+}
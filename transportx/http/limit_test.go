@@ -0,0 +1,120 @@
+package http
+
+import (
+	"github.com/aesoper101/x/transportx/limit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKeyFuncs(t *testing.T) {
+	t.Parallel()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	request.Header.Set("X-Forwarded-For", "198.51.100.1")
+	request.Header.Set("X-Tenant", "acme")
+	assert.Equal(t, "192.0.2.1", KeyByIP()(request))
+	assert.Equal(t, "acme", KeyByHeader("X-Tenant")(request))
+	assert.Empty(t, KeyByAPIKey()(request))
+
+	request.Header.Set("Authorization", "Bearer secret")
+	bearerKey := KeyByAPIKey()(request)
+	assert.NotEmpty(t, bearerKey)
+	assert.NotContains(t, bearerKey, "secret")
+	request.Header.Set(APIKeyHeader, "secret")
+	assert.Equal(t, bearerKey, KeyByAPIKey()(request))
+	request.Header.Set(APIKeyHeader, "other")
+	assert.NotEqual(t, bearerKey, KeyByAPIKey()(request))
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+	limiter := limit.NewRateLimiter(0.5, 1)
+	handler := RateLimit(limiter, KeyByHeader("X-Tenant"))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(tenant string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("X-Tenant", tenant)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	assert.Equal(t, http.StatusOK, serve("a").Code)
+	assert.Equal(t, http.StatusOK, serve("b").Code)
+	response := serve("a")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "2", response.Header().Get("Retry-After"))
+	assert.Equal(t, "RateLimited", decodeFailure(t, response).Reason)
+	assert.Equal(t, limit.RateLimiterStats{Rate: 0.5, Burst: 1, Keys: 2, Allowed: 2, Rejected: 1}, limiter.Stats())
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+	limiter := limit.NewConcurrencyLimiter(limit.ConcurrencyLimiterWithLimits(2, 1, 2))
+	startedC := make(chan struct{})
+	releaseC := make(chan struct{})
+	handler := ConcurrencyLimit(limiter)(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/slow":
+					startedC <- struct{}{}
+					<-releaseC
+				case "/fail":
+					w.WriteHeader(http.StatusInternalServerError)
+				case "/panic":
+					panic("boom")
+				}
+			},
+		),
+	)
+	serve := func(path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		return response
+	}
+	doneC := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			serve("/slow")
+			doneC <- struct{}{}
+		}()
+		<-startedC
+	}
+	response := serve("/")
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.Equal(t, "1", response.Header().Get("Retry-After"))
+	assert.Equal(t, "Overloaded", decodeFailure(t, response).Reason)
+	close(releaseC)
+	<-doneC
+	<-doneC
+	assert.Equal(t, limit.ConcurrencyLimiterStats{Limit: 2, Accepted: 2, Rejected: 1}, limiter.Stats())
+
+	// Failed and panicked requests are dropped.
+	assert.Equal(t, http.StatusInternalServerError, serve("/fail").Code)
+	require.Panics(t, func() { serve("/panic") })
+	assert.Equal(t, uint64(2), limiter.Stats().Dropped)
+	assert.Equal(t, 0, limiter.Stats().InFlight)
+}
+
+func TestAdminHandlerLimiterStats(t *testing.T) {
+	t.Parallel()
+	rateLimiter := limit.NewRateLimiter(10, 5)
+	rateLimiter.Allow("a")
+	concurrencyLimiter := limit.NewConcurrencyLimiter()
+	handler := NewAdminHandler(
+		AdminWithLimiterStats("rate", func() any { return rateLimiter.Stats() }),
+		AdminWithLimiterStats("concurrency", func() any { return concurrencyLimiter.Stats() }),
+	)
+	response := serveAdmin(handler, http.MethodGet, "/debug/limiters", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(
+		t,
+		`{
+			"rate": {"rate": 10, "burst": 5, "keys": 1, "allowed": 1, "rejected": 0},
+			"concurrency": {"limit": 20, "in_flight": 0, "accepted": 0, "rejected": 0, "dropped": 0}
+		}`,
+		response.Body.String(),
+	)
+}
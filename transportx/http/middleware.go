@@ -0,0 +1,389 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aesoper101/x/contextext"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/aesoper101/x/tracing"
+	"github.com/aesoper101/x/uuidutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader is the header that carries the request ID.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength is the maximum length of a request ID accepted from a client.
+const maxRequestIDLength = 128
+
+// Middleware wraps an http.Handler.
+type Middleware func(http.Handler) http.Handler
+
+// Chain returns a Middleware that applies the middlewares in order, so the
+// first middleware is the outermost.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(handler http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID stored in ctx by RequestID, if any.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	return contextext.FromContext[requestIDKey, string](ctx, requestIDKey{})
+}
+
+// RequestID returns a Middleware that propagates the request ID.
+//
+// The request ID is taken from the RequestIDHeader of the request, or generated
+// with uuidutil if absent or invalid. It is stored in the request context and
+// set on the RequestIDHeader of the response.
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requestID := r.Header.Get(RequestIDHeader)
+				if !isValidRequestID(requestID) {
+					id, err := uuidutil.New()
+					if err != nil {
+						RenderFailure(w, r, errorsext.ThrowInternal(err, "", ""))
+						return
+					}
+					requestID = id.String()
+				}
+				w.Header().Set(RequestIDHeader, requestID)
+				ctx := contextext.NewContext[requestIDKey, string](r.Context(), requestIDKey{}, requestID)
+				next.ServeHTTP(w, r.WithContext(ctx))
+			},
+		)
+	}
+}
+
+// AccessLog returns a Middleware that logs every request with its status,
+// response size, and latency.
+//
+// Requests that fail with a server error are logged at the error level.
+func AccessLog(logger *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				start := time.Now()
+				recorder := newResponseRecorder(w)
+				defer func() {
+					level := zapcore.InfoLevel
+					if recorder.statusCode >= http.StatusInternalServerError {
+						level = zapcore.ErrorLevel
+					}
+					fields := []zap.Field{
+						zap.String("method", r.Method),
+						zap.String("path", r.URL.Path),
+						zap.Int("status", recorder.statusCode),
+						zap.Int64("bytes", recorder.bytes),
+						zap.Duration("latency", time.Since(start)),
+						zap.String("remote_addr", r.RemoteAddr),
+					}
+					if requestID, ok := RequestIDFromContext(r.Context()); ok {
+						fields = append(fields, zap.String("request_id", requestID))
+					}
+					logger.Log(level, "request", fields...)
+				}()
+				next.ServeHTTP(recorder, r)
+			},
+		)
+	}
+}
+
+// Recover returns a Middleware that recovers a panic in the handler, logs it,
+// and renders an Internal error with RenderFailure if the response has not
+// been written yet.
+//
+// A panic with http.ErrAbortHandler is not recovered.
+func Recover(logger *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				recorder := newResponseRecorder(w)
+				defer func() {
+					p := recover()
+					if p == nil {
+						return
+					}
+					if p == http.ErrAbortHandler {
+						panic(p)
+					}
+					fields := []zap.Field{
+						zap.String("method", r.Method),
+						zap.String("path", r.URL.Path),
+						zap.Any("panic", p),
+						zap.ByteString("stack", debug.Stack()),
+					}
+					if requestID, ok := RequestIDFromContext(r.Context()); ok {
+						fields = append(fields, zap.String("request_id", requestID))
+					}
+					logger.Error("handler panicked", fields...)
+					if !recorder.wroteHeader {
+						RenderFailure(recorder, r, errorsext.ThrowInternal(fmt.Errorf("panic: %v", p), "", ""))
+					}
+				}()
+				next.ServeHTTP(recorder, r)
+			},
+		)
+	}
+}
+
+// Trace returns a Middleware that starts a server span for every request.
+//
+// The trace context and baggage of the request are extracted with the W3C
+// propagators, so the span is a child of the span of the client. Responses
+// with a server error set the status of the span to error.
+func Trace(tracer tracing.Tracer) Middleware {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+				var retErr error
+				ctx, span := tracer.Start(
+					ctx,
+					tracing.WithSpanName(r.Method),
+					tracing.WithSpanKind(trace.SpanKindServer),
+					tracing.WithErr(&retErr),
+					tracing.WithAttributes(
+						semconv.HTTPRequestMethodKey.String(r.Method),
+						semconv.URLPath(r.URL.Path),
+						semconv.URLScheme(getScheme(r)),
+						semconv.ServerAddress(r.Host),
+						semconv.UserAgentOriginal(r.UserAgent()),
+					),
+				)
+				defer span.End()
+				if requestID, ok := RequestIDFromContext(ctx); ok {
+					span.SetAttributes(attribute.String("http.request.id", requestID))
+				}
+				recorder := newResponseRecorder(w)
+				next.ServeHTTP(recorder, r.WithContext(ctx))
+				span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.statusCode))
+				if recorder.statusCode >= http.StatusInternalServerError {
+					retErr = errors.New(http.StatusText(recorder.statusCode))
+				}
+			},
+		)
+	}
+}
+
+// Timeout returns a Middleware that cancels the context of the request after
+// the timeout, and renders a DeadlineExceeded error with RenderFailure if the
+// handler has not returned by then.
+//
+// The response of the handler is buffered, and discarded if the timeout
+// expires first. Apply Timeout to the handlers of individual routes to use a
+// different timeout per route.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				ctx, cancel := context.WithTimeout(r.Context(), timeout)
+				defer cancel()
+				tw := &timeoutWriter{header: make(http.Header)}
+				panicC := make(chan interface{}, 1)
+				doneC := make(chan struct{})
+				go func() {
+					defer func() {
+						if p := recover(); p != nil {
+							panicC <- p
+						}
+					}()
+					next.ServeHTTP(tw, r.WithContext(ctx))
+					close(doneC)
+				}()
+				select {
+				case p := <-panicC:
+					// Panic on the goroutine of the request, so Recover can recover it.
+					panic(p)
+				case <-doneC:
+					tw.lock.Lock()
+					defer tw.lock.Unlock()
+					for key, values := range tw.header {
+						w.Header()[key] = values
+					}
+					if !tw.wroteHeader {
+						tw.statusCode = http.StatusOK
+					}
+					w.WriteHeader(tw.statusCode)
+					_, _ = w.Write(tw.buf.Bytes())
+				case <-ctx.Done():
+					tw.lock.Lock()
+					defer tw.lock.Unlock()
+					tw.timedOut = true
+					if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+						RenderFailure(
+							w,
+							r,
+							errorsext.ThrowDeadlineExceededF(ctx.Err(), "", "request did not complete within %v", timeout),
+						)
+					}
+				}
+			},
+		)
+	}
+}
+
+// BodyLimit returns a Middleware that limits the size of request bodies to
+// maxBytes.
+//
+// Requests with a larger Content-Length are rejected with a ResourceExhausted
+// error rendered by RenderFailure. Otherwise, reading beyond maxBytes from the
+// body returns a ResourceExhausted error that wraps *http.MaxBytesError, which
+// is rendered as 413 Request Entity Too Large.
+func BodyLimit(maxBytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.ContentLength > maxBytes {
+					RenderFailure(
+						w,
+						r,
+						errorsext.ThrowResourceExhaustedF(
+							&http.MaxBytesError{Limit: maxBytes},
+							"",
+							"request body is larger than %d bytes",
+							maxBytes,
+						),
+					)
+					return
+				}
+				if r.Body != nil && r.Body != http.NoBody {
+					r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, maxBytes), maxBytes: maxBytes}
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// responseRecorder records the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (w *responseRecorder) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the http.ResponseWriter for http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// timeoutWriter buffers a response until the handler returns.
+type timeoutWriter struct {
+	header http.Header
+
+	lock        sync.Mutex
+	buf         bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(statusCode int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.timedOut || w.wroteHeader {
+		return
+	}
+	w.statusCode = statusCode
+	w.wroteHeader = true
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !w.wroteHeader {
+		w.statusCode = http.StatusOK
+		w.wroteHeader = true
+	}
+	return w.buf.Write(data)
+}
+
+// limitedBody converts the *http.MaxBytesError of http.MaxBytesReader to a
+// ResourceExhausted error.
+type limitedBody struct {
+	io.ReadCloser
+	maxBytes int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		err = errorsext.ThrowResourceExhaustedF(err, "", "request body is larger than %d bytes", b.maxBytes)
+	}
+	return n, err
+}
+
+func getScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// isValidRequestID returns true if the request ID is non-empty, at most
+// maxRequestIDLength long, and only has visible ASCII characters, so it is safe
+// to log and echo back.
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < '!' || requestID[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,269 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/aesoper101/x/tracing"
+	"github.com/aesoper101/x/uuidutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+	var order []string
+	newMiddleware := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					order = append(order, name)
+					next.ServeHTTP(w, r)
+				},
+			)
+		}
+	}
+	handler := Chain(newMiddleware("a"), newMiddleware("b"), newMiddleware("c"))(newTestHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, []string{"a", "b", "c"}, order)
+}
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+	var requestID string
+	handler := RequestID()(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requestID, _ = RequestIDFromContext(r.Context())
+			},
+		),
+	)
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, "abc-123")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	assert.Equal(t, "abc-123", requestID)
+	assert.Equal(t, "abc-123", response.Header().Get(RequestIDHeader))
+
+	for _, invalid := range []string{"", "has space", strings.Repeat("a", maxRequestIDLength+1)} {
+		request = httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(RequestIDHeader, invalid)
+		response = httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		assert.NoError(t, uuidutil.Validate(requestID))
+		assert.Equal(t, requestID, response.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+	core, logs := observer.New(zapcore.InfoLevel)
+	handler := Chain(RequestID(), AccessLog(zap.New(core)))(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/fail" {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				_, _ = io.WriteString(w, "hello")
+			},
+		),
+	)
+	request := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	request.Header.Set(RequestIDHeader, "abc-123")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/fail", nil))
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "GET", fields["method"])
+	assert.Equal(t, "/hello", fields["path"])
+	assert.Equal(t, int64(http.StatusOK), fields["status"])
+	assert.Equal(t, int64(5), fields["bytes"])
+	assert.Equal(t, "abc-123", fields["request_id"])
+	assert.Contains(t, fields, "latency")
+	assert.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+	assert.Equal(t, int64(http.StatusBadGateway), entries[1].ContextMap()["status"])
+}
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	core, logs := observer.New(zapcore.InfoLevel)
+	handler := Recover(zap.New(core))(
+		http.HandlerFunc(
+			func(http.ResponseWriter, *http.Request) {
+				panic("boom")
+			},
+		),
+	)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	failure := decodeFailure(t, response)
+	assert.Equal(t, "InternalError", failure.Reason)
+	assert.NotContains(t, response.Body.String(), "boom")
+	require.Equal(t, 1, logs.FilterMessage("handler panicked").Len())
+	assert.Equal(t, "boom", logs.All()[0].ContextMap()["panic"])
+
+	handler = Recover(zap.NewNop())(
+		http.HandlerFunc(
+			func(http.ResponseWriter, *http.Request) {
+				panic(http.ErrAbortHandler)
+			},
+		),
+	)
+	assert.PanicsWithValue(
+		t,
+		http.ErrAbortHandler,
+		func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		},
+	)
+}
+
+func TestTrace(t *testing.T) {
+	t.Parallel()
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() {
+		assert.NoError(t, tracerProvider.Shutdown(context.Background()))
+	}()
+	var spanContext trace.SpanContext
+	handler := Trace(tracing.NewTracer(tracerProvider.Tracer("test")))(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				spanContext = trace.SpanContextFromContext(r.Context())
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+		),
+	)
+	request := httptest.NewRequest(http.MethodGet, "/traced", nil)
+	request.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", span.SpanContext().TraceID().String())
+	assert.Equal(t, "b7ad6b7169203331", span.Parent().SpanID().String())
+	assert.True(t, span.Parent().IsRemote())
+	assert.Equal(t, span.SpanContext(), spanContext)
+	assert.Contains(t, span.Attributes(), semconv.URLPath("/traced"))
+	assert.Contains(t, span.Attributes(), semconv.HTTPResponseStatusCode(http.StatusServiceUnavailable))
+	assert.Equal(t, codes.Error, span.Status().Code)
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+	releaseC := make(chan struct{})
+	var lateErr error
+	lateDoneC := make(chan struct{})
+	handler := Timeout(10 * time.Millisecond)(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow" {
+					defer close(lateDoneC)
+					<-r.Context().Done()
+					<-releaseC
+					_, lateErr = io.WriteString(w, "late")
+					return
+				}
+				w.Header().Set("X-Test", "fast")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, "ok")
+			},
+		),
+	)
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, "fast", response.Header().Get("X-Test"))
+	assert.Equal(t, "ok", response.Body.String())
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusRequestTimeout, response.Code)
+	assert.Contains(t, decodeFailure(t, response).Message, "request did not complete within 10ms")
+	close(releaseC)
+	<-lateDoneC
+	assert.ErrorIs(t, lateErr, http.ErrHandlerTimeout)
+	assert.NotContains(t, response.Body.String(), "late")
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	t.Parallel()
+	handler := Chain(Recover(zap.NewNop()), Timeout(time.Second))(
+		http.HandlerFunc(
+			func(http.ResponseWriter, *http.Request) {
+				panic("boom")
+			},
+		),
+	)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestBodyLimit(t *testing.T) {
+	t.Parallel()
+	var readErr error
+	handler := BodyLimit(4)(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if _, readErr = io.ReadAll(r.Body); readErr != nil {
+					Failure(NewJSONResponseRender(w), readErr)
+					return
+				}
+				_, _ = io.WriteString(w, "ok")
+			},
+		),
+	)
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("1234")))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.NoError(t, readErr)
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.Equal(t, "request body is larger than 4 bytes", decodeFailure(t, response).Message)
+
+	// Without a Content-Length, the body is rejected when read.
+	request := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader("12345")))
+	request.ContentLength = -1
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.True(t, errorsext.IsResourceExhausted(readErr))
+	var maxBytesErr *http.MaxBytesError
+	assert.ErrorAs(t, readErr, &maxBytesErr)
+}
+
+func decodeFailure(t *testing.T, response *httptest.ResponseRecorder) *FailureResponse {
+	assert.Equal(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+	var failure FailureResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &failure))
+	assert.Equal(t, response.Code, failure.Code)
+	return &failure
+}
@@ -0,0 +1,242 @@
+package http
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aesoper101/x/joseutil"
+	jose "github.com/go-jose/go-jose/v4"
+	"go.uber.org/multierr"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// PageSizeParam is the query parameter of the maximum number of items in a page.
+	PageSizeParam = "page_size"
+	// PageTokenParam is the query parameter of the cursor of a page.
+	PageTokenParam = "page_token"
+
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	// maxPageTokenLength limits the size of a page token that is verified.
+	maxPageTokenLength = 4096
+)
+
+// ListResponse is the data of a SuccessResponse with a page of items.
+type ListResponse[T any] struct {
+	Items []T `json:"items"`
+	// Total is the number of items in all pages, if known.
+	Total *int64 `json:"total,omitempty"`
+	// PageSize is the maximum number of items in the page.
+	PageSize int `json:"page_size"`
+	// NextPageToken is the cursor of the next page, or empty on the last page.
+	NextPageToken string `json:"next_page_token,omitempty"`
+	// PrevPageToken is the cursor of the previous page, or empty on the first page.
+	PrevPageToken string `json:"prev_page_token,omitempty"`
+}
+
+// NewListResponse returns a ListResponse with the items of the page.
+//
+// Items is never nil, so that an empty page is rendered as [].
+func NewListResponse[T any](items []T, pageSize int) *ListResponse[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return &ListResponse[T]{Items: items, PageSize: pageSize}
+}
+
+// WithTotal sets the number of items in all pages.
+func (l *ListResponse[T]) WithTotal(total int64) *ListResponse[T] {
+	l.Total = &total
+	return l
+}
+
+// WithNextPageToken sets the cursor of the next page.
+func (l *ListResponse[T]) WithNextPageToken(token string) *ListResponse[T] {
+	l.NextPageToken = token
+	return l
+}
+
+// WithPrevPageToken sets the cursor of the previous page.
+func (l *ListResponse[T]) WithPrevPageToken(token string) *ListResponse[T] {
+	l.PrevPageToken = token
+	return l
+}
+
+// CursorCodec encodes cursors as opaque page tokens, which are signed so that
+// clients cannot forge or change them.
+//
+// A page token is a compact JWS with the JSON of the cursor as its payload.
+type CursorCodec struct {
+	signer          jose.Signer
+	algorithm       jose.SignatureAlgorithm
+	verificationKey interface{}
+}
+
+// NewHMACCursorCodec returns a CursorCodec that signs the page tokens with
+// HMAC SHA-256 and the secret key, which must be at least 32 bytes.
+func NewHMACCursorCodec(key []byte) (*CursorCodec, error) {
+	return newCursorCodec(jose.HS256, key, key)
+}
+
+// NewJWSCursorCodec returns a CursorCodec that signs the page tokens with the
+// private key and the algorithm, and verifies them with its public key.
+//
+// The key is a crypto.Signer or *jose.JSONWebKey, as returned by
+// joseutil.NewSigningKey or joseutil.LoadPrivateKey.
+func NewJWSCursorCodec(alg jose.SignatureAlgorithm, privateKey interface{}) (*CursorCodec, error) {
+	var publicKey interface{}
+	switch key := privateKey.(type) {
+	case *jose.JSONWebKey:
+		if key.IsPublic() {
+			return nil, errors.New("the key of a cursor codec must be a private key")
+		}
+		jwk := joseutil.ToPublicKey(key)
+		publicKey = &jwk
+	case crypto.Signer:
+		publicKey = key.Public()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T for a cursor codec", privateKey)
+	}
+	return newCursorCodec(alg, privateKey, publicKey)
+}
+
+func newCursorCodec(alg jose.SignatureAlgorithm, signingKey interface{}, verificationKey interface{}) (*CursorCodec, error) {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: signingKey}, nil)
+	if err != nil {
+		return nil, err
+	}
+	codec := &CursorCodec{
+		signer:          signer,
+		algorithm:       alg,
+		verificationKey: verificationKey,
+	}
+	// Fail early on keys that sign, but cannot verify, such as a short HMAC key.
+	token, err := codec.Encode(struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	if err := codec.Decode(token, &struct{}{}); err != nil {
+		return nil, err
+	}
+	return codec, nil
+}
+
+// Encode returns the page token of the cursor, which is encoded as JSON.
+func (c *CursorCodec) Encode(cursor interface{}) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	jws, err := c.signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+// Decode verifies the page token and decodes its cursor into the value
+// pointed to by cursor.
+func (c *CursorCodec) Decode(token string, cursor interface{}) error {
+	if len(token) > maxPageTokenLength {
+		return fmt.Errorf("page token is longer than %d bytes", maxPageTokenLength)
+	}
+	jws, err := jose.ParseSignedCompact(token, []jose.SignatureAlgorithm{c.algorithm})
+	if err != nil {
+		return err
+	}
+	payload, err := jws.Verify(c.verificationKey)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, cursor)
+}
+
+var errNoCursorCodec = errors.New("page tokens are not supported without a cursor codec")
+
+// PageOption is an option for ParsePage.
+type PageOption func(*pageOptions)
+
+type pageOptions struct {
+	defaultSize int
+	maxSize     int
+}
+
+// PageWithDefaultSize sets the page size if the request has none. The default is 20.
+func PageWithDefaultSize(size int) PageOption {
+	return func(o *pageOptions) {
+		o.defaultSize = size
+	}
+}
+
+// PageWithMaxSize sets the maximum page size of a request. The default is 100.
+func PageWithMaxSize(size int) PageOption {
+	return func(o *pageOptions) {
+		o.maxSize = size
+	}
+}
+
+// Page is a page of a list request.
+type Page[C any] struct {
+	// Size is the maximum number of items in the page.
+	Size int
+	// Cursor is the cursor of the page token, or nil for the first page.
+	Cursor *C
+}
+
+// ParsePage returns the page of the page_size and page_token query parameters,
+// with the cursor decoded by the codec.
+//
+// A page size that is not a number or outside of 1 and the maximum size, and
+// a page token that is forged or changed, return an errorsext.InvalidArgument
+// error with the []InvalidParam in the details as InvalidParamsKey. The codec
+// may be nil if the list has no page tokens, in which case any page token is
+// invalid.
+func ParsePage[C any](r *http.Request, codec *CursorCodec, opts ...PageOption) (Page[C], error) {
+	options := &pageOptions{
+		defaultSize: defaultPageSize,
+		maxSize:     maxPageSize,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	page := Page[C]{Size: min(options.defaultSize, options.maxSize)}
+	query := r.URL.Query()
+	var invalidParams []InvalidParam
+	var cause error
+	if value := query.Get(PageSizeParam); value != "" {
+		size, err := strconv.Atoi(value)
+		switch {
+		case err != nil:
+			cause = multierr.Append(cause, err)
+			invalidParams = append(invalidParams, InvalidParam{Name: PageSizeParam, Reason: "must be a number"})
+		case size < 1 || size > options.maxSize:
+			invalidParams = append(
+				invalidParams,
+				InvalidParam{Name: PageSizeParam, Reason: fmt.Sprintf("must be between 1 and %d", options.maxSize)},
+			)
+		default:
+			page.Size = size
+		}
+	}
+	if token := query.Get(PageTokenParam); token != "" {
+		var cursor C
+		err := errNoCursorCodec
+		if codec != nil {
+			err = codec.Decode(token, &cursor)
+		}
+		if err != nil {
+			cause = multierr.Append(cause, err)
+			invalidParams = append(invalidParams, InvalidParam{Name: PageTokenParam, Reason: "is invalid"})
+		} else {
+			page.Cursor = &cursor
+		}
+	}
+	if len(invalidParams) > 0 {
+		return Page[C]{}, newInvalidParamsError(cause, "pagination parameters are invalid", invalidParams)
+	}
+	return page, nil
+}
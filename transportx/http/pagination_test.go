@@ -0,0 +1,152 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/aesoper101/x/joseutil"
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type testCursor struct {
+	AfterID int `json:"after_id"`
+}
+
+func TestListResponse(t *testing.T) {
+	t.Parallel()
+	data, err := json.Marshal(NewListResponse[testUser](nil, 10))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"items":[],"page_size":10}`, string(data))
+
+	data, err = json.Marshal(
+		NewListResponse([]testUser{{ID: 1, Name: "foo"}}, 1).
+			WithTotal(2).
+			WithNextPageToken("next").
+			WithPrevPageToken("prev"),
+	)
+	require.NoError(t, err)
+	assert.JSONEq(
+		t,
+		`{
+			"items": [{"id": 1, "name": "foo"}],
+			"total": 2,
+			"page_size": 1,
+			"next_page_token": "next",
+			"prev_page_token": "prev"
+		}`,
+		string(data),
+	)
+}
+
+func TestCursorCodec(t *testing.T) {
+	t.Parallel()
+	hmacCodec, err := NewHMACCursorCodec([]byte(strings.Repeat("k", 32)))
+	require.NoError(t, err)
+	_, privateKey, err := joseutil.NewSigningKey(jose.ES256, 0)
+	require.NoError(t, err)
+	jwsCodec, err := NewJWSCursorCodec(jose.ES256, privateKey)
+	require.NoError(t, err)
+	_, edKey, err := joseutil.NewSigningKey(jose.EdDSA, 0)
+	require.NoError(t, err)
+	jwkCodec, err := NewJWSCursorCodec(jose.EdDSA, &jose.JSONWebKey{Key: edKey})
+	require.NoError(t, err)
+
+	for _, codec := range []*CursorCodec{hmacCodec, jwsCodec, jwkCodec} {
+		token, err := codec.Encode(testCursor{AfterID: 42})
+		require.NoError(t, err)
+		assert.NotContains(t, token, "after_id")
+		var cursor testCursor
+		require.NoError(t, codec.Decode(token, &cursor))
+		assert.Equal(t, testCursor{AfterID: 42}, cursor)
+
+		// A changed payload fails to verify.
+		parts := strings.Split(token, ".")
+		forged, err := json.Marshal(testCursor{AfterID: 1})
+		require.NoError(t, err)
+		parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+		assert.Error(t, codec.Decode(strings.Join(parts, "."), &cursor))
+	}
+
+	// Tokens of another key fail to verify.
+	otherCodec, err := NewHMACCursorCodec([]byte(strings.Repeat("o", 32)))
+	require.NoError(t, err)
+	token, err := otherCodec.Encode(testCursor{AfterID: 1})
+	require.NoError(t, err)
+	assert.Error(t, hmacCodec.Decode(token, &testCursor{}))
+	assert.Error(t, jwsCodec.Decode(token, &testCursor{}))
+
+	_, err = NewHMACCursorCodec([]byte("short"))
+	assert.Error(t, err)
+	_, err = NewJWSCursorCodec(jose.ES256, "key")
+	assert.Error(t, err)
+}
+
+func TestParsePage(t *testing.T) {
+	t.Parallel()
+	codec, err := NewHMACCursorCodec([]byte(strings.Repeat("k", 32)))
+	require.NoError(t, err)
+	token, err := codec.Encode(testCursor{AfterID: 42})
+	require.NoError(t, err)
+
+	page, err := ParsePage[testCursor](httptest.NewRequest(http.MethodGet, "/", nil), codec)
+	require.NoError(t, err)
+	assert.Equal(t, Page[testCursor]{Size: defaultPageSize}, page)
+
+	request := httptest.NewRequest(
+		http.MethodGet,
+		"/?"+url.Values{PageSizeParam: {"5"}, PageTokenParam: {token}}.Encode(),
+		nil,
+	)
+	page, err = ParsePage[testCursor](request, codec)
+	require.NoError(t, err)
+	assert.Equal(t, 5, page.Size)
+	assert.Equal(t, &testCursor{AfterID: 42}, page.Cursor)
+
+	page, err = ParsePage[testCursor](
+		httptest.NewRequest(http.MethodGet, "/", nil),
+		codec,
+		PageWithDefaultSize(50),
+		PageWithMaxSize(10),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 10, page.Size)
+
+	for _, tc := range []struct {
+		query    string
+		expected []InvalidParam
+	}{
+		{"page_size=x", []InvalidParam{{Name: PageSizeParam, Reason: "must be a number"}}},
+		{"page_size=0", []InvalidParam{{Name: PageSizeParam, Reason: "must be between 1 and 100"}}},
+		{"page_size=101", []InvalidParam{{Name: PageSizeParam, Reason: "must be between 1 and 100"}}},
+		{"page_token=" + token + "x", []InvalidParam{{Name: PageTokenParam, Reason: "is invalid"}}},
+		{
+			"page_size=-1&page_token=invalid",
+			[]InvalidParam{
+				{Name: PageSizeParam, Reason: "must be between 1 and 100"},
+				{Name: PageTokenParam, Reason: "is invalid"},
+			},
+		},
+	} {
+		_, err := ParsePage[testCursor](httptest.NewRequest(http.MethodGet, "/?"+tc.query, nil), codec)
+		require.True(t, errorsext.IsErrorInvalidArgument(err), tc.query)
+		assert.Equal(t, tc.expected, getInvalidParams(t, err), tc.query)
+	}
+}
+
+func TestParsePageWithoutCodec(t *testing.T) {
+	t.Parallel()
+	page, err := ParsePage[testCursor](httptest.NewRequest(http.MethodGet, "/?page_size=5", nil), nil)
+	require.NoError(t, err)
+	assert.Equal(t, Page[testCursor]{Size: 5}, page)
+
+	_, err = ParsePage[testCursor](httptest.NewRequest(http.MethodGet, "/?page_token=token", nil), nil)
+	require.True(t, errorsext.IsErrorInvalidArgument(err), err)
+	assert.Equal(t, []InvalidParam{{Name: PageTokenParam, Reason: "is invalid"}}, getInvalidParams(t, err))
+}
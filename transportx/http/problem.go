@@ -0,0 +1,249 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aesoper101/x/jsonschemaext"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// InvalidParamsKey is the key of the []InvalidParam in the details of a
+// FailureResponse, and the name of the RFC 7807 extension member.
+const InvalidParamsKey = "invalid-params"
+
+const (
+	MediaTypeJSON    = "application/json"
+	MediaTypeProblem = "application/problem+json"
+	MediaTypeText    = "text/plain"
+)
+
+// InvalidParam is the error of a single request parameter.
+type InvalidParam struct {
+	// Name is the name of the parameter in dot-notation: foo.bar.baz
+	Name string `json:"name"`
+	// Reason describes why the parameter is invalid.
+	Reason string `json:"reason"`
+	// Pointer is the JSON Pointer of the parameter in the request body, if any.
+	Pointer string `json:"pointer,omitempty"`
+}
+
+// FailureRenderer renders a FailureResponse in a media type.
+type FailureRenderer interface {
+	// MediaType returns the media type that is rendered, without parameters.
+	MediaType() string
+	// RenderFailure writes the FailureResponse as the response.
+	RenderFailure(w http.ResponseWriter, r *http.Request, failure *FailureResponse)
+}
+
+// defaultFailureRenderers is replaced by SetDefaultFailureRenderers while
+// RenderFailure may be called concurrently.
+var defaultFailureRenderers atomic.Pointer[[]FailureRenderer]
+
+func init() {
+	SetDefaultFailureRenderers(JSONFailureRenderer{}, ProblemFailureRenderer{}, TextFailureRenderer{})
+}
+
+// SetDefaultFailureRenderers sets the renderers that RenderFailure selects from.
+//
+// The first renderer is used if the client accepts none of them. The default
+// is JSONFailureRenderer, ProblemFailureRenderer, and TextFailureRenderer. It
+// is safe to call while requests are served.
+func SetDefaultFailureRenderers(renderers ...FailureRenderer) {
+	if len(renderers) > 0 {
+		renderers = append([]FailureRenderer(nil), renderers...)
+		defaultFailureRenderers.Store(&renderers)
+	}
+}
+
+// RenderFailure renders the FailureResponse for the cause with the renderer
+// selected by NegotiateFailureRenderer from the default renderers.
+func RenderFailure(w http.ResponseWriter, r *http.Request, cause error) {
+	renderer := NegotiateFailureRenderer(r.Header.Get("Accept"), *defaultFailureRenderers.Load()...)
+	renderer.RenderFailure(w, r, NewFailureResponse(cause))
+}
+
+// NegotiateFailureRenderer returns the renderer of the media type that is
+// preferred by the Accept header.
+//
+// Media ranges are weighted by their q parameter, and a renderer matches the
+// most specific range for its media type. Renderers with equal weight are
+// preferred in order, and the first renderer is returned if none is accepted.
+func NegotiateFailureRenderer(accept string, renderers ...FailureRenderer) FailureRenderer {
+	if len(renderers) == 0 {
+		return JSONFailureRenderer{}
+	}
+	mediaRanges := parseAccept(accept)
+	selected := renderers[0]
+	selectedQuality := 0.0
+	for _, renderer := range renderers {
+		if quality := getQuality(mediaRanges, renderer.MediaType()); quality > selectedQuality {
+			selected = renderer
+			selectedQuality = quality
+		}
+	}
+	return selected
+}
+
+// JSONFailureRenderer renders the FailureResponse as JSON.
+type JSONFailureRenderer struct{}
+
+func (JSONFailureRenderer) MediaType() string {
+	return MediaTypeJSON
+}
+
+func (JSONFailureRenderer) RenderFailure(w http.ResponseWriter, _ *http.Request, failure *FailureResponse) {
+	NewJSONResponseRender(w).JSON(failure.Code, failure)
+}
+
+// ProblemFailureRenderer renders the FailureResponse as RFC 7807 problem details.
+//
+// The message is the detail, the path of the request is the instance, and the
+// reason and details are extension members.
+type ProblemFailureRenderer struct {
+	// TypeBaseURL is the base URL of the problem types. The type of a failure
+	// with a reason is TypeBaseURL followed by the reason.
+	//
+	// If empty, the type is about:blank.
+	TypeBaseURL string
+}
+
+func (ProblemFailureRenderer) MediaType() string {
+	return MediaTypeProblem
+}
+
+func (p ProblemFailureRenderer) RenderFailure(w http.ResponseWriter, r *http.Request, failure *FailureResponse) {
+	problem := make(map[string]interface{}, len(failure.Details)+6)
+	for key, value := range failure.Details {
+		problem[key] = value
+	}
+	if failure.Reason != "" {
+		problem["reason"] = failure.Reason
+	}
+	problemType := "about:blank"
+	if p.TypeBaseURL != "" && failure.Reason != "" {
+		problemType = p.TypeBaseURL + failure.Reason
+	}
+	// The members defined by RFC 7807 take precedence over the details.
+	problem["type"] = problemType
+	problem["title"] = http.StatusText(failure.Code)
+	problem["status"] = failure.Code
+	if failure.Message != "" {
+		problem["detail"] = failure.Message
+	}
+	if r != nil && r.URL != nil {
+		problem["instance"] = r.URL.Path
+	}
+	data, err := json.Marshal(problem)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", MediaTypeProblem)
+	w.WriteHeader(failure.Code)
+	_, _ = w.Write(data)
+}
+
+// TextFailureRenderer renders the FailureResponse as plain text, with the
+// message on the first line followed by a line for every InvalidParam.
+type TextFailureRenderer struct{}
+
+func (TextFailureRenderer) MediaType() string {
+	return MediaTypeText
+}
+
+func (TextFailureRenderer) RenderFailure(w http.ResponseWriter, _ *http.Request, failure *FailureResponse) {
+	var text strings.Builder
+	message := failure.Message
+	if message == "" {
+		message = http.StatusText(failure.Code)
+	}
+	text.WriteString(message)
+	if failure.Reason != "" {
+		fmt.Fprintf(&text, " (%s)", failure.Reason)
+	}
+	text.WriteByte('\n')
+	if invalidParams, ok := failure.Details[InvalidParamsKey].([]InvalidParam); ok {
+		for _, invalidParam := range invalidParams {
+			fmt.Fprintf(&text, "- %s: %s\n", invalidParam.Name, invalidParam.Reason)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(failure.Code)
+	_, _ = w.Write([]byte(text.String()))
+}
+
+// newInvalidParams returns the InvalidParams for the jsonschema validation
+// error in err, if any.
+func newInvalidParams(err error) []InvalidParam {
+	fieldErrors := jsonschemaext.NewFieldErrors(err)
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+	invalidParams := make([]InvalidParam, 0, len(fieldErrors))
+	for _, fieldError := range fieldErrors {
+		invalidParams = append(
+			invalidParams,
+			InvalidParam{
+				Name:    fieldError.DocumentFieldName,
+				Reason:  fieldError.Message,
+				Pointer: fieldError.DocumentPointer,
+			},
+		)
+	}
+	return invalidParams
+}
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns the media ranges of an Accept header, skipping invalid ranges.
+func parseAccept(accept string) []mediaRange {
+	var mediaRanges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		mediaRanges = append(mediaRanges, mediaRange{mediaType: mediaType, quality: quality})
+	}
+	return mediaRanges
+}
+
+// getQuality returns the quality of the most specific media range that
+// matches the media type, or zero if none matches.
+func getQuality(mediaRanges []mediaRange, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	quality := 0.0
+	specificity := -1
+	for _, mediaRange := range mediaRanges {
+		var s int
+		switch mediaRange.mediaType {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			quality = mediaRange.quality
+			specificity = s
+		}
+	}
+	return quality
+}
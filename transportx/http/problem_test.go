@@ -0,0 +1,188 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aesoper101/x/errorsext"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNegotiateFailureRenderer(t *testing.T) {
+	t.Parallel()
+	renderers := []FailureRenderer{JSONFailureRenderer{}, ProblemFailureRenderer{}, TextFailureRenderer{}}
+	for _, tc := range []struct {
+		accept   string
+		expected string
+	}{
+		{"", MediaTypeJSON},
+		{"*/*", MediaTypeJSON},
+		{"application/json", MediaTypeJSON},
+		{"application/problem+json", MediaTypeProblem},
+		{"application/*", MediaTypeJSON},
+		{"text/plain", MediaTypeText},
+		{"text/*", MediaTypeText},
+		{"text/html", MediaTypeJSON},
+		{"text/html, application/problem+json;q=0.9, */*;q=0.1", MediaTypeProblem},
+		{"application/json;q=0.5, text/plain", MediaTypeText},
+		{"application/*;q=0.5, application/problem+json;q=0", MediaTypeJSON},
+		{"text/plain;q=0, */*", MediaTypeJSON},
+		{"text/plain;q=2", MediaTypeJSON},
+		{"invalid;;, text/plain", MediaTypeText},
+	} {
+		assert.Equal(t, tc.expected, NegotiateFailureRenderer(tc.accept, renderers...).MediaType(), tc.accept)
+	}
+	assert.Equal(t, MediaTypeText, NegotiateFailureRenderer("", TextFailureRenderer{}).MediaType())
+	assert.Equal(t, MediaTypeJSON, NegotiateFailureRenderer("text/plain").MediaType())
+}
+
+func TestRenderFailure(t *testing.T) {
+	t.Parallel()
+	cause := errorsext.ThrowNotFound(nil, "UserNotFound", "user 1 not found")
+	cause.(errorsext.Error).WithDetails(map[string]interface{}{"id": 1, "status": "ignored"})
+
+	response := renderTestFailure("application/json", cause)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	failure := decodeFailure(t, response)
+	assert.Equal(t, "UserNotFound", failure.Reason)
+	assert.Equal(t, "user 1 not found", failure.Message)
+
+	response = renderTestFailure("application/problem+json", cause)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, MediaTypeProblem, response.Header().Get("Content-Type"))
+	assert.JSONEq(
+		t,
+		`{
+			"type": "about:blank",
+			"title": "Not Found",
+			"status": 404,
+			"detail": "user 1 not found",
+			"instance": "/users/1",
+			"reason": "UserNotFound",
+			"id": 1
+		}`,
+		response.Body.String(),
+	)
+
+	response = renderTestFailure("text/plain", cause)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Equal(t, "user 1 not found (UserNotFound)\n", response.Body.String())
+}
+
+func TestSetDefaultFailureRenderers(t *testing.T) {
+	// The default renderers are global, so the test does not run in parallel.
+	defer SetDefaultFailureRenderers(JSONFailureRenderer{}, ProblemFailureRenderer{}, TextFailureRenderer{})
+	cause := errorsext.ThrowNotFound(nil, "UserNotFound", "user 1 not found")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				renderTestFailure("", cause)
+			}
+		}()
+	}
+	renderers := []FailureRenderer{TextFailureRenderer{}, JSONFailureRenderer{}}
+	for i := 0; i < 100; i++ {
+		SetDefaultFailureRenderers(renderers...)
+	}
+	wg.Wait()
+	// The renderers are copied, so changing the slice has no effect.
+	renderers[0] = ProblemFailureRenderer{}
+	assert.Equal(t, "user 1 not found (UserNotFound)\n", renderTestFailure("", cause).Body.String())
+
+	// Without renderers, the default renderers are kept.
+	SetDefaultFailureRenderers()
+	assert.Equal(t, "text/plain; charset=utf-8", renderTestFailure("", cause).Header().Get("Content-Type"))
+}
+
+func TestProblemFailureRendererTypeBaseURL(t *testing.T) {
+	t.Parallel()
+	response := httptest.NewRecorder()
+	ProblemFailureRenderer{TypeBaseURL: "https://example.com/problems/"}.RenderFailure(
+		response,
+		httptest.NewRequest(http.MethodGet, "/", nil),
+		NewFailureResponse(errorsext.ThrowPermissionDenied(nil, "NoAccess", "")),
+	)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.JSONEq(
+		t,
+		`{
+			"type": "https://example.com/problems/NoAccess",
+			"title": "Forbidden",
+			"status": 403,
+			"instance": "/",
+			"reason": "NoAccess"
+		}`,
+		response.Body.String(),
+	)
+}
+
+func TestRenderFailureInvalidParams(t *testing.T) {
+	t.Parallel()
+	schema, err := jsonschema.UnmarshalJSON(
+		strings.NewReader(
+			`{
+				"type": "object",
+				"required": ["name"],
+				"properties": {"age": {"type": "integer", "minimum": 0}}
+			}`,
+		),
+	)
+	require.NoError(t, err)
+	compiler := jsonschema.NewCompiler()
+	require.NoError(t, compiler.AddResource("user.json", schema))
+	validator, err := compiler.Compile("user.json")
+	require.NoError(t, err)
+	document, err := jsonschema.UnmarshalJSON(strings.NewReader(`{"age": -1}`))
+	require.NoError(t, err)
+	validationErr := validator.Validate(document)
+	require.Error(t, validationErr)
+	cause := errorsext.ThrowInvalidArgument(validationErr, "InvalidUser", "the user is invalid")
+
+	response := renderTestFailure("application/problem+json", cause)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	var problem map[string]interface{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &problem))
+	assert.ElementsMatch(
+		t,
+		[]interface{}{
+			map[string]interface{}{"name": "name", "reason": "is required", "pointer": "/name"},
+			map[string]interface{}{"name": "age", "reason": "minimum: got -1, want 0", "pointer": "/age"},
+		},
+		problem[InvalidParamsKey],
+	)
+
+	response = renderTestFailure("application/json", cause)
+	failure := decodeFailure(t, response)
+	assert.Len(t, failure.Details[InvalidParamsKey], 2)
+	// The details of the error are not changed.
+	assert.Empty(t, cause.(errorsext.Error).Details())
+
+	response = renderTestFailure("text/plain", cause)
+	assert.Contains(t, response.Body.String(), "the user is invalid (InvalidUser)\n")
+	assert.Contains(t, response.Body.String(), "- name: is required\n")
+	assert.Contains(t, response.Body.String(), "- age: minimum: got -1, want 0\n")
+
+	// Invalid params that are already set are kept.
+	invalidParams := []InvalidParam{{Name: "id", Reason: "must be set"}}
+	explicit := errorsext.ThrowInvalidArgument(fmt.Errorf("wrapped: %w", validationErr), "", "invalid")
+	explicit.(errorsext.Error).WithDetails(map[string]interface{}{InvalidParamsKey: invalidParams})
+	assert.Equal(t, invalidParams, NewFailureResponse(explicit).Details[InvalidParamsKey])
+}
+
+func renderTestFailure(accept string, cause error) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	request.Header.Set("Accept", accept)
+	response := httptest.NewRecorder()
+	RenderFailure(response, request, cause)
+	return response
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"time"
@@ -22,6 +23,21 @@ type JSONResponseRender interface {
 	JSON(code int, data interface{})
 }
 
+// NewJSONResponseRender returns a JSONResponseRender that writes to the http.ResponseWriter.
+func NewJSONResponseRender(w http.ResponseWriter) JSONResponseRender {
+	return &jsonResponseRender{w: w}
+}
+
+type jsonResponseRender struct {
+	w http.ResponseWriter
+}
+
+func (r *jsonResponseRender) JSON(code int, data interface{}) {
+	r.w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	r.w.WriteHeader(code)
+	_ = json.NewEncoder(r.w).Encode(data)
+}
+
 type SuccessResponse struct {
 	Code      int         `json:"code"`
 	Message   string      `json:"message"`
@@ -54,19 +70,21 @@ type FailureResponse struct {
 	Timestamp time.Time              `json:"timestamp"`
 }
 
-func failure(render JSONResponseRender, statusCode int, reason, message string, details map[string]interface{}) {
-	resp := &FailureResponse{
-		Code:      statusCode,
-		Reason:    reason,
-		Message:   message,
-		Details:   details,
-		Timestamp: time.Now(),
-	}
-
-	render.JSON(statusCode, resp)
+// Failure renders the FailureResponse for the cause with the JSONResponseRender.
+//
+// Use RenderFailure to render it in the format that the client accepts.
+func Failure(render JSONResponseRender, cause error) {
+	failure := NewFailureResponse(cause)
+	render.JSON(failure.Code, failure)
 }
 
-func Failure(render JSONResponseRender, cause error) {
+// NewFailureResponse returns the FailureResponse for the cause.
+//
+// The status code is derived from the errorsext class of the cause. The reason
+// and message of internal and unknown errors are not exposed. If the cause has
+// a jsonschema validation error, the errors of its fields are added to the
+// details as InvalidParamsKey, unless already set.
+func NewFailureResponse(cause error) *FailureResponse {
 	var code int
 	var reason, message string
 	var details map[string]interface{}
@@ -92,6 +110,11 @@ func Failure(render JSONResponseRender, cause error) {
 	case errorsext.IsPreconditionFailed(cause):
 		code = http.StatusPreconditionFailed
 	case errorsext.IsResourceExhausted(cause):
+		code = http.StatusTooManyRequests
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(cause, &maxBytesErr) {
+			code = http.StatusRequestEntityTooLarge
+		}
 	case errorsext.IsUnauthenticated(cause):
 		code = http.StatusUnauthorized
 	case errorsext.IsUnavailable(cause):
@@ -112,5 +135,22 @@ func Failure(render JSONResponseRender, cause error) {
 		message = "oops, something went wrong"
 	}
 
-	failure(render, code, reason, message, details)
+	if _, ok := details[InvalidParamsKey]; !ok && code < http.StatusInternalServerError {
+		if invalidParams := newInvalidParams(cause); len(invalidParams) > 0 {
+			withInvalidParams := make(map[string]interface{}, len(details)+1)
+			for key, value := range details {
+				withInvalidParams[key] = value
+			}
+			withInvalidParams[InvalidParamsKey] = invalidParams
+			details = withInvalidParams
+		}
+	}
+
+	return &FailureResponse{
+		Code:      code,
+		Reason:    reason,
+		Message:   message,
+		Details:   details,
+		Timestamp: time.Now(),
+	}
 }
@@ -0,0 +1,277 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/aesoper101/x/cert"
+	"github.com/aesoper101/x/configext"
+	"github.com/aesoper101/x/transportx"
+	"go.uber.org/multierr"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+)
+
+// Server is an HTTP server that implements transportx.Server.
+//
+// The listener is created on the first call to Endpoint or Start, so the
+// endpoint of a server listening on port 0 is the port that was bound.
+type Server struct {
+	server    *http.Server
+	host      string
+	port      int
+	tlsConfig *cert.TLSConfig
+	endpoint  *url.URL
+
+	lock     sync.Mutex
+	listener net.Listener
+	err      error
+	// served is set once the listener is served, after which the http.Server
+	// closes it, and stopped once Stop is called.
+	served   bool
+	stopped  bool
+	serving  atomic.Bool
+	ready    chan struct{}
+	readyOne sync.Once
+}
+
+var errNotServing = errors.New("server is not serving")
+
+// ServerOption is an option of NewServer.
+type ServerOption func(*Server)
+
+// WithAddress sets the listen address, formatted with configext.GetAddress.
+//
+// The host may be unix:/path/to/socket to listen on a unix socket, in which
+// case the port is ignored. The default is to listen on all interfaces on a
+// random port.
+func WithAddress(host string, port int) ServerOption {
+	return func(s *Server) {
+		s.host = host
+		s.port = port
+	}
+}
+
+// WithHandler sets the handler. The default is http.NotFoundHandler.
+func WithHandler(handler http.Handler) ServerOption {
+	return func(s *Server) {
+		s.server.Handler = handler
+	}
+}
+
+// WithTLSConfig serves HTTPS with the tls.Config from cert.ConfigureTLS.
+func WithTLSConfig(tlsConfig *cert.TLSConfig) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = tlsConfig
+	}
+}
+
+// WithEndpoint sets the endpoint returned by Endpoint, instead of the bound address.
+func WithEndpoint(endpoint *url.URL) ServerOption {
+	return func(s *Server) {
+		s.endpoint = endpoint
+	}
+}
+
+func WithReadHeaderTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.server.ReadHeaderTimeout = timeout
+	}
+}
+
+func WithReadTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.server.ReadTimeout = timeout
+	}
+}
+
+func WithWriteTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.server.WriteTimeout = timeout
+	}
+}
+
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.server.IdleTimeout = timeout
+	}
+}
+
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		ready: make(chan struct{}),
+		server: &http.Server{
+			Handler:           http.NotFoundHandler(),
+			ReadHeaderTimeout: DefaultReadHeaderTimeout,
+			ReadTimeout:       DefaultReadTimeout,
+			WriteTimeout:      DefaultWriteTimeout,
+			IdleTimeout:       DefaultIdleTimeout,
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewHealthServer returns a new Server that serves the /healthz, /readyz, and
+// /livez endpoints of the Health.
+func NewHealthServer(health *transportx.Health, opts ...ServerOption) *Server {
+	return NewServer(append([]ServerOption{WithHandler(health.Handler())}, opts...)...)
+}
+
+// Endpoint returns the endpoint of the server, listening if not yet listening.
+//
+// If the server listens on all interfaces, the endpoint uses the loopback
+// address. Use WithEndpoint to publish a routable address instead.
+func (s *Server) Endpoint() (*url.URL, error) {
+	if err := s.listen(); err != nil {
+		return nil, err
+	}
+	return s.endpoint, nil
+}
+
+// Start serves until Stop is called.
+//
+// The context is the base context of all requests.
+func (s *Server) Start(ctx context.Context) error {
+	if err := s.listen(); err != nil {
+		return err
+	}
+	if !s.serve() {
+		return nil
+	}
+	s.server.BaseContext = func(net.Listener) context.Context {
+		return ctx
+	}
+	s.serving.Store(true)
+	defer s.serving.Store(false)
+	// Connections are accepted by the listener from here on.
+	s.readyOne.Do(func() { close(s.ready) })
+	var err error
+	if s.server.TLSConfig != nil {
+		// The certificates are already set on the tls.Config.
+		err = s.server.ServeTLS(s.listener, "", "")
+	} else {
+		err = s.server.Serve(s.listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop gracefully shuts down the server, closing all connections if the
+// context expires first.
+//
+// A listener that was created by Endpoint but never served is closed.
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.closeUnservedListener(); err != nil {
+		return err
+	}
+	err := s.server.Shutdown(ctx)
+	if err != nil && errors.Is(err, ctx.Err()) {
+		return multierr.Append(err, s.server.Close())
+	}
+	return err
+}
+
+// Ready returns a channel that is closed once the server is serving.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// HealthCheck returns an error if the server is not serving.
+func (s *Server) HealthCheck(context.Context) error {
+	if !s.serving.Load() {
+		return errNotServing
+	}
+	return nil
+}
+
+// serve marks the listener as served, and returns false if the server was
+// stopped before it was started.
+func (s *Server) serve() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.served = true
+	return true
+}
+
+// closeUnservedListener closes the listener if it was never served, since the
+// http.Server only closes the listeners that it serves.
+func (s *Server) closeUnservedListener() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stopped := s.stopped
+	s.stopped = true
+	if stopped || s.listener == nil || s.served {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) listen() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener != nil || s.err != nil {
+		return s.err
+	}
+	s.listener, s.err = s.newListener()
+	return s.err
+}
+
+func (s *Server) newListener() (net.Listener, error) {
+	if s.tlsConfig != nil {
+		tlsConfig, err := cert.ConfigureTLS(s.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		if len(tlsConfig.Certificates) == 0 {
+			return nil, cert.ErrNoCertOrKey
+		}
+		s.server.TLSConfig = tlsConfig
+	}
+	network, address := "tcp", configext.GetAddress(s.host, s.port)
+	if socketPath, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", socketPath
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if s.endpoint == nil {
+		s.endpoint = getEndpoint(listener.Addr(), s.server.TLSConfig != nil)
+	}
+	return listener, nil
+}
+
+func getEndpoint(addr net.Addr, isTLS bool) *url.URL {
+	if addr.Network() == "unix" {
+		return &url.URL{Scheme: "unix", Path: addr.String()}
+	}
+	scheme := "http"
+	if isTLS {
+		scheme = "https"
+	}
+	host := addr.String()
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok && tcpAddr.IP.IsUnspecified() {
+		host = net.JoinHostPort("127.0.0.1", strconv.Itoa(tcpAddr.Port))
+	}
+	return &url.URL{Scheme: scheme, Host: host}
+}
@@ -0,0 +1,269 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/aesoper101/x/cert"
+	"github.com/aesoper101/x/transportx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := NewServer(
+		WithAddress("127.0.0.1", 0),
+		WithHandler(
+			http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					appInfo, _ := transportx.FromContext(r.Context())
+					_, _ = io.WriteString(w, appInfo.Name())
+				},
+			),
+		),
+	)
+	var body string
+	err := transportx.Run(
+		transportx.WithContext(ctx),
+		transportx.Name("test"),
+		transportx.WithServers(server),
+		transportx.AfterStart(
+			func(ctx context.Context) error {
+				defer cancel()
+				appInfo, _ := transportx.FromContext(ctx)
+				require.Len(t, appInfo.Endpoints(), 1)
+				assert.Equal(t, "http", appInfo.Endpoints()[0].Scheme)
+				assert.NotEqual(t, "127.0.0.1:0", appInfo.Endpoints()[0].Host)
+				var err error
+				body, err = testGet(newTestClient(nil), appInfo.Endpoints()[0].String())
+				return err
+			},
+		),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "test", body)
+}
+
+func TestHealthServer(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	health := transportx.NewHealth()
+	server := NewHealthServer(health, WithAddress("127.0.0.1", 0))
+	endpoint, err := server.Endpoint()
+	require.NoError(t, err)
+	client := newTestClient(nil)
+	var body string
+	var getErr error
+	err = transportx.Run(
+		transportx.WithContext(ctx),
+		transportx.WithHealth(health),
+		transportx.WithServers(server),
+		transportx.AfterStart(
+			func(context.Context) error {
+				go func() {
+					defer cancel()
+					// The runner is ready once the AfterStart hooks have returned.
+					for !health.Ready() {
+						time.Sleep(time.Millisecond)
+					}
+					body, getErr = testGet(client, endpoint.String()+"/readyz")
+				}()
+				return nil
+			},
+		),
+	)
+	require.NoError(t, err)
+	require.NoError(t, getErr)
+	assert.JSONEq(
+		t,
+		`{"status":"ok","checks":{"runner":{"status":"ok"},"server-0":{"status":"ok"}}}`,
+		body,
+	)
+}
+
+func TestServerUnixSocket(t *testing.T) {
+	t.Parallel()
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	server := NewServer(WithAddress("unix:"+socketPath, 8080), WithHandler(newTestHandler()))
+	endpoint, err := server.Endpoint()
+	require.NoError(t, err)
+	assert.Equal(t, "unix://"+socketPath, endpoint.String())
+	stop := startTestServer(t, server)
+	defer stop()
+	client := newTestClient(
+		&http.Transport{
+			DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	)
+	body, err := testGet(client, "http://unix/")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", body)
+}
+
+func TestServerTLS(t *testing.T) {
+	t.Parallel()
+	certPEM, keyPEM := newTestCertificate(t)
+	server := NewServer(
+		WithAddress("127.0.0.1", 0),
+		WithHandler(newTestHandler()),
+		WithTLSConfig(&cert.TLSConfig{CertPEM: certPEM, KeyPEM: keyPEM}),
+	)
+	endpoint, err := server.Endpoint()
+	require.NoError(t, err)
+	assert.Equal(t, "https", endpoint.Scheme)
+	stop := startTestServer(t, server)
+	defer stop()
+	tlsConfig, err := cert.ConfigureTLS(&cert.TLSConfig{CAPem: certPEM, Address: "localhost"})
+	require.NoError(t, err)
+	body, err := testGet(newTestClient(&http.Transport{TLSClientConfig: tlsConfig}), endpoint.String())
+	require.NoError(t, err)
+	assert.Equal(t, "ok", body)
+
+	_, err = NewServer(WithTLSConfig(&cert.TLSConfig{})).Endpoint()
+	assert.ErrorIs(t, err, cert.ErrNoCertOrKey)
+}
+
+func TestServerStopTimeout(t *testing.T) {
+	t.Parallel()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := NewServer(
+		WithAddress("127.0.0.1", 0),
+		WithHandler(
+			http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					<-release
+				},
+			),
+		),
+	)
+	endpoint, err := server.Endpoint()
+	require.NoError(t, err)
+	startErrC := make(chan error, 1)
+	go func() {
+		startErrC <- server.Start(context.Background())
+	}()
+	getErrC := make(chan error, 1)
+	go func() {
+		_, err := testGet(newTestClient(nil), endpoint.String())
+		getErrC <- err
+	}()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, server.Stop(ctx), context.DeadlineExceeded)
+	// The connection was closed by Stop, so the request fails.
+	assert.Error(t, <-getErrC)
+	close(release)
+	assert.NoError(t, <-startErrC)
+}
+
+func TestServerReleasesListener(t *testing.T) {
+	t.Parallel()
+	port := newTestPort(t)
+	server := NewServer(WithAddress("127.0.0.1", port), WithHandler(newTestHandler()))
+	err := transportx.Run(
+		transportx.WithContext(context.Background()),
+		transportx.WithServers(server),
+		transportx.BeforeStart(
+			func(context.Context) error {
+				return errors.New("migration failed")
+			},
+		),
+	)
+	assert.EqualError(t, err, "migration failed")
+	// The listener bound by Endpoint was closed, though the server never started.
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	// A stopped server does not start.
+	assert.NoError(t, server.Start(context.Background()))
+}
+
+func newTestPort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func newTestHandler() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		},
+	)
+}
+
+func startTestServer(t *testing.T, server *Server) func() {
+	errC := make(chan error, 1)
+	go func() {
+		errC <- server.Start(context.Background())
+	}()
+	return func() {
+		assert.NoError(t, server.Stop(context.Background()))
+		assert.NoError(t, <-errC)
+	}
+}
+
+func newTestClient(transport *http.Transport) *http.Client {
+	if transport == nil {
+		transport = &http.Transport{}
+	}
+	// Idle connections would outlive the test.
+	transport.DisableKeepAlives = true
+	return &http.Client{Transport: transport}
+}
+
+func testGet(client *http.Client, url string) (string, error) {
+	response, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	return string(data), err
+}
+
+func newTestCertificate(t *testing.T) ([]byte, []byte) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
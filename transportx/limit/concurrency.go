@@ -0,0 +1,148 @@
+package limit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInitialConcurrency = 20
+	defaultMinConcurrency     = 1
+	defaultMaxConcurrency     = 1000
+	defaultBackoffRatio       = 0.9
+)
+
+// ConcurrencyLimiter limits the number of requests in flight with a limit that
+// adapts to the load, by additive increase and multiplicative decrease (AIMD).
+//
+// The limit grows by one for every request that succeeds while at least half
+// of the limit is in use, and is multiplied by the backoff ratio for every
+// request that is dropped, such as one that failed because of overload or took
+// longer than the latency threshold.
+type ConcurrencyLimiter struct {
+	minLimit         float64
+	maxLimit         float64
+	backoffRatio     float64
+	latencyThreshold time.Duration
+	now              func() time.Time
+
+	lock     sync.Mutex
+	limit    float64
+	inFlight int
+	accepted uint64
+	rejected uint64
+	dropped  uint64
+}
+
+// ConcurrencyLimiterStats are the statistics of a ConcurrencyLimiter.
+type ConcurrencyLimiterStats struct {
+	Limit    int    `json:"limit"`
+	InFlight int    `json:"in_flight"`
+	Accepted uint64 `json:"accepted"`
+	Rejected uint64 `json:"rejected"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// ConcurrencyLimiterOption is an option for NewConcurrencyLimiter.
+type ConcurrencyLimiterOption func(*ConcurrencyLimiter)
+
+// ConcurrencyLimiterWithLimits sets the initial, minimum, and maximum limit.
+// The defaults are 20, 1, and 1000.
+func ConcurrencyLimiterWithLimits(initial int, min int, max int) ConcurrencyLimiterOption {
+	return func(l *ConcurrencyLimiter) {
+		l.limit = float64(initial)
+		l.minLimit = float64(min)
+		l.maxLimit = float64(max)
+	}
+}
+
+// ConcurrencyLimiterWithBackoffRatio sets the ratio by which the limit is
+// multiplied when a request is dropped. The default is 0.9.
+func ConcurrencyLimiterWithBackoffRatio(ratio float64) ConcurrencyLimiterOption {
+	return func(l *ConcurrencyLimiter) {
+		l.backoffRatio = ratio
+	}
+}
+
+// ConcurrencyLimiterWithLatencyThreshold drops the requests that take longer
+// than the threshold. The default is to only drop the requests released as dropped.
+func ConcurrencyLimiterWithLatencyThreshold(threshold time.Duration) ConcurrencyLimiterOption {
+	return func(l *ConcurrencyLimiter) {
+		l.latencyThreshold = threshold
+	}
+}
+
+// NewConcurrencyLimiter returns a new ConcurrencyLimiter.
+func NewConcurrencyLimiter(opts ...ConcurrencyLimiterOption) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		limit:        defaultInitialConcurrency,
+		minLimit:     defaultMinConcurrency,
+		maxLimit:     defaultMaxConcurrency,
+		backoffRatio: defaultBackoffRatio,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.minLimit = math.Max(l.minLimit, 1)
+	l.maxLimit = math.Max(l.maxLimit, l.minLimit)
+	l.limit = math.Min(math.Max(l.limit, l.minLimit), l.maxLimit)
+	return l
+}
+
+// Acquire returns whether a request is accepted under the limit.
+//
+// If so, the returned function must be called once the request is done, with
+// whether it was dropped. Calling it more than once has no effect.
+func (l *ConcurrencyLimiter) Acquire() (func(dropped bool), bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.inFlight >= int(l.limit) {
+		l.rejected++
+		return nil, false
+	}
+	l.inFlight++
+	l.accepted++
+	start := l.now()
+	var once sync.Once
+	return func(dropped bool) {
+		once.Do(
+			func() {
+				l.release(start, dropped)
+			},
+		)
+	}, true
+}
+
+// Stats returns the statistics of the ConcurrencyLimiter.
+func (l *ConcurrencyLimiter) Stats() ConcurrencyLimiterStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return ConcurrencyLimiterStats{
+		Limit:    int(l.limit),
+		InFlight: l.inFlight,
+		Accepted: l.accepted,
+		Rejected: l.rejected,
+		Dropped:  l.dropped,
+	}
+}
+
+func (l *ConcurrencyLimiter) release(start time.Time, dropped bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	inFlight := l.inFlight
+	l.inFlight--
+	if l.latencyThreshold > 0 && l.now().Sub(start) > l.latencyThreshold {
+		dropped = true
+	}
+	switch {
+	case dropped:
+		l.dropped++
+		l.limit = math.Max(l.minLimit, l.limit*l.backoffRatio)
+	case float64(inFlight*2) >= l.limit:
+		// Only grow the limit if it is used, so that it does not grow
+		// without bounds while the load is low.
+		l.limit = math.Min(l.maxLimit, l.limit+1)
+	}
+}
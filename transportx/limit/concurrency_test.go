@@ -0,0 +1,73 @@
+package limit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	t.Parallel()
+	limiter := NewConcurrencyLimiter(ConcurrencyLimiterWithLimits(2, 1, 3))
+	release1, ok := limiter.Acquire()
+	require.True(t, ok)
+	release2, ok := limiter.Acquire()
+	require.True(t, ok)
+	_, ok = limiter.Acquire()
+	assert.False(t, ok)
+
+	// The limit grows while it is used.
+	release1(false)
+	release1(false)
+	release2(false)
+	assert.Equal(t, ConcurrencyLimiterStats{Limit: 3, Accepted: 2, Rejected: 1}, limiter.Stats())
+	var releases []func(bool)
+	for i := 0; i < 3; i++ {
+		release, ok := limiter.Acquire()
+		require.True(t, ok)
+		releases = append(releases, release)
+	}
+	_, ok = limiter.Acquire()
+	assert.False(t, ok)
+	assert.Equal(t, 3, limiter.Stats().InFlight)
+	for _, release := range releases {
+		release(false)
+	}
+	// The limit does not grow beyond the maximum.
+	assert.Equal(t, 3, limiter.Stats().Limit)
+
+	// The limit shrinks when requests are dropped, down to the minimum.
+	for i := 0; i < 20; i++ {
+		release, ok := limiter.Acquire()
+		require.True(t, ok)
+		release(true)
+	}
+	assert.Equal(t, 1, limiter.Stats().Limit)
+	assert.Equal(t, uint64(20), limiter.Stats().Dropped)
+
+	// The limit does not grow while the load is low.
+	limiter = NewConcurrencyLimiter(ConcurrencyLimiterWithLimits(10, 1, 100))
+	for i := 0; i < 10; i++ {
+		release, ok := limiter.Acquire()
+		require.True(t, ok)
+		release(false)
+	}
+	assert.Equal(t, 10, limiter.Stats().Limit)
+}
+
+func TestConcurrencyLimiterLatencyThreshold(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(0, 0)
+	limiter := NewConcurrencyLimiter(
+		ConcurrencyLimiterWithLimits(10, 1, 100),
+		ConcurrencyLimiterWithBackoffRatio(0.5),
+		ConcurrencyLimiterWithLatencyThreshold(time.Second),
+	)
+	limiter.now = func() time.Time { return now }
+	release, ok := limiter.Acquire()
+	require.True(t, ok)
+	now = now.Add(2 * time.Second)
+	release(false)
+	assert.Equal(t, ConcurrencyLimiterStats{Limit: 5, Accepted: 1, Dropped: 1}, limiter.Stats())
+}
@@ -0,0 +1,138 @@
+// Package limit provides limiters that protect servers from overload.
+package limit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const defaultRateLimiterMaxKeys = 10000
+
+// RateLimiter limits the rate of requests per key with token buckets.
+//
+// The bucket of a key holds up to burst tokens, and is refilled at rate tokens
+// per second. A request takes a token, and is rejected if the bucket is empty.
+type RateLimiter struct {
+	rate    float64
+	burst   int
+	maxKeys int
+	now     func() time.Time
+
+	lock     sync.Mutex
+	buckets  map[string]*bucket
+	sweepAt  int
+	allowed  uint64
+	rejected uint64
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiterStats are the statistics of a RateLimiter.
+type RateLimiterStats struct {
+	Rate     float64 `json:"rate"`
+	Burst    int     `json:"burst"`
+	Keys     int     `json:"keys"`
+	Allowed  uint64  `json:"allowed"`
+	Rejected uint64  `json:"rejected"`
+}
+
+// RateLimiterOption is an option for NewRateLimiter.
+type RateLimiterOption func(*RateLimiter)
+
+// RateLimiterWithMaxKeys sets the number of keys above which the buckets that
+// are full again are removed. The default is 10000.
+//
+// A full bucket is the same as a new one, so removing it does not change the
+// limits. The buckets that are not full are kept, so the number of keys can
+// exceed the maximum while many keys are limited.
+func RateLimiterWithMaxKeys(maxKeys int) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.maxKeys = maxKeys
+	}
+}
+
+// NewRateLimiter returns a new RateLimiter that allows rate requests per
+// second per key, with bursts of up to burst requests.
+func NewRateLimiter(rate float64, burst int, opts ...RateLimiterOption) *RateLimiter {
+	l := &RateLimiter{
+		rate:    rate,
+		burst:   max(burst, 1),
+		maxKeys: defaultRateLimiterMaxKeys,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.sweepAt = l.maxKeys
+	return l
+}
+
+// Allow takes a token from the bucket of the key, and returns whether the
+// request is allowed.
+//
+// If not, Allow returns how long until the bucket has a token again.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.sweepAt {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		l.allowed++
+		return true, 0
+	}
+	l.rejected++
+	if l.rate <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Stats returns the statistics of the RateLimiter.
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return RateLimiterStats{
+		Rate:     l.rate,
+		Burst:    l.burst,
+		Keys:     len(l.buckets),
+		Allowed:  l.allowed,
+		Rejected: l.rejected,
+	}
+}
+
+// refill returns the tokens of the bucket at the time.
+func (l *RateLimiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(float64(l.burst), b.tokens+elapsed*l.rate)
+}
+
+// sweep removes the buckets that are full.
+//
+// If most buckets are kept, the next sweep is delayed until the number of
+// buckets doubles, so that adding a key stays amortized constant time.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.sweepAt = max(l.maxKeys, 2*len(l.buckets))
+}
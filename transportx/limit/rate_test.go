@@ -0,0 +1,74 @@
+package limit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("a")
+		assert.True(t, ok)
+	}
+	ok, retryAfter := limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+	// The keys have their own buckets.
+	ok, _ = limiter.Allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(250 * time.Millisecond)
+	ok, retryAfter = limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 250*time.Millisecond, retryAfter)
+	now = now.Add(250 * time.Millisecond)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+
+	// The bucket is refilled up to the burst.
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("a")
+		assert.True(t, ok)
+	}
+	ok, _ = limiter.Allow("a")
+	assert.False(t, ok)
+
+	assert.Equal(
+		t,
+		RateLimiterStats{Rate: 2, Burst: 3, Keys: 2, Allowed: 8, Rejected: 3},
+		limiter.Stats(),
+	)
+}
+
+func TestRateLimiterMaxKeys(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(1, 1, RateLimiterWithMaxKeys(4))
+	limiter.now = func() time.Time { return now }
+	for i := 0; i < 4; i++ {
+		limiter.Allow(strconv.Itoa(i))
+	}
+	assert.Equal(t, 4, limiter.Stats().Keys)
+
+	// The buckets that are not full are kept.
+	limiter.Allow("4")
+	assert.Equal(t, 5, limiter.Stats().Keys)
+
+	// The buckets that are full again are removed.
+	now = now.Add(time.Second)
+	limiter.Allow("3")
+	for i := 5; i < 10; i++ {
+		limiter.Allow(strconv.Itoa(i))
+	}
+	assert.Equal(t, 6, limiter.Stats().Keys)
+	ok, _ := limiter.Allow("3")
+	assert.False(t, ok)
+}
@@ -2,6 +2,7 @@ package transportx
 
 import (
 	"context"
+	"fmt"
 	"go.uber.org/zap"
 	"net/url"
 	"time"
@@ -9,9 +10,21 @@ import (
 
 type RunOption func(*runner)
 
+// WithServers adds servers named server-N, where N is the order the server was added in.
 func WithServers(server ...Server) RunOption {
 	return func(app *runner) {
-		app.servers = append(app.servers, server...)
+		for _, srv := range server {
+			app.servers = append(app.servers, newServerEntry(fmt.Sprintf("server-%d", len(app.servers)), srv))
+		}
+	}
+}
+
+// WithServer adds a named server.
+//
+// The name is used in health checks and errors, and by DependsOn.
+func WithServer(name string, server Server, opts ...ServerOption) RunOption {
+	return func(app *runner) {
+		app.servers = append(app.servers, newServerEntry(name, server, opts...))
 	}
 }
 
@@ -21,6 +34,17 @@ func WithStopTimeout(stopTimeout time.Duration) RunOption {
 	}
 }
 
+// WithHookTimeout sets the timeout of each BeforeStart, AfterStart, BeforeStop,
+// and AfterStop hook. The default is 30 seconds, and 0 disables the timeout.
+//
+// The context of a hook is canceled once it times out. A hook that does not
+// return then is left running, and fails with an error.
+func WithHookTimeout(timeout time.Duration) RunOption {
+	return func(app *runner) {
+		app.hookTimeout = timeout
+	}
+}
+
 func BeforeStart(fn ...func(ctx context.Context) error) RunOption {
 	return func(app *runner) {
 		app.beforeStart = append(app.beforeStart, fn...)
@@ -86,3 +110,31 @@ func Endpoints(endpoints []*url.URL) RunOption {
 		app.endpoints = endpoints
 	}
 }
+
+// WithHealth sets the Health that the runner marks as ready and not ready.
+func WithHealth(health *Health) RunOption {
+	return func(app *runner) {
+		app.health = health
+	}
+}
+
+// WithEvents sets the Events that the runner publishes its lifecycle events to.
+func WithEvents(events *Events) RunOption {
+	return func(app *runner) {
+		app.events = events
+	}
+}
+
+// WithRegistrar sets the Registrar that the runner registers its ServiceInstance with.
+func WithRegistrar(registrar Registrar) RunOption {
+	return func(app *runner) {
+		app.registrar = registrar
+	}
+}
+
+// WithRegistrarTimeout sets the timeout of registering and deregistering the ServiceInstance.
+func WithRegistrarTimeout(timeout time.Duration) RunOption {
+	return func(app *runner) {
+		app.registrarTimeout = timeout
+	}
+}
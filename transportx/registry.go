@@ -0,0 +1,65 @@
+package transportx
+
+import (
+	"context"
+	"time"
+)
+
+// ServiceInstance is a running instance of a service.
+type ServiceInstance struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Version   string            `json:"version"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Endpoints []string          `json:"endpoints"`
+}
+
+// Registrar registers service instances.
+//
+// The runner registers its instance once all servers have started, and
+// deregisters it when stopped.
+type Registrar interface {
+	Register(ctx context.Context, instance *ServiceInstance) error
+	Deregister(ctx context.Context, instance *ServiceInstance) error
+}
+
+// Discovery discovers service instances.
+type Discovery interface {
+	// GetService returns the registered instances of the service, sorted by ID.
+	GetService(ctx context.Context, name string) ([]*ServiceInstance, error)
+	// Watch returns a new ServiceWatcher for the service.
+	//
+	// The ServiceWatcher is stopped when ctx is canceled.
+	Watch(ctx context.Context, name string) (ServiceWatcher, error)
+}
+
+// ServiceWatcher watches the instances of a service.
+type ServiceWatcher interface {
+	// Next returns the instances of the service, sorted by ID.
+	//
+	// The first call returns immediately, and subsequent calls block until
+	// the instances change.
+	Next() ([]*ServiceInstance, error)
+	// Stop stops the ServiceWatcher.
+	//
+	// Next returns context.Canceled after Stop.
+	Stop() error
+}
+
+// defaultRegistrarTimeout is the default timeout of Register and Deregister.
+const defaultRegistrarTimeout = 10 * time.Second
+
+// NewServiceInstance returns the ServiceInstance for the AppInfo.
+func NewServiceInstance(appInfo AppInfo) *ServiceInstance {
+	endpoints := make([]string, 0, len(appInfo.Endpoints()))
+	for _, endpoint := range appInfo.Endpoints() {
+		endpoints = append(endpoints, endpoint.String())
+	}
+	return &ServiceInstance{
+		ID:        appInfo.ID(),
+		Name:      appInfo.Name(),
+		Version:   appInfo.Version(),
+		Metadata:  appInfo.Metadata(),
+		Endpoints: endpoints,
+	}
+}
@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aesoper101/x/transportx"
+	"github.com/aesoper101/x/watcherext"
+	"go.uber.org/multierr"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const instanceFileExt = ".json"
+
+// FileRegistry is a transportx.Registrar and transportx.Discovery that stores
+// one JSON file per instance at dir/name/id.json.
+//
+// Instances on the same host, or on hosts sharing the directory, discover each
+// other without a registry service. Instances that exit without deregistering
+// are not removed.
+type FileRegistry struct {
+	dir string
+}
+
+func NewFileRegistry(dir string) *FileRegistry {
+	return &FileRegistry{
+		dir: dir,
+	}
+}
+
+func (r *FileRegistry) Register(_ context.Context, instance *transportx.ServiceInstance) (retErr error) {
+	if err := validateServiceInstance(instance); err != nil {
+		return err
+	}
+	serviceDir := r.serviceDir(instance.Name)
+	if err := os.MkdirAll(serviceDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(instance, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Files starting with a dot are not instances, so watchers never read a partial file.
+	file, err := os.CreateTemp(serviceDir, "."+instance.ID+instanceFileExt+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			if err := os.Remove(file.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+				retErr = multierr.Append(retErr, err)
+			}
+		}
+	}()
+	_, err = file.Write(data)
+	if err = multierr.Append(err, file.Close()); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), r.instanceFile(instance))
+}
+
+func (r *FileRegistry) Deregister(_ context.Context, instance *transportx.ServiceInstance) error {
+	if err := validateServiceInstance(instance); err != nil {
+		return err
+	}
+	if err := os.Remove(r.instanceFile(instance)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (r *FileRegistry) GetService(_ context.Context, name string) ([]*transportx.ServiceInstance, error) {
+	if err := validateName("service name", name); err != nil {
+		return nil, err
+	}
+	return r.getService(name)
+}
+
+// Watch returns a new transportx.ServiceWatcher that watches the directory of the
+// service with watcherext.WatchDir.
+func (r *FileRegistry) Watch(ctx context.Context, name string) (transportx.ServiceWatcher, error) {
+	if err := validateName("service name", name); err != nil {
+		return nil, err
+	}
+	serviceDir := r.serviceDir(name)
+	if err := os.MkdirAll(serviceDir, 0755); err != nil {
+		return nil, err
+	}
+	var lock sync.Mutex
+	changed := make(chan struct{})
+	watcher := newServiceWatcher(
+		ctx,
+		func(context.Context) ([]*transportx.ServiceInstance, <-chan struct{}, error) {
+			// Get the channel first, so changes made while reading are not missed.
+			lock.Lock()
+			c := changed
+			lock.Unlock()
+			instances, err := r.getService(name)
+			return instances, c, err
+		},
+	)
+	// Watching stops when the watcher is stopped.
+	events := make(watcherext.EventChannel)
+	if _, err := watcherext.WatchDir(watcher.ctx, serviceDir, events); err != nil {
+		_ = watcher.Stop()
+		return nil, err
+	}
+	go func() {
+		for {
+			select {
+			case <-watcher.ctx.Done():
+				return
+			case event := <-events:
+				if !isInstanceFile(event.Source()) {
+					continue
+				}
+				lock.Lock()
+				close(changed)
+				changed = make(chan struct{})
+				lock.Unlock()
+			}
+		}
+	}()
+	return watcher, nil
+}
+
+func (r *FileRegistry) getService(name string) ([]*transportx.ServiceInstance, error) {
+	entries, err := os.ReadDir(r.serviceDir(name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []*transportx.ServiceInstance{}, nil
+		}
+		return nil, err
+	}
+	instances := make([]*transportx.ServiceInstance, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !isInstanceFile(entry.Name()) {
+			continue
+		}
+		filePath := filepath.Join(r.serviceDir(name), entry.Name())
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			// Deregistered since the directory was read.
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		instance := &transportx.ServiceInstance{}
+		if err := json.Unmarshal(data, instance); err != nil {
+			return nil, fmt.Errorf("could not decode %s: %w", filePath, err)
+		}
+		instances = append(instances, instance)
+	}
+	sortServiceInstances(instances)
+	return instances, nil
+}
+
+func (r *FileRegistry) serviceDir(name string) string {
+	return filepath.Join(r.dir, name)
+}
+
+func (r *FileRegistry) instanceFile(instance *transportx.ServiceInstance) string {
+	return filepath.Join(r.serviceDir(instance.Name), instance.ID+instanceFileExt)
+}
+
+func isInstanceFile(filePath string) bool {
+	base := filepath.Base(filePath)
+	return !strings.HasPrefix(base, ".") && strings.HasSuffix(base, instanceFileExt)
+}
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"context"
+	"github.com/aesoper101/x/transportx"
+	"sort"
+	"sync"
+)
+
+// MemoryRegistry is an in-memory transportx.Registrar and transportx.Discovery.
+//
+// This is intended for tests and for services in a single process.
+type MemoryRegistry struct {
+	lock      sync.Mutex
+	instances map[string]map[string]*transportx.ServiceInstance
+	// changed is closed and replaced when any instance changes.
+	changed chan struct{}
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		instances: make(map[string]map[string]*transportx.ServiceInstance),
+		changed:   make(chan struct{}),
+	}
+}
+
+func (r *MemoryRegistry) Register(_ context.Context, instance *transportx.ServiceInstance) error {
+	if err := validateServiceInstance(instance); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	instances, ok := r.instances[instance.Name]
+	if !ok {
+		instances = make(map[string]*transportx.ServiceInstance)
+		r.instances[instance.Name] = instances
+	}
+	instances[instance.ID] = copyServiceInstance(instance)
+	r.notify()
+	return nil
+}
+
+func (r *MemoryRegistry) Deregister(_ context.Context, instance *transportx.ServiceInstance) error {
+	if err := validateServiceInstance(instance); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.instances[instance.Name][instance.ID]; !ok {
+		return nil
+	}
+	delete(r.instances[instance.Name], instance.ID)
+	r.notify()
+	return nil
+}
+
+func (r *MemoryRegistry) GetService(_ context.Context, name string) ([]*transportx.ServiceInstance, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.getService(name), nil
+}
+
+func (r *MemoryRegistry) Watch(ctx context.Context, name string) (transportx.ServiceWatcher, error) {
+	return newServiceWatcher(
+		ctx,
+		func(ctx context.Context) ([]*transportx.ServiceInstance, <-chan struct{}, error) {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+			return r.getService(name), r.changed, nil
+		},
+	), nil
+}
+
+func (r *MemoryRegistry) getService(name string) []*transportx.ServiceInstance {
+	instances := make([]*transportx.ServiceInstance, 0, len(r.instances[name]))
+	for _, instance := range r.instances[name] {
+		instances = append(instances, copyServiceInstance(instance))
+	}
+	sortServiceInstances(instances)
+	return instances
+}
+
+// notify must be called with the lock held.
+func (r *MemoryRegistry) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func copyServiceInstance(instance *transportx.ServiceInstance) *transportx.ServiceInstance {
+	c := *instance
+	if instance.Metadata != nil {
+		c.Metadata = make(map[string]string, len(instance.Metadata))
+		for key, value := range instance.Metadata {
+			c.Metadata[key] = value
+		}
+	}
+	c.Endpoints = append([]string(nil), instance.Endpoints...)
+	return &c
+}
+
+func sortServiceInstances(instances []*transportx.ServiceInstance) {
+	sort.Slice(
+		instances,
+		func(i int, j int) bool {
+			return instances[i].ID < instances[j].ID
+		},
+	)
+}
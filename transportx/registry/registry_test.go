@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"context"
+	"github.com/aesoper101/x/transportx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testRegistry interface {
+	transportx.Registrar
+	transportx.Discovery
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	t.Parallel()
+	testRegistryWatch(t, NewMemoryRegistry())
+}
+
+func TestFileRegistry(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	testRegistryWatch(t, NewFileRegistry(dir))
+	assert.NoFileExists(t, filepath.Join(dir, "foo", "a.json"))
+
+	registry := NewFileRegistry(dir)
+	err := registry.Register(context.Background(), &transportx.ServiceInstance{ID: "../a", Name: "foo"})
+	assert.EqualError(t, err, "invalid service instance ID: ../a")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo", "b.json"), []byte("{"), 0600))
+	_, err = registry.GetService(context.Background(), "foo")
+	assert.ErrorContains(t, err, "could not decode")
+}
+
+func testRegistryWatch(t *testing.T, registry testRegistry) {
+	ctx := context.Background()
+	instanceA := &transportx.ServiceInstance{
+		ID:        "a",
+		Name:      "foo",
+		Version:   "v1",
+		Metadata:  map[string]string{"zone": "1"},
+		Endpoints: []string{"http://127.0.0.1:8080"},
+	}
+	instanceB := &transportx.ServiceInstance{
+		ID:        "b",
+		Name:      "foo",
+		Endpoints: []string{"http://127.0.0.1:8081"},
+	}
+	other := &transportx.ServiceInstance{
+		ID:   "c",
+		Name: "bar",
+	}
+	require.NoError(t, registry.Register(ctx, instanceB))
+	require.NoError(t, registry.Register(ctx, other))
+	instances, err := registry.GetService(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []*transportx.ServiceInstance{instanceB}, instances)
+
+	watcher, err := registry.Watch(ctx, "foo")
+	require.NoError(t, err)
+	instances, err = watcher.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []*transportx.ServiceInstance{instanceB}, instances)
+
+	require.NoError(t, registry.Register(ctx, instanceA))
+	instances = testNext(t, watcher)
+	assert.Equal(t, []*transportx.ServiceInstance{instanceA, instanceB}, instances)
+	require.NoError(t, registry.Deregister(ctx, instanceA))
+	require.NoError(t, registry.Deregister(ctx, instanceA))
+	instances = testNext(t, watcher)
+	assert.Equal(t, []*transportx.ServiceInstance{instanceB}, instances)
+
+	require.NoError(t, watcher.Stop())
+	_, err = watcher.Next()
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func testNext(t *testing.T, watcher transportx.ServiceWatcher) []*transportx.ServiceInstance {
+	type result struct {
+		instances []*transportx.ServiceInstance
+		err       error
+	}
+	resultC := make(chan result, 1)
+	go func() {
+		instances, err := watcher.Next()
+		resultC <- result{instances: instances, err: err}
+	}()
+	select {
+	case result := <-resultC:
+		require.NoError(t, result.err)
+		return result.instances
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timed out waiting for the next instances")
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aesoper101/x/transportx"
+	"reflect"
+)
+
+// getServiceFunc returns the instances of a service, and a channel that is closed
+// when the instances may have changed.
+type getServiceFunc func(ctx context.Context) ([]*transportx.ServiceInstance, <-chan struct{}, error)
+
+type serviceWatcher struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	get     getServiceFunc
+	changed <-chan struct{}
+	last    []*transportx.ServiceInstance
+	started bool
+}
+
+func newServiceWatcher(ctx context.Context, get getServiceFunc) *serviceWatcher {
+	ctx, cancel := context.WithCancel(ctx)
+	return &serviceWatcher{
+		ctx:    ctx,
+		cancel: cancel,
+		get:    get,
+	}
+}
+
+func (w *serviceWatcher) Next() ([]*transportx.ServiceInstance, error) {
+	for {
+		if err := w.ctx.Err(); err != nil {
+			return nil, err
+		}
+		if w.started {
+			select {
+			case <-w.ctx.Done():
+				return nil, w.ctx.Err()
+			case <-w.changed:
+			}
+		}
+		instances, changed, err := w.get(w.ctx)
+		if err != nil {
+			return nil, err
+		}
+		w.changed = changed
+		// Changes may be reported that do not change the instances.
+		if w.started && reflect.DeepEqual(instances, w.last) {
+			continue
+		}
+		w.started = true
+		w.last = instances
+		return instances, nil
+	}
+}
+
+func (w *serviceWatcher) Stop() error {
+	w.cancel()
+	return nil
+}
+
+// validateServiceInstance validates that the name and ID of the instance can be used as file names.
+func validateServiceInstance(instance *transportx.ServiceInstance) error {
+	if instance == nil {
+		return errors.New("nil service instance")
+	}
+	if err := validateName("service name", instance.Name); err != nil {
+		return err
+	}
+	return validateName("service instance ID", instance.ID)
+}
+
+func validateName(kind string, name string) error {
+	if name == "" {
+		return fmt.Errorf("empty %s", kind)
+	}
+	if name[0] == '.' {
+		return fmt.Errorf("invalid %s: %s", kind, name)
+	}
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.') {
+			return fmt.Errorf("invalid %s: %s", kind, name)
+		}
+	}
+	return nil
+}
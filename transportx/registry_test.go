@@ -0,0 +1,71 @@
+package transportx
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/url"
+	"testing"
+)
+
+type testRegistrar struct {
+	registered   []*ServiceInstance
+	deregistered []*ServiceInstance
+}
+
+func (r *testRegistrar) Register(_ context.Context, instance *ServiceInstance) error {
+	r.registered = append(r.registered, instance)
+	return nil
+}
+
+func (r *testRegistrar) Deregister(ctx context.Context, instance *ServiceInstance) error {
+	// The runner context is canceled, but deregistering must still be possible.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.deregistered = append(r.deregistered, instance)
+	return nil
+}
+
+func TestRunRegistrar(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockServer := NewMockServer(ctrl)
+	mockServer.EXPECT().Start(gomock.Any()).Return(nil)
+	mockServer.EXPECT().Stop(gomock.Any()).Return(nil)
+
+	registrar := &testRegistrar{}
+	var registeredAfterStart int
+	err := Run(
+		WithContext(ctx),
+		ID("1"),
+		Name("foo"),
+		Version("v1"),
+		Endpoints([]*url.URL{{Scheme: "http", Host: "127.0.0.1:8080"}}),
+		WithServers(mockServer),
+		WithRegistrar(registrar),
+		AfterStart(
+			func(context.Context) error {
+				registeredAfterStart = len(registrar.registered)
+				cancel()
+				return nil
+			},
+		),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 1, registeredAfterStart)
+	expected := []*ServiceInstance{
+		{
+			ID:        "1",
+			Name:      "foo",
+			Version:   "v1",
+			Endpoints: []string{"http://127.0.0.1:8080"},
+		},
+	}
+	assert.Equal(t, expected, registrar.registered)
+	assert.Equal(t, expected, registrar.deregistered)
+}
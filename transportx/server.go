@@ -0,0 +1,187 @@
+package transportx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/multierr"
+	"strings"
+	"time"
+)
+
+// Readier is implemented by servers that signal when they are ready to serve.
+//
+// The runner waits for a server to be ready before starting the servers that
+// depend on it. Servers that do not implement Readier are ready once started.
+type Readier interface {
+	// Ready returns a channel that is closed once the server is ready.
+	Ready() <-chan struct{}
+}
+
+// ServerOption is an option for a server added with WithServer.
+type ServerOption func(*serverEntry)
+
+// DependsOn sets the names of the servers that must be ready before the server is started.
+//
+// The server is stopped before the servers it depends on.
+func DependsOn(names ...string) ServerOption {
+	return func(entry *serverEntry) {
+		entry.dependsOn = append(entry.dependsOn, names...)
+	}
+}
+
+// ServerStartTimeout sets how long the runner waits for the server to be ready.
+//
+// The default is to wait until the runner is stopped.
+func ServerStartTimeout(timeout time.Duration) ServerOption {
+	return func(entry *serverEntry) {
+		entry.startTimeout = timeout
+	}
+}
+
+// ServerStopTimeout sets how long the runner waits for the server to stop.
+//
+// The default is the timeout set with WithStopTimeout.
+func ServerStopTimeout(timeout time.Duration) ServerOption {
+	return func(entry *serverEntry) {
+		entry.stopTimeout = timeout
+	}
+}
+
+type serverEntry struct {
+	name         string
+	server       Server
+	dependsOn    []string
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+
+	// resolved is set once the endpoint of the server was resolved, which may
+	// have bound its listener.
+	resolved bool
+	// doneC is closed when Start returns, after which err is the result of Start.
+	doneC chan struct{}
+	err   error
+}
+
+func newServerEntry(name string, server Server, opts ...ServerOption) *serverEntry {
+	entry := &serverEntry{
+		name:   name,
+		server: server,
+	}
+	for _, opt := range opts {
+		opt(entry)
+	}
+	return entry
+}
+
+// start starts the server, and waits until it is ready.
+//
+// The entry is sent to exitedC when Start returns.
+func (e *serverEntry) start(ctx context.Context, startCtx context.Context, exitedC chan<- *serverEntry) error {
+	e.doneC = make(chan struct{})
+	go func() {
+		e.err = e.server.Start(startCtx)
+		close(e.doneC)
+		exitedC <- e
+	}()
+	readier, ok := e.server.(Readier)
+	if !ok {
+		return nil
+	}
+	if e.startTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.startTimeout)
+		defer cancel()
+	}
+	select {
+	case <-readier.Ready():
+		return nil
+	case <-e.doneC:
+		if e.err != nil {
+			return fmt.Errorf("server %s failed to start: %w", e.name, e.err)
+		}
+		return fmt.Errorf("server %s returned before it was ready", e.name)
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("server %s was not ready within %v", e.name, e.startTimeout)
+		}
+		return ctx.Err()
+	}
+}
+
+// stop stops the server, and waits for Start to return if it was started.
+func (e *serverEntry) stop(ctx context.Context, defaultTimeout time.Duration) error {
+	timeout := e.stopTimeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := e.server.Stop(ctx); err != nil {
+		return fmt.Errorf("server %s failed to stop: %w", e.name, err)
+	}
+	if e.doneC == nil {
+		// Stopping a server that was not started releases its listener.
+		return nil
+	}
+	select {
+	case <-e.doneC:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("server %s did not stop within %v", e.name, timeout)
+	}
+}
+
+// sortServerEntries returns the servers in the order they are started, such that
+// every server comes after the servers it depends on.
+//
+// Servers without dependencies between them are kept in the order they were added.
+func sortServerEntries(entries []*serverEntry) ([]*serverEntry, error) {
+	nameToEntry := make(map[string]*serverEntry, len(entries))
+	for _, entry := range entries {
+		if _, ok := nameToEntry[entry.name]; ok {
+			return nil, fmt.Errorf("duplicate server name: %s", entry.name)
+		}
+		nameToEntry[entry.name] = entry
+	}
+	var errs error
+	for _, entry := range entries {
+		for _, dependency := range entry.dependsOn {
+			if _, ok := nameToEntry[dependency]; !ok {
+				errs = multierr.Append(errs, fmt.Errorf("server %s depends on unknown server %s", entry.name, dependency))
+			}
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	sorted := make([]*serverEntry, 0, len(entries))
+	// The state of a server is absent if not visited, false while visiting its
+	// dependencies, and true once added to sorted.
+	visited := make(map[string]bool, len(entries))
+	var visit func(entry *serverEntry, path []string) error
+	visit = func(entry *serverEntry, path []string) error {
+		path = append(path, entry.name)
+		if added, ok := visited[entry.name]; ok {
+			if !added {
+				return fmt.Errorf("servers have a dependency cycle: %s", strings.Join(path, " -> "))
+			}
+			return nil
+		}
+		visited[entry.name] = false
+		for _, dependency := range entry.dependsOn {
+			if err := visit(nameToEntry[dependency], path); err != nil {
+				return err
+			}
+		}
+		visited[entry.name] = true
+		sorted = append(sorted, entry)
+		return nil
+	}
+	for _, entry := range entries {
+		if err := visit(entry, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
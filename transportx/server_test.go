@@ -0,0 +1,294 @@
+package transportx
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	name   string
+	events *testEvents
+	ready  chan struct{}
+	// readyAfter delays readiness, or prevents it if negative.
+	readyAfter time.Duration
+	stopErr    error
+	// stopBlocks makes Stop block until its context is done.
+	stopBlocks bool
+	stopC      chan struct{}
+}
+
+func newTestServer(name string, events *testEvents) *testServer {
+	return &testServer{
+		name:   name,
+		events: events,
+		ready:  make(chan struct{}),
+		stopC:  make(chan struct{}),
+	}
+}
+
+func (s *testServer) Start(ctx context.Context) error {
+	s.events.add("start " + s.name)
+	if s.readyAfter >= 0 {
+		go func() {
+			time.Sleep(s.readyAfter)
+			s.events.add("ready " + s.name)
+			close(s.ready)
+		}()
+	}
+	<-s.stopC
+	return nil
+}
+
+func (s *testServer) Stop(ctx context.Context) error {
+	s.events.add("stop " + s.name)
+	if s.stopBlocks {
+		<-ctx.Done()
+		close(s.stopC)
+		return ctx.Err()
+	}
+	close(s.stopC)
+	return s.stopErr
+}
+
+func (s *testServer) Ready() <-chan struct{} {
+	return s.ready
+}
+
+type testEvents struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (e *testEvents) add(event string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *testEvents) get() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]string(nil), e.events...)
+}
+
+func TestRunServerOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := &testEvents{}
+	database := newTestServer("database", events)
+	database.readyAfter = 10 * time.Millisecond
+	api := newTestServer("api", events)
+	admin := newTestServer("admin", events)
+	err := Run(
+		WithContext(ctx),
+		WithServer("api", api, DependsOn("database")),
+		WithServer("database", database),
+		WithServer("admin", admin, DependsOn("api", "database")),
+		AfterStart(
+			func(context.Context) error {
+				events.add("after start")
+				cancel()
+				return nil
+			},
+		),
+	)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]string{
+			"start database",
+			"ready database",
+			"start api",
+			"ready api",
+			"start admin",
+			"ready admin",
+			"after start",
+			"stop admin",
+			"stop api",
+			"stop database",
+		},
+		events.get(),
+	)
+}
+
+func TestRunServerStopErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := &testEvents{}
+	database := newTestServer("database", events)
+	database.stopErr = errors.New("connection reset")
+	api := newTestServer("api", events)
+	api.stopBlocks = true
+	err := Run(
+		WithContext(ctx),
+		WithServer("database", database),
+		WithServer("api", api, DependsOn("database"), ServerStopTimeout(10*time.Millisecond)),
+		AfterStart(
+			func(context.Context) error {
+				cancel()
+				return nil
+			},
+		),
+	)
+	assert.EqualError(
+		t,
+		err,
+		"server api failed to stop: context deadline exceeded; server database failed to stop: connection reset",
+	)
+}
+
+func TestRunServerNotReady(t *testing.T) {
+	events := &testEvents{}
+	database := newTestServer("database", events)
+	api := newTestServer("api", events)
+	api.readyAfter = -1
+	admin := newTestServer("admin", events)
+	err := Run(
+		WithContext(context.Background()),
+		WithServer("database", database),
+		WithServer("api", api, DependsOn("database"), ServerStartTimeout(10*time.Millisecond)),
+		WithServer("admin", admin, DependsOn("api")),
+	)
+	assert.EqualError(t, err, "server api was not ready within 10ms")
+	assert.Equal(
+		t,
+		[]string{
+			"start database",
+			"ready database",
+			"start api",
+			"stop api",
+			"stop database",
+		},
+		events.get(),
+	)
+}
+
+func TestRunStopsResolvedServers(t *testing.T) {
+	events := &testEvents{}
+	database := &testEndpointServer{newTestServer("database", events)}
+	api := &testEndpointServer{newTestServer("api", events)}
+	err := Run(
+		WithContext(context.Background()),
+		WithServer("database", database),
+		WithServer("api", api, DependsOn("database")),
+		BeforeStart(
+			func(context.Context) error {
+				events.add("before start")
+				return errors.New("migration failed")
+			},
+		),
+	)
+	assert.EqualError(t, err, "migration failed")
+	// The servers are stopped to release their listeners, though not started.
+	assert.Equal(
+		t,
+		[]string{
+			"endpoint database",
+			"endpoint api",
+			"before start",
+			"stop api",
+			"stop database",
+		},
+		events.get(),
+	)
+
+	events = &testEvents{}
+	database = &testEndpointServer{newTestServer("database", events)}
+	api = &testEndpointServer{newTestServer("api", events)}
+	api.readyAfter = -1
+	admin := &testEndpointServer{newTestServer("admin", events)}
+	err = Run(
+		WithContext(context.Background()),
+		WithServer("database", database),
+		WithServer("api", api, DependsOn("database"), ServerStartTimeout(10*time.Millisecond)),
+		WithServer("admin", admin, DependsOn("api")),
+	)
+	assert.EqualError(t, err, "server api was not ready within 10ms")
+	assert.Equal(
+		t,
+		[]string{
+			"endpoint database",
+			"endpoint api",
+			"endpoint admin",
+			"start database",
+			"ready database",
+			"start api",
+			"stop api",
+			"stop database",
+			"stop admin",
+		},
+		events.get(),
+	)
+}
+
+// testEndpointServer is a testServer that publishes its endpoint.
+type testEndpointServer struct {
+	*testServer
+}
+
+func (s *testEndpointServer) Endpoint() (*url.URL, error) {
+	s.events.add("endpoint " + s.name)
+	return &url.URL{Scheme: "http", Host: s.name}, nil
+}
+
+func TestSortServerEntries(t *testing.T) {
+	t.Parallel()
+	testSortServerEntries(
+		t,
+		[]*serverEntry{
+			newServerEntry("a", nil, DependsOn("c")),
+			newServerEntry("b", nil),
+			newServerEntry("c", nil, DependsOn("b")),
+			newServerEntry("d", nil),
+		},
+		[]string{"b", "c", "a", "d"},
+		"",
+	)
+	testSortServerEntries(
+		t,
+		[]*serverEntry{
+			newServerEntry("a", nil, DependsOn("b")),
+			newServerEntry("b", nil, DependsOn("c")),
+			newServerEntry("c", nil, DependsOn("a")),
+		},
+		nil,
+		"servers have a dependency cycle: a -> b -> c -> a",
+	)
+	testSortServerEntries(
+		t,
+		[]*serverEntry{
+			newServerEntry("a", nil, DependsOn("b")),
+		},
+		nil,
+		"server a depends on unknown server b",
+	)
+	testSortServerEntries(
+		t,
+		[]*serverEntry{
+			newServerEntry("a", nil),
+			newServerEntry("a", nil),
+		},
+		nil,
+		"duplicate server name: a",
+	)
+}
+
+func testSortServerEntries(t *testing.T, entries []*serverEntry, expectedNames []string, expectedErr string) {
+	sorted, err := sortServerEntries(entries)
+	if expectedErr != "" {
+		assert.EqualError(t, err, expectedErr)
+		return
+	}
+	require.NoError(t, err)
+	names := make([]string, 0, len(sorted))
+	for _, entry := range sorted {
+		names = append(names, entry.name)
+	}
+	assert.Equal(t, expectedNames, names)
+}
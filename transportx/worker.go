@@ -0,0 +1,289 @@
+package transportx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkerInitialBackoff = time.Second
+	defaultWorkerMaxBackoff     = time.Minute
+)
+
+// Worker is a background loop run by the runner, such as a queue consumer.
+//
+// Run should return when ctx is canceled.
+type Worker interface {
+	Run(ctx context.Context) error
+}
+
+// WorkerFunc is a function that implements Worker.
+type WorkerFunc func(ctx context.Context) error
+
+func (f WorkerFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// RestartPolicy determines when a Worker is restarted after Run returns.
+type RestartPolicy int
+
+const (
+	// RestartNever never restarts the Worker.
+	RestartNever RestartPolicy = iota + 1
+	// RestartOnFailure restarts the Worker if Run returns an error or panics.
+	RestartOnFailure
+	// RestartAlways restarts the Worker whenever Run returns.
+	RestartAlways
+)
+
+// WorkerState is the state of a Worker.
+type WorkerState string
+
+const (
+	WorkerStatePending   WorkerState = "pending"
+	WorkerStateRunning   WorkerState = "running"
+	WorkerStateBackoff   WorkerState = "backoff"
+	WorkerStateCompleted WorkerState = "completed"
+	WorkerStateFailed    WorkerState = "failed"
+	WorkerStateStopped   WorkerState = "stopped"
+)
+
+// WorkerStatus is the status of a Worker.
+//
+// The status of every Worker is reported in the details of Health.Check.
+type WorkerStatus struct {
+	State     WorkerState `json:"state"`
+	Restarts  int         `json:"restarts"`
+	LastError string      `json:"last_error,omitempty"`
+	StartedAt time.Time   `json:"started_at,omitempty"`
+}
+
+// WorkerOption is an option for a Worker added with WithWorker.
+type WorkerOption func(*workerServer)
+
+// WorkerRestartPolicy sets the RestartPolicy.
+//
+// The default is RestartOnFailure.
+func WorkerRestartPolicy(policy RestartPolicy) WorkerOption {
+	return func(w *workerServer) {
+		w.policy = policy
+	}
+}
+
+// WorkerMaxRestarts sets how many times the Worker is restarted before it is
+// considered failed.
+//
+// The default is no limit.
+func WorkerMaxRestarts(maxRestarts int) WorkerOption {
+	return func(w *workerServer) {
+		w.maxRestarts = maxRestarts
+	}
+}
+
+// WorkerBackoff sets the delay before restarting the Worker after a failure.
+//
+// The delay starts at initial and doubles with every consecutive failure, up to max.
+// The default is 1s, up to 1m.
+func WorkerBackoff(initial time.Duration, max time.Duration) WorkerOption {
+	return func(w *workerServer) {
+		w.initialBackoff = initial
+		w.maxBackoff = max
+	}
+}
+
+// WithWorker adds a named Worker that the runner supervises.
+//
+// The Worker is started and stopped like a server added with WithServer. A
+// Worker that has failed and is not restarted fails the liveness check named
+// after it, but does not stop the runner.
+func WithWorker(name string, worker Worker, opts ...WorkerOption) RunOption {
+	return func(app *runner) {
+		app.servers = append(app.servers, newServerEntry(name, newWorkerServer(name, worker, opts...)))
+	}
+}
+
+// workerServer runs a Worker as a Server.
+type workerServer struct {
+	name           string
+	worker         Worker
+	policy         RestartPolicy
+	maxRestarts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	// logger is set by the runner.
+	logger *zap.Logger
+
+	lock   sync.Mutex
+	status WorkerStatus
+	cancel context.CancelFunc
+	doneC  chan struct{}
+}
+
+func newWorkerServer(name string, worker Worker, opts ...WorkerOption) *workerServer {
+	w := &workerServer{
+		name:           name,
+		worker:         worker,
+		policy:         RestartOnFailure,
+		maxRestarts:    -1,
+		initialBackoff: defaultWorkerInitialBackoff,
+		maxBackoff:     defaultWorkerMaxBackoff,
+		logger:         zap.NewNop(),
+		status: WorkerStatus{
+			State: WorkerStatePending,
+		},
+		doneC: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Start runs the Worker until it is stopped or does not restart.
+func (w *workerServer) Start(ctx context.Context) error {
+	defer close(w.doneC)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w.lock.Lock()
+	w.cancel = cancel
+	w.lock.Unlock()
+
+	backoff := w.initialBackoff
+	for {
+		w.setStatus(
+			func(status *WorkerStatus) {
+				status.State = WorkerStateRunning
+				status.StartedAt = time.Now()
+			},
+		)
+		err := w.run(ctx)
+		if ctx.Err() != nil {
+			w.setState(WorkerStateStopped)
+			return nil
+		}
+		if err != nil {
+			w.logger.Error("worker failed", zap.String("worker", w.name), zap.Error(err))
+			w.setStatus(
+				func(status *WorkerStatus) {
+					status.LastError = err.Error()
+				},
+			)
+		}
+		if !w.shouldRestart(err) {
+			if err != nil {
+				w.setState(WorkerStateFailed)
+			} else {
+				w.setState(WorkerStateCompleted)
+			}
+			return nil
+		}
+		delay := w.initialBackoff
+		if err != nil {
+			delay = backoff
+			backoff = min(2*backoff, w.maxBackoff)
+		} else {
+			backoff = w.initialBackoff
+		}
+		w.setStatus(
+			func(status *WorkerStatus) {
+				status.State = WorkerStateBackoff
+				status.Restarts++
+			},
+		)
+		w.logger.Info("restarting worker", zap.String("worker", w.name), zap.Duration("delay", delay))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			w.setState(WorkerStateStopped)
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// Stop cancels the Worker, and waits for Run to return.
+func (w *workerServer) Stop(ctx context.Context) error {
+	w.lock.Lock()
+	cancel := w.cancel
+	w.lock.Unlock()
+	if cancel == nil {
+		// Never started.
+		return nil
+	}
+	cancel()
+	select {
+	case <-w.doneC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the status of the Worker.
+func (w *workerServer) Status() WorkerStatus {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.status
+}
+
+// HealthCheck fails if the Worker has failed and is not restarted.
+func (w *workerServer) HealthCheck(context.Context) error {
+	status := w.Status()
+	if status.State == WorkerStateFailed {
+		return fmt.Errorf("worker failed after %d restarts: %s", status.Restarts, status.LastError)
+	}
+	return nil
+}
+
+// run runs the Worker once, recovering a panic as an error.
+func (w *workerServer) run(ctx context.Context) (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.logger.Error(
+				"worker panicked",
+				zap.String("worker", w.name),
+				zap.Any("panic", r),
+				zap.ByteString("stack", debug.Stack()),
+			)
+			retErr = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	err := w.worker.Run(ctx)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (w *workerServer) shouldRestart(err error) bool {
+	switch w.policy {
+	case RestartAlways:
+	case RestartOnFailure:
+		if err == nil {
+			return false
+		}
+	default:
+		return false
+	}
+	return w.maxRestarts < 0 || w.Status().Restarts < w.maxRestarts
+}
+
+func (w *workerServer) setState(state WorkerState) {
+	w.setStatus(
+		func(status *WorkerStatus) {
+			status.State = state
+		},
+	)
+}
+
+func (w *workerServer) setStatus(f func(*WorkerStatus)) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	f(&w.status)
+}
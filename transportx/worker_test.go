@@ -0,0 +1,133 @@
+package transportx
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerRestartOnFailure(t *testing.T) {
+	t.Parallel()
+	var runs atomic.Int32
+	worker := newWorkerServer(
+		"consumer",
+		WorkerFunc(
+			func(ctx context.Context) error {
+				if runs.Add(1) <= 2 {
+					return errors.New("connection refused")
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		),
+		WorkerBackoff(time.Millisecond, 2*time.Millisecond),
+	)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- worker.Start(context.Background())
+	}()
+	waitForWorkerStatus(t, worker, func(status WorkerStatus) bool { return runs.Load() == 3 })
+	status := worker.Status()
+	assert.Equal(t, WorkerStateRunning, status.State)
+	assert.Equal(t, 2, status.Restarts)
+	assert.Equal(t, "connection refused", status.LastError)
+	require.NoError(t, worker.Stop(context.Background()))
+	require.NoError(t, <-errC)
+	assert.Equal(t, WorkerStateStopped, worker.Status().State)
+	assert.NoError(t, worker.HealthCheck(context.Background()))
+}
+
+func TestWorkerRestartPolicies(t *testing.T) {
+	t.Parallel()
+	testWorkerRestartPolicy(t, RestartNever, nil, WorkerStateCompleted, 0)
+	testWorkerRestartPolicy(t, RestartNever, errors.New("foo"), WorkerStateFailed, 0)
+	testWorkerRestartPolicy(t, RestartOnFailure, nil, WorkerStateCompleted, 0)
+	testWorkerRestartPolicy(t, RestartOnFailure, errors.New("foo"), WorkerStateFailed, 3)
+	testWorkerRestartPolicy(t, RestartAlways, nil, WorkerStateCompleted, 3)
+}
+
+func testWorkerRestartPolicy(
+	t *testing.T,
+	policy RestartPolicy,
+	runErr error,
+	expectedState WorkerState,
+	expectedRestarts int,
+) {
+	worker := newWorkerServer(
+		"consumer",
+		WorkerFunc(
+			func(context.Context) error {
+				return runErr
+			},
+		),
+		WorkerRestartPolicy(policy),
+		WorkerMaxRestarts(3),
+		WorkerBackoff(time.Millisecond, time.Millisecond),
+	)
+	require.NoError(t, worker.Start(context.Background()))
+	status := worker.Status()
+	// RestartAlways completes once the budget is spent on successful runs.
+	assert.Equal(t, expectedState, status.State)
+	assert.Equal(t, expectedRestarts, status.Restarts)
+}
+
+func TestRunWorkerPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	health := NewHealth()
+	var report *HealthReport
+	err := Run(
+		WithContext(ctx),
+		WithHealth(health),
+		WithWorker(
+			"consumer",
+			WorkerFunc(
+				func(context.Context) error {
+					panic("boom")
+				},
+			),
+			WorkerMaxRestarts(2),
+			WorkerBackoff(time.Millisecond, time.Millisecond),
+		),
+		AfterStart(
+			func(ctx context.Context) error {
+				go func() {
+					defer cancel()
+					for health.Liveness(ctx).Status == HealthStatusOK {
+						time.Sleep(time.Millisecond)
+					}
+					report = health.Check(ctx)
+				}()
+				return nil
+			},
+		),
+	)
+	// A failed worker does not fail the runner.
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.Equal(
+		t,
+		&HealthCheckResult{
+			Status: HealthStatusFail,
+			Error:  "worker failed after 2 restarts: panic: boom",
+		},
+		report.Checks["consumer"],
+	)
+	status, ok := report.Details["consumer"].(WorkerStatus)
+	require.True(t, ok)
+	assert.Equal(t, WorkerStateFailed, status.State)
+}
+
+func waitForWorkerStatus(t *testing.T, worker *workerServer, f func(WorkerStatus) bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !f(worker.Status()) {
+		if time.Now().After(deadline) {
+			require.FailNow(t, "timed out waiting for worker status", "%+v", worker.Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
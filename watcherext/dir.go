@@ -0,0 +1,123 @@
+package watcherext
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+)
+
+// WatchDir spawns a background goroutine to watch the files directly in dir,
+// reporting any changes to c with the path of the changed file as source.
+// Sub-directories are not watched. Watching stops when ctx is canceled.
+//
+// DispatchNow sends a ChangeEvent for every file in dir, and reports the number
+// of events sent.
+func WatchDir(ctx context.Context, dir string, c EventChannel) (Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		_ = watcher.Close()
+		return nil, errors.WithStack(err)
+	}
+	d := newDispatcher()
+	go streamDirEvents(ctx, watcher, c, d.trigger, d.done, filepath.Clean(dir))
+	return d, nil
+}
+
+func streamDirEvents(
+	ctx context.Context,
+	watcher *fsnotify.Watcher,
+	c EventChannel,
+	sendNow <-chan struct{},
+	sendNowDone chan<- int,
+	watchedDir string,
+) {
+	defer func() {
+		_ = watcher.Close()
+	}()
+	// send sends the event, and returns false if ctx is done.
+	send := func(event Event) bool {
+		select {
+		case c <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	// sendFile sends the current state of the file, and returns false if ctx is done.
+	sendFile := func(file string) bool {
+		//#nosec G304 -- false positive
+		data, err := os.ReadFile(file)
+		switch {
+		case err == nil:
+			return send(&ChangeEvent{data: data, source: source(file)})
+		case errors.Is(err, os.ErrNotExist):
+			return send(&RemoveEvent{source(file)})
+		default:
+			return send(&ErrorEvent{error: errors.WithStack(err), source: source(file)})
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sendNow:
+			entries, err := os.ReadDir(watchedDir)
+			if err != nil {
+				entries = nil
+				if !send(&ErrorEvent{error: errors.WithStack(err), source: source(watchedDir)}) {
+					return
+				}
+			}
+			sent := 0
+			for _, entry := range entries {
+				if entry.IsDir() {
+					continue
+				}
+				if !sendFile(filepath.Join(watchedDir, entry.Name())) {
+					return
+				}
+				sent++
+			}
+			select {
+			case sendNowDone <- sent:
+			case <-ctx.Done():
+				return
+			}
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			file := filepath.Clean(e.Name)
+			if filepath.Dir(file) != watchedDir {
+				continue
+			}
+			var sent bool
+			switch {
+			case e.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				sent = send(&RemoveEvent{source(file)})
+			case e.Op&(fsnotify.Write|fsnotify.Create) != 0:
+				if info, err := os.Stat(file); err == nil && info.IsDir() {
+					continue
+				}
+				sent = sendFile(file)
+			default:
+				continue
+			}
+			if !sent {
+				return
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			if !send(&ErrorEvent{error: errors.WithStack(err), source: source(watchedDir)}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package watcherext
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchDir(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+	c := make(EventChannel, 16)
+	watcher, err := WatchDir(ctx, dir, c)
+	require.NoError(t, err)
+
+	t.Run("case=dispatch now sends the files in the directory", func(t *testing.T) {
+		done, err := watcher.DispatchNow()
+		require.NoError(t, err)
+		assert.Equal(t, 1, <-done)
+		assertTestEvent(t, <-c, &ChangeEvent{}, filepath.Join(dir, "a.txt"), "a")
+	})
+
+	t.Run("case=create sends the new file", func(t *testing.T) {
+		file := filepath.Join(dir, "b.txt")
+		require.NoError(t, os.WriteFile(file, []byte("b"), 0o600))
+		waitForTestEvent(t, c, file, "b")
+	})
+
+	t.Run("case=write sends the changed file", func(t *testing.T) {
+		file := filepath.Join(dir, "b.txt")
+		require.NoError(t, os.WriteFile(file, []byte("bb"), 0o600))
+		waitForTestEvent(t, c, file, "bb")
+	})
+
+	t.Run("case=remove sends a remove event", func(t *testing.T) {
+		// Changes in sub-directories are not watched, so no event of sub/c.txt
+		// is received before the remove event.
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "c.txt"), []byte("c"), 0o600))
+		file := filepath.Join(dir, "a.txt")
+		require.NoError(t, os.Remove(file))
+		for {
+			e := receiveTestEvent(t, c)
+			require.Equal(t, dir, filepath.Dir(e.Source()), e.String())
+			if _, ok := e.(*RemoveEvent); ok {
+				assert.Equal(t, file, e.Source())
+				break
+			}
+		}
+	})
+
+	t.Run("case=dispatch now skips sub-directories", func(t *testing.T) {
+		done, err := watcher.DispatchNow()
+		require.NoError(t, err)
+		assert.Equal(t, 1, <-done)
+		// Events of earlier changes may still be buffered before the event of
+		// DispatchNow, which is sent last.
+		var e Event
+		for len(c) > 0 {
+			e = <-c
+		}
+		assertTestEvent(t, e, &ChangeEvent{}, filepath.Join(dir, "b.txt"), "bb")
+	})
+}
+
+func TestWatchDirNotExist(t *testing.T) {
+	t.Parallel()
+	_, err := WatchDir(context.Background(), filepath.Join(t.TempDir(), "missing"), make(EventChannel))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// waitForTestEvent receives events until a ChangeEvent of the file with the
+// data, since a single change may cause several events.
+func waitForTestEvent(t *testing.T, c EventChannel, file string, data string) {
+	t.Helper()
+	for {
+		e := receiveTestEvent(t, c)
+		if _, ok := e.(*ChangeEvent); !ok || e.Source() != file {
+			continue
+		}
+		if readTestEvent(t, e) == data {
+			return
+		}
+	}
+}
+
+func receiveTestEvent(t *testing.T, c EventChannel) Event {
+	t.Helper()
+	select {
+	case e := <-c:
+		return e
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for an event")
+		return nil
+	}
+}
+
+func assertTestEvent(t *testing.T, e Event, expected Event, file string, data string) {
+	t.Helper()
+	assert.IsType(t, expected, e)
+	assert.Equal(t, file, e.Source())
+	assert.Equal(t, data, readTestEvent(t, e))
+}
+
+func readTestEvent(t *testing.T, e Event) string {
+	t.Helper()
+	data, err := io.ReadAll(e.Reader())
+	require.NoError(t, err)
+	return string(data)
+}
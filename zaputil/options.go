@@ -8,10 +8,11 @@ import (
 )
 
 type options struct {
-	level   zapcore.Level
-	writer  io.Writer
-	encoder zapcore.Encoder
-	format  Format
+	level       zapcore.Level
+	atomicLevel *zap.AtomicLevel
+	writer      io.Writer
+	encoder     zapcore.Encoder
+	format      Format
 
 	zapOptions []zap.Option
 }
@@ -43,6 +44,14 @@ func WithLevel(level zapcore.Level) Option {
 	}
 }
 
+// WithAtomicLevel sets the zap.AtomicLevel of the logger, so the level can be
+// changed while the logger is in use. WithLevel is ignored if set.
+func WithAtomicLevel(level zap.AtomicLevel) Option {
+	return func(o *options) {
+		o.atomicLevel = &level
+	}
+}
+
 func WithWriter(writer io.Writer) Option {
 	return func(o *options) {
 		if writer != nil {
@@ -38,12 +38,16 @@ func NewLogger(opts ...Option) *zap.Logger {
 		encoder, _ := getZapEncoder(options.format)
 		options.encoder = cond.Ternary(encoder != nil, encoder, NewJSONEncoder())
 	}
+	level := zap.NewAtomicLevelAt(options.level)
+	if options.atomicLevel != nil {
+		level = *options.atomicLevel
+	}
 
 	return zap.New(
 		zapcore.NewCore(
 			options.encoder,
 			zapcore.Lock(zapcore.AddSync(options.writer)),
-			zap.NewAtomicLevelAt(options.level),
+			level,
 		),
 		options.zapOptions...,
 	)
@@ -81,3 +81,14 @@ func TestNewLogger(t *testing.T) {
 		zap.Duration("backoff", time.Second),
 	).Info("test")
 }
+
+func TestNewLoggerWithAtomicLevel(t *testing.T) {
+	t.Parallel()
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	logger := NewLogger(WithAtomicLevel(level), WithLevel(zapcore.ErrorLevel))
+	assert.False(t, logger.Core().Enabled(zapcore.DebugLevel))
+	assert.True(t, logger.Core().Enabled(zapcore.InfoLevel))
+
+	level.SetLevel(zapcore.DebugLevel)
+	assert.True(t, logger.Core().Enabled(zapcore.DebugLevel))
+}